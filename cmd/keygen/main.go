@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/JorgeSaicoski/login-go/internal/services"
+)
+
+func main() {
+	bits := flag.Int("bits", services.DefaultKeyBits, "RSA key size in bits (minimum 2048)")
+	outDir := flag.String("out", ".", "directory to write private.pem and public.pem to")
+	flag.Parse()
+
+	privatePEM, publicPEM, err := services.GenerateKeyPair(*bits)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "failed to generate key pair:", err)
+		os.Exit(1)
+	}
+
+	privatePath := filepath.Join(*outDir, "private.pem")
+	publicPath := filepath.Join(*outDir, "public.pem")
+
+	// The private key must only be readable by its owner
+	if err := os.WriteFile(privatePath, privatePEM, 0600); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to write private key:", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(publicPath, publicPEM, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "failed to write public key:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("wrote %s and %s\n", privatePath, publicPath)
+}
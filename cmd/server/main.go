@@ -2,9 +2,11 @@ package main
 
 import (
 	"context"
+	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -12,19 +14,50 @@ import (
 	"go.uber.org/zap"
 
 	"github.com/JorgeSaicoski/login-go/config"
+	"github.com/JorgeSaicoski/login-go/internal/events"
 	"github.com/JorgeSaicoski/login-go/internal/handlers"
 	"github.com/JorgeSaicoski/login-go/internal/repository"
 	"github.com/JorgeSaicoski/login-go/internal/routes"
 	"github.com/JorgeSaicoski/login-go/internal/services"
+	"github.com/JorgeSaicoski/login-go/internal/workers"
 )
 
 func main() {
+	// Load every setting from the environment (and CONFIG_FILE, if set)
+	appConfig, err := config.LoadAppConfig()
+	if err != nil {
+		log.Fatalf("failed to load configuration: %v", err)
+	}
+
 	// Initialize logger
-	logger, _ := zap.NewProduction()
+	logger, err := config.NewLogger(appConfig.Log.Level, appConfig.Log.Encoding)
+	if err != nil {
+		log.Fatalf("failed to initialize logger: %v", err)
+	}
 	defer logger.Sync()
 
+	// Initialize tracing; a no-op unless an OTLP endpoint is configured
+	tracingConfig := appConfig.Tracing
+	shutdownTracing, err := config.SetupTracing(context.Background(), tracingConfig)
+	if err != nil {
+		logger.Fatal("failed to set up tracing", zap.Error(err))
+	}
+	if tracingConfig.OTLPEndpoint != "" {
+		logger.Info("tracing enabled", zap.String("otlp_endpoint", tracingConfig.OTLPEndpoint))
+	}
+
 	// Initialize database
-	db := config.ConnectDatabase()
+	dbConfig := appConfig.Database
+	db, err := config.ConnectDatabase(dbConfig, logger)
+	if err != nil {
+		logger.Fatal("failed to connect to database", zap.Error(err))
+	}
+	logger.Info("database pool configured",
+		zap.Int("max_open_conns", dbConfig.MaxOpenConns),
+		zap.Int("max_idle_conns", dbConfig.MaxIdleConns),
+		zap.Duration("conn_max_lifetime", dbConfig.ConnMaxLifetime),
+		zap.Duration("conn_max_idle_time", dbConfig.ConnMaxIdleTime),
+	)
 	sqlDB, err := db.DB()
 	if err != nil {
 		logger.Fatal("failed to get database instance", zap.Error(err))
@@ -33,66 +66,203 @@ func main() {
 	// Initialize repositories
 	subscriptionRepo := repository.NewSubscriptionRepository(db)
 	userRepo := repository.NewUserRepository(db, logger)
+	if appConfig.EmailCanonicalization {
+		backfilled, err := userRepo.BackfillCanonicalEmails(context.Background())
+		if err != nil {
+			logger.Fatal("failed to backfill canonical emails", zap.Error(err))
+		}
+		userRepo.SetCanonicalEmailUniqueness(true)
+		logger.Info("email canonicalization enabled", zap.Int64("backfilled", backfilled))
+	}
 	userSubscriptionRepo := repository.NewUserSubscriptionRepository(db, logger)
+	auditRepo := repository.NewAuditRepository(db, logger)
+	passwordHistoryRepo := repository.NewPasswordHistoryRepository(db, logger)
+	refreshTokenRepo := repository.NewRefreshTokenRepository(db, logger)
+
+	// Initialize email verification
+	verificationService := services.NewEmailVerificationService(userRepo, services.NewLogVerificationSender(logger, appConfig.Auth.DevLogVerificationTokens), logger, appConfig.Auth.VerificationExpiry)
+	auditService := services.NewAuditService(auditRepo, logger)
+	passwordHistoryService := services.NewPasswordHistoryService(passwordHistoryRepo, appConfig.PasswordHistorySize, logger)
 
 	// Initialize handlers
-	subscriptionHandler := handlers.NewSubscriptionHandler(subscriptionRepo)
-	userHandler := handlers.NewUserHandler(userRepo, logger)
-	userSubscriptionHandler := handlers.NewUserSubscriptionHandler(userSubscriptionRepo, logger)
-	healthHandler := handlers.NewHealthHandler(db)
+	handlerTimeouts := handlers.Timeouts{
+		Read:  appConfig.Handlers.Read,
+		Write: appConfig.Handlers.Write,
+		Bulk:  appConfig.Handlers.Bulk,
+	}
+	// Handlers share one validator so custom rules are registered once
+	validate := handlers.NewValidator()
+	subscriptionHandler := handlers.NewSubscriptionHandler(subscriptionRepo, userSubscriptionRepo, handlerTimeouts)
+	// Rate limits are enforced per client IP
+	userHandler := handlers.NewUserHandler(userRepo, verificationService, auditService, passwordHistoryService, logger, validate, appConfig.RateLimit.User.Limit, appConfig.RateLimit.User.Burst, handlerTimeouts)
+	userSubscriptionHandler := handlers.NewUserSubscriptionHandler(userSubscriptionRepo, logger, validate, appConfig.RateLimit.UserSubscription.Limit, appConfig.RateLimit.UserSubscription.Burst, handlerTimeouts)
+	var eventBroker *events.Broker
+	if appConfig.SubscriptionEvents {
+		eventBroker = events.NewBroker()
+		userSubscriptionRepo.SetEventBroker(eventBroker)
+		userSubscriptionHandler.SetEventBroker(eventBroker)
+	}
+	healthHandler := handlers.NewHealthHandler(db, 2*time.Second)
+	workerRegistry := workers.NewRegistry()
+	healthHandler.SetWorkerRegistry(workerRegistry)
+	versionHandler := handlers.NewVersionHandler()
 
 	// Initialize auth service with configuration
 	authConfig := services.AuthConfig{
-		PrivateKeyPath: "path/to/private.pem", // Update with actual path
-		PublicKeyPath:  "path/to/public.pem",  // Update with actual path
-		TokenExpiry:    24 * time.Hour,
+		Algorithm:            appConfig.Auth.Algorithm,
+		PrivateKeyPEM:        appConfig.Auth.PrivateKeyPEM,
+		PublicKeyPEM:         appConfig.Auth.PublicKeyPEM,
+		PrivateKeyPath:       appConfig.Auth.PrivateKeyPath,
+		PublicKeyPath:        appConfig.Auth.PublicKeyPath,
+		HMACSecret:           appConfig.Auth.HMACSecret,
+		TokenExpiry:          appConfig.Auth.TokenExpiry,
+		ExtendedTokenExpiry:  appConfig.Auth.ExtendedTokenExpiry,
+		RefreshTokenExpiry:   appConfig.Auth.RefreshTokenExpiry,
+		RenewalWindow:        appConfig.Auth.RenewalWindow,
+		MaxLoginAttempts:     appConfig.Auth.MaxLoginAttempts,
+		LockoutDuration:      appConfig.Auth.LockoutDuration,
+		RequireVerifiedEmail: appConfig.Auth.RequireVerified,
+		Issuer:               appConfig.Auth.Issuer,
+		Audience:             appConfig.Auth.Audience,
+		PasswordMaxAge:       appConfig.Auth.PasswordMaxAge,
+		PasswordExpiryStrict: appConfig.Auth.PasswordExpiryStrict,
+		LoginIdentifier:      services.LoginIdentifier(appConfig.Auth.LoginIdentifier),
 	}
-	authService, err := services.NewAuthService(userRepo, logger, authConfig)
+	tokenRevoker := services.NewMemoryTokenRevoker()
+	loginAttempts := services.NewMemoryLoginAttemptTracker(authConfig.MaxLoginAttempts, authConfig.LockoutDuration)
+	authService, err := services.NewAuthService(userRepo, refreshTokenRepo, tokenRevoker, loginAttempts, auditService, logger, authConfig)
 	if err != nil {
 		logger.Fatal("failed to initialize auth service", zap.Error(err))
 	}
-	authHandler := handlers.NewAuthHandler(authService, userRepo, logger)
+	// Embed tenant and plan in access tokens for downstream services
+	authService.SetExtraClaimsFunc(services.SubscriptionClaims(userSubscriptionRepo))
+	authService.SetPasswordHistory(passwordHistoryService)
+	var sessionRepo *repository.SessionRepository
+	if appConfig.Auth.SessionsEnabled {
+		sessionRepo = repository.NewSessionRepository(db, logger)
+		authService.SetSessionRepository(sessionRepo)
+	}
+	loginRateLimit := appConfig.LoginLimit
+	loginLimiter := handlers.NewSlidingWindowLimiter(loginRateLimit.UsernameMaxAttempts, loginRateLimit.UsernameWindow)
+	authHandler := handlers.NewAuthHandler(authService, verificationService, userRepo, userSubscriptionRepo, loginLimiter, logger, validate, appConfig.RateLimit.Auth.Limit, appConfig.RateLimit.Auth.Burst, handlerTimeouts)
+	cookieConfig := appConfig.TokenCookie
+	authHandler.SetTokenCookieOptions(handlers.TokenCookieOptions{
+		Secure:   cookieConfig.Secure,
+		Domain:   cookieConfig.Domain,
+		SameSite: cookieConfig.SameSite,
+	})
 
 	// Initialize router
-	r := gin.Default()
+	r := gin.New()
+	// Only these proxies may set the client IP used for rate limits and audit logs
+	if err := r.SetTrustedProxies(appConfig.Server.TrustedProxies); err != nil {
+		logger.Fatal("invalid TRUSTED_PROXIES", zap.Error(err))
+	}
+	r.Use(routes.RequestIDMiddleware())
+	r.Use(routes.OTelMiddleware())
+	r.Use(routes.ZapLoggerMiddleware(logger))
+	r.Use(routes.ZapRecoveryMiddleware(logger))
+	r.Use(routes.CORSMiddleware(appConfig.CORS.AllowedOrigins))
+	bodyLimits := appConfig.BodyLimit
+	r.Use(routes.MaxBodyBytes(bodyLimits.MaxBytes, map[string]int64{
+		"/admin/users/bulk": bodyLimits.BulkMaxBytes,
+	}))
+	securityConfig := appConfig.Security
+	r.Use(routes.SecureHeadersMiddleware(routes.SecureHeadersOptions{
+		HSTS:         securityConfig.HSTSEnabled,
+		FrameOptions: securityConfig.FrameOptions,
+	}))
 
 	// Setup routes
-	routes.SetupSubscriptionRoutes(r, subscriptionHandler)
-	routes.SetupUserRoutes(r, userHandler)
-	routes.SetupUserSubscriptionRoutes(r, userSubscriptionHandler)
+	auth := routes.NewAuth(authHandler)
+	routes.SetupSubscriptionRoutes(r, subscriptionHandler, auth)
+	routes.SetupUserRoutes(r, userHandler, auth)
+	routes.SetupUserSubscriptionRoutes(r, userSubscriptionHandler, auth)
 	routes.SetupAuthRoutes(r, authHandler)
+	routes.SetupAdminRoutes(r, userHandler, auth)
+
+	// Metrics route, optionally protected by METRICS_TOKEN
+	routes.SetupMetricsRoutes(r, appConfig.MetricsToken)
 
 	// Health check routes
-	r.GET("/health", healthHandler.Check)
-	r.GET("/ready", healthHandler.Check)
+	r.GET("/health", healthHandler.Liveness)
+	r.GET("/ready", healthHandler.Readiness)
+	r.GET("/version", versionHandler.Version)
 
 	// Initialize server
-	srv := &http.Server{
-		Addr:    ":8080",
-		Handler: r,
-	}
+	serverConfig := appConfig.Server
+	srv := config.NewServer(serverConfig, r)
 
 	// Start server in goroutine
 	go func() {
-		logger.Info("starting server", zap.String("port", "8080"))
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Info("starting server",
+			zap.String("port", serverConfig.Port),
+			zap.Duration("read_header_timeout", serverConfig.ReadHeaderTimeout),
+			zap.Duration("read_timeout", serverConfig.ReadTimeout),
+			zap.Duration("write_timeout", serverConfig.WriteTimeout),
+			zap.Duration("idle_timeout", serverConfig.IdleTimeout),
+			zap.Bool("tls", serverConfig.TLSEnabled()),
+		)
+		var err error
+		if serverConfig.TLSEnabled() {
+			err = srv.ListenAndServeTLS(serverConfig.TLSCertFile, serverConfig.TLSKeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Fatal("failed to start server", zap.Error(err))
 		}
 	}()
 
+	// Start background workers
+	workerCtx, stopWorkers := context.WithCancel(context.Background())
+	var workerWG sync.WaitGroup
+	workerConfig := appConfig.Workers
+	backgroundWorkers := []*workers.Periodic{
+		workers.NewRenewalWorker(userSubscriptionRepo, workerConfig.RenewalWindow, workerConfig.RenewalInterval, logger),
+		workers.NewExpiryWorker(userSubscriptionRepo, workerConfig.ExpiryInterval, logger),
+		workers.NewExpiryNotificationWorker(userSubscriptionRepo, workers.NewLogNotifier(logger), workerConfig.NotifyWindow, workerConfig.NotifyInterval, logger),
+		workers.NewTokenCleanupWorker(tokenRevoker, refreshTokenRepo, sessionRepo, workerConfig.TokenCleanupInterval, logger),
+	}
+	for _, w := range backgroundWorkers {
+		w.ReportTo(workerRegistry)
+		workerWG.Add(1)
+		go func(w *workers.Periodic) {
+			defer workerWG.Done()
+			w.Run(workerCtx)
+		}(w)
+	}
+
 	// Wait for interrupt signal
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 	logger.Info("shutting down server...")
 
-	// Create shutdown context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Create shutdown context with timeout; 0 waits for requests to finish
+	ctx, cancel := context.WithCancel(context.Background())
+	if serverConfig.ShutdownTimeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), serverConfig.ShutdownTimeout)
+	}
 	defer cancel()
 
-	// Shutdown server
+	// End open event streams, which would otherwise hold up the shutdown
+	if eventBroker != nil {
+		eventBroker.Close()
+	}
+
+	// Shutdown server; keep going on timeout so workers and the DB still close
 	if err := srv.Shutdown(ctx); err != nil {
-		logger.Fatal("server forced to shutdown", zap.Error(err))
+		logger.Error("server forced to shutdown", zap.Error(err))
+	}
+
+	// Stop background workers and wait for in-flight runs
+	stopWorkers()
+	workerWG.Wait()
+
+	// Flush buffered spans
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error("error shutting down tracing", zap.Error(err))
 	}
 
 	// Close database connection
@@ -0,0 +1,206 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// AppConfig gathers every setting the server reads at startup so they can
+// be changed without recompiling. Each section keeps its own env variables
+// and defaults.
+type AppConfig struct {
+	Log         LogConfig
+	Server      ServerConfig
+	Handlers    HandlerTimeoutConfig
+	Database    DatabaseConfig
+	Auth        AuthConfig
+	RateLimit   RateLimitConfig
+	LoginLimit  LoginRateLimitConfig
+	CORS        CORSConfig
+	Security    SecurityHeadersConfig
+	TokenCookie TokenCookieConfig
+	BodyLimit   BodyLimitConfig
+	Tracing     TracingConfig
+	Workers     WorkerConfig
+
+	PasswordHistorySize   int
+	EmailCanonicalization bool
+	SubscriptionEvents    bool
+	MetricsToken          string
+}
+
+type AuthConfig struct {
+	// Algorithm is RS256 or HS256
+	Algorithm string
+	// PrivateKeyPEM and PublicKeyPEM hold the keys inline, for deployments
+	// that pass them as secrets; they take precedence over the paths
+	PrivateKeyPEM  string
+	PublicKeyPEM   string
+	PrivateKeyPath string
+	PublicKeyPath  string
+	// HMACSecret is required for HS256
+	HMACSecret          string
+	TokenExpiry         time.Duration
+	ExtendedTokenExpiry time.Duration
+	RefreshTokenExpiry  time.Duration
+	RenewalWindow       time.Duration
+	MaxLoginAttempts    int
+	LockoutDuration     time.Duration
+	RequireVerified     bool
+	Issuer              string
+	Audience            string
+	VerificationExpiry  time.Duration
+	// PasswordMaxAge forces password rotation; zero disables it
+	PasswordMaxAge       time.Duration
+	PasswordExpiryStrict bool
+	// SessionsEnabled records each login's device and lets users list and
+	// revoke them
+	SessionsEnabled bool
+	// LoginIdentifier is username, email or either
+	LoginIdentifier string
+	// DevLogVerificationTokens logs verification tokens at debug level so
+	// they can be used without a mailer. Development only.
+	DevLogVerificationTokens bool
+}
+
+// RateLimit is a per-client-IP token bucket
+type RateLimit struct {
+	Limit rate.Limit
+	Burst int
+}
+
+type RateLimitConfig struct {
+	User             RateLimit
+	UserSubscription RateLimit
+	Auth             RateLimit
+}
+
+// LoadAuthConfig reads the token signing and login policy settings. The
+// defaults match what the server used before they were configurable.
+func LoadAuthConfig() AuthConfig {
+	return AuthConfig{
+		Algorithm:            getEnv("AUTH_ALGORITHM", "RS256"),
+		PrivateKeyPEM:        getPEM("AUTH_PRIVATE_KEY_PEM"),
+		PublicKeyPEM:         getPEM("AUTH_PUBLIC_KEY_PEM"),
+		PrivateKeyPath:       getEnv("AUTH_PRIVATE_KEY_PATH", ""),
+		PublicKeyPath:        getEnv("AUTH_PUBLIC_KEY_PATH", ""),
+		HMACSecret:           getEnv("AUTH_HMAC_SECRET", ""),
+		TokenExpiry:          getDuration("AUTH_TOKEN_EXPIRY", 15*time.Minute),
+		ExtendedTokenExpiry:  getDuration("AUTH_EXTENDED_TOKEN_EXPIRY", 24*time.Hour),
+		RefreshTokenExpiry:   getDuration("AUTH_REFRESH_TOKEN_EXPIRY", 7*24*time.Hour),
+		RenewalWindow:        getDuration("AUTH_RENEWAL_WINDOW", 24*time.Hour),
+		MaxLoginAttempts:     getInt("AUTH_MAX_LOGIN_ATTEMPTS", 5),
+		LockoutDuration:      getDuration("AUTH_LOCKOUT_DURATION", 15*time.Minute),
+		RequireVerified:      getBool("AUTH_REQUIRE_VERIFIED_EMAIL", false),
+		Issuer:               getEnv("AUTH_ISSUER", "login-go"),
+		Audience:             getEnv("AUTH_AUDIENCE", ""),
+		VerificationExpiry:   getDuration("AUTH_VERIFICATION_EXPIRY", 24*time.Hour),
+		PasswordMaxAge:       getDuration("AUTH_PASSWORD_MAX_AGE", 0),
+		PasswordExpiryStrict: getBool("AUTH_PASSWORD_EXPIRY_STRICT", false),
+		SessionsEnabled:      getBool("AUTH_SESSIONS_ENABLED", false),
+		LoginIdentifier:      strings.ToLower(getEnv("AUTH_LOGIN_IDENTIFIER", "username")),
+
+		DevLogVerificationTokens: getBool("AUTH_DEV_LOG_VERIFICATION_TOKENS", false),
+	}
+}
+
+// LoadRateLimitConfig reads the per-IP request rate (per second) and burst
+// of each handler group, e.g. RATE_LIMIT_USER_RPS and RATE_LIMIT_USER_BURST.
+func LoadRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		User:             loadRateLimit("RATE_LIMIT_USER", 1, 50),
+		UserSubscription: loadRateLimit("RATE_LIMIT_USER_SUBSCRIPTION", 1, 100),
+		Auth:             loadRateLimit("RATE_LIMIT_AUTH", 1, 10),
+	}
+}
+
+// loadRateLimit reads one group's limit. An RPS of 0 turns the limit off;
+// a burst of 0 would reject every request, so it keeps the default.
+func loadRateLimit(prefix string, rps float64, burst int) RateLimit {
+	limit := rate.Limit(getFloat(prefix+"_RPS", rps))
+	if limit == 0 {
+		limit = rate.Inf
+	}
+	b := getInt(prefix+"_BURST", burst)
+	if b == 0 {
+		b = burst
+	}
+	return RateLimit{Limit: limit, Burst: b}
+}
+
+// LoadAppConfig loads every section. When CONFIG_FILE names a file of
+// KEY=VALUE lines, its values are used for variables not already set in
+// the environment.
+func LoadAppConfig() (AppConfig, error) {
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		if err := loadEnvFile(path); err != nil {
+			return AppConfig{}, err
+		}
+	}
+
+	server := LoadServerConfig()
+	if (server.TLSCertFile == "") != (server.TLSKeyFile == "") {
+		return AppConfig{}, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+
+	return AppConfig{
+		Log:         LoadLogConfig(),
+		Server:      server,
+		Handlers:    LoadHandlerTimeoutConfig(),
+		Database:    LoadDatabaseConfig(),
+		Auth:        LoadAuthConfig(),
+		RateLimit:   LoadRateLimitConfig(),
+		LoginLimit:  LoadLoginRateLimitConfig(),
+		CORS:        LoadCORSConfig(),
+		Security:    LoadSecurityHeadersConfig(),
+		TokenCookie: LoadTokenCookieConfig(),
+		BodyLimit:   LoadBodyLimitConfig(),
+		Tracing:     LoadTracingConfig(),
+		Workers:     LoadWorkerConfig(),
+
+		PasswordHistorySize:   LoadPasswordHistorySize(),
+		EmailCanonicalization: LoadEmailCanonicalization(),
+		SubscriptionEvents:    LoadSubscriptionEvents(),
+		MetricsToken:          getEnv("METRICS_TOKEN", ""),
+	}, nil
+}
+
+// loadEnvFile sets the variables in a KEY=VALUE file that are not already
+// in the environment. Blank lines and lines starting with # are skipped.
+func loadEnvFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		if !ok {
+			return fmt.Errorf("config file %s line %d: expected KEY=VALUE", path, line)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.Trim(strings.TrimSpace(value), `"`)
+		if _, set := os.LookupEnv(key); set {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("config file %s line %d: %w", path, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+package config
+
+type BodyLimitConfig struct {
+	MaxBytes int64
+	// BulkMaxBytes applies to the admin bulk user import instead of MaxBytes
+	BulkMaxBytes int64
+}
+
+// LoadBodyLimitConfig reads MAX_BODY_BYTES (default 1 MiB) and
+// BULK_MAX_BODY_BYTES (default 4 MiB). Invalid values fall back to the
+// default.
+func LoadBodyLimitConfig() BodyLimitConfig {
+	return BodyLimitConfig{
+		MaxBytes:     getInt64("MAX_BODY_BYTES", 1<<20),
+		BulkMaxBytes: getInt64("BULK_MAX_BODY_BYTES", 4<<20),
+	}
+}
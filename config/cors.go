@@ -0,0 +1,25 @@
+package config
+
+import "strings"
+
+type CORSConfig struct {
+	AllowedOrigins []string
+}
+
+// LoadCORSConfig reads the comma-separated CORS_ALLOWED_ORIGINS list.
+// An empty list disables cross-origin access.
+func LoadCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: splitList(getEnv("CORS_ALLOWED_ORIGINS", "")),
+	}
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -1,20 +1,215 @@
 package config
 
 import (
-	"log"
+	"fmt"
+	"strings"
+	"time"
 
+	"go.uber.org/zap"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
 
 	"github.com/JorgeSaicoski/login-go/internal/models"
 )
 
-func ConnectDatabase() *gorm.DB {
-	dsn := "host=db user=postgres password=yourpassword dbname=postgres port=5432 sslmode=disable"
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+type DatabaseConfig struct {
+	Host     string
+	User     string
+	Password string
+	Name     string
+	Port     string
+	SSLMode  string
+
+	// ReplicaDSN, when set, is a read replica for subscription queries
+	// outside transactions; writes and transactions always use the primary
+	ReplicaDSN string
+
+	// Connection pool limits
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// Startup retries; the delay doubles after each failed attempt
+	ConnectMaxAttempts int
+	ConnectBaseDelay   time.Duration
+}
+
+// LoadDatabaseConfig reads the database settings from the environment,
+// falling back to the docker-compose defaults.
+func LoadDatabaseConfig() DatabaseConfig {
+	return DatabaseConfig{
+		Host:     getEnv("DB_HOST", "db"),
+		User:     getEnv("DB_USER", "postgres"),
+		Password: getEnv("DB_PASSWORD", "yourpassword"),
+		Name:     getEnv("DB_NAME", "postgres"),
+		Port:     getEnv("DB_PORT", "5432"),
+		SSLMode:  getEnv("DB_SSLMODE", "disable"),
+
+		ReplicaDSN: getEnv("DB_REPLICA_DSN", ""),
+
+		MaxOpenConns:    getInt("DB_MAX_OPEN_CONNS", 25),
+		MaxIdleConns:    getInt("DB_MAX_IDLE_CONNS", 10),
+		ConnMaxLifetime: getDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute),
+		ConnMaxIdleTime: getDuration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute),
+
+		ConnectMaxAttempts: getInt("DB_CONNECT_MAX_ATTEMPTS", 5),
+		ConnectBaseDelay:   getDuration("DB_CONNECT_BASE_DELAY", time.Second),
+	}
+}
+
+func (c DatabaseConfig) DSN() string {
+	return fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=%s",
+		c.Host, c.User, c.Password, c.Name, c.Port, c.SSLMode)
+}
+
+const maxConnectDelay = 30 * time.Second
+
+func ConnectDatabase(cfg DatabaseConfig, logger *zap.Logger) (*gorm.DB, error) {
+	db, err := openWithRetry(cfg, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database instance: %w", err)
+	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	if err := db.AutoMigrate(&models.User{}, &models.Subscription{}, &models.UserSubscription{}, &models.AuthEvent{}, &models.RefreshToken{}, &models.PasswordHistory{}, &models.Session{}); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	// Case-insensitive uniqueness, enforced by the database as well as the
+	// repository checks. Soft-deleted users still hold their identifiers.
+	for _, stmt := range []string{
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_lower ON users (LOWER(username_for_login))",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (LOWER(email))",
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			return nil, fmt.Errorf("failed to create unique index (check for case-insensitive duplicates): %w", err)
+		}
+	}
+
+	if err := backfillUserUpdatedAt(db); err != nil {
+		return nil, err
+	}
+
+	if err := addSubscriptionTypeCheck(db); err != nil {
+		return nil, err
+	}
+
+	// Registered after migrating so schema checks never read a lagging replica
+	if cfg.ReplicaDSN != "" {
+		if err := useReadReplica(db, postgres.Open(cfg.ReplicaDSN), cfg); err != nil {
+			return nil, err
+		}
+		logger.Info("database read replica configured")
+	}
+	return db, nil
+}
+
+// backfillUserUpdatedAt treats users that have no updated_at, such as rows
+// written outside gorm, as unchanged since creation. It only touches NULLs,
+// so running it on every start is safe.
+func backfillUserUpdatedAt(db *gorm.DB) error {
+	if err := db.Exec("UPDATE users SET updated_at = created_at WHERE updated_at IS NULL").Error; err != nil {
+		return fmt.Errorf("failed to backfill users.updated_at: %w", err)
+	}
+	return nil
+}
+
+const subscriptionTypeCheck = "chk_user_subscriptions_type"
+
+// addSubscriptionTypeCheck restricts user_subscriptions.type to the known
+// models.SubscriptionTypes, so direct writes can't store values such as
+// "INDIVIDUAL" either. Existing rows must already comply. When a type is
+// added, drop the constraint so the next start recreates it.
+func addSubscriptionTypeCheck(db *gorm.DB) error {
+	if db.Migrator().HasConstraint(&models.UserSubscription{}, subscriptionTypeCheck) {
+		return nil
+	}
+
+	types := models.SubscriptionTypes()
+	quoted := make([]string, 0, len(types))
+	for _, t := range types {
+		quoted = append(quoted, "'"+string(t)+"'")
+	}
+	stmt := fmt.Sprintf("ALTER TABLE user_subscriptions ADD CONSTRAINT %s CHECK (type IN (%s))",
+		subscriptionTypeCheck, strings.Join(quoted, ", "))
+	if err := db.Exec(stmt).Error; err != nil {
+		return fmt.Errorf("failed to add subscription type check (fix rows with unknown types first): %w", err)
+	}
+	return nil
+}
+
+// useReadReplica routes reads of the user and subscription tables to the
+// replica with gorm's dbresolver, using the same pool limits as the primary.
+// Logins, token checks and writes pin their user reads to the primary with
+// repository.WithPrimary; tokens and audit events always stay on it.
+func useReadReplica(db *gorm.DB, replica gorm.Dialector, cfg DatabaseConfig) error {
+	resolver := dbresolver.Register(dbresolver.Config{
+		Replicas: []gorm.Dialector{replica},
+	}, &models.User{}, &models.Subscription{}, &models.UserSubscription{}).
+		SetMaxOpenConns(cfg.MaxOpenConns).
+		SetMaxIdleConns(cfg.MaxIdleConns).
+		SetConnMaxLifetime(cfg.ConnMaxLifetime).
+		SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	if err := db.Use(resolver); err != nil {
+		return fmt.Errorf("failed to register read replica: %w", err)
+	}
+	return nil
+}
+
+// openWithRetry keeps opening and pinging the database with exponential
+// backoff, so the service can start before Postgres is accepting connections.
+func openWithRetry(cfg DatabaseConfig, logger *zap.Logger) (*gorm.DB, error) {
+	attempts := cfg.ConnectMaxAttempts
+	if attempts <= 0 {
+		attempts = 1
+	}
+	delay := cfg.ConnectBaseDelay
+
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		db, err := gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{})
+		if err == nil {
+			err = ping(db)
+		}
+		if err == nil {
+			return db, nil
+		}
+		lastErr = err
+
+		if attempt == attempts {
+			break
+		}
+		logger.Warn("database not reachable, retrying",
+			zap.Int("attempt", attempt),
+			zap.Int("max_attempts", attempts),
+			zap.Duration("retry_in", delay),
+			zap.Error(err),
+		)
+		time.Sleep(delay)
+		delay *= 2
+		if delay > maxConnectDelay {
+			delay = maxConnectDelay
+		}
+	}
+
+	return nil, fmt.Errorf("failed to connect to database after %d attempts: %w", attempts, lastErr)
+}
+
+func ping(db *gorm.DB) error {
+	sqlDB, err := db.DB()
 	if err != nil {
-		log.Fatal("Failed to connect to database:", err)
+		return err
 	}
-	db.AutoMigrate(&models.User{}, &models.Subscription{}, &models.UserSubscription{})
-	return db
+	return sqlDB.Ping()
 }
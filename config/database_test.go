@@ -0,0 +1,120 @@
+package config
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/JorgeSaicoski/login-go/internal/models"
+	"github.com/JorgeSaicoski/login-go/internal/repository"
+	"github.com/JorgeSaicoski/login-go/internal/testutil"
+)
+
+// TestReadReplicaRouting seeds the same rows with different names on the
+// primary and the replica, so each read shows which one served it.
+func TestReadReplicaRouting(t *testing.T) {
+	primary := testutil.NewDB(t)
+	replica := testutil.NewDB(t)
+
+	var userID, planID uint
+	for _, seed := range []struct {
+		db   *gorm.DB
+		name string
+	}{{primary, "primary"}, {replica, "replica"}} {
+		user := &models.User{Name: seed.name, UsernameForLogin: "alice", Email: "alice@example.com", Password: "hash", Active: true}
+		if err := seed.db.Create(user).Error; err != nil {
+			t.Fatalf("seed %s user: %v", seed.name, err)
+		}
+		plan := &models.Subscription{Name: seed.name, PeriodMonths: 1}
+		if err := seed.db.Create(plan).Error; err != nil {
+			t.Fatalf("seed %s plan: %v", seed.name, err)
+		}
+		userID, planID = user.ID, plan.ID
+	}
+
+	if err := useReadReplica(primary, replica.Dialector, DatabaseConfig{}); err != nil {
+		t.Fatalf("useReadReplica: %v", err)
+	}
+
+	users := repository.NewUserRepository(primary, zap.NewNop())
+	plans := repository.NewSubscriptionRepository(primary)
+	ctx := context.Background()
+
+	user, err := users.GetByIDWithContext(ctx, userID)
+	if err != nil {
+		t.Fatalf("get user: %v", err)
+	}
+	if user.Name != "replica" {
+		t.Fatalf("user read from %s, want replica", user.Name)
+	}
+
+	user, err = users.GetByIDWithContext(repository.WithPrimary(ctx), userID)
+	if err != nil {
+		t.Fatalf("get user from primary: %v", err)
+	}
+	if user.Name != "primary" {
+		t.Fatalf("pinned user read from %s, want primary", user.Name)
+	}
+
+	plan, err := plans.GetByIDWithContext(ctx, planID)
+	if err != nil {
+		t.Fatalf("get plan: %v", err)
+	}
+	if plan.Name != "replica" {
+		t.Fatalf("plan read from %s, want replica", plan.Name)
+	}
+
+	// Writes always go to the primary
+	user.Name = "renamed"
+	if err := users.UpdateWithContext(ctx, user); err != nil {
+		t.Fatalf("update user: %v", err)
+	}
+	var stored models.User
+	if err := replica.First(&stored, userID).Error; err != nil {
+		t.Fatalf("read replica row: %v", err)
+	}
+	if stored.Name != "replica" {
+		t.Fatalf("update reached the replica")
+	}
+}
+
+func TestBackfillUserUpdatedAt(t *testing.T) {
+	db := testutil.NewDB(t)
+
+	created := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	for _, name := range []string{"legacy", "current"} {
+		user := &models.User{Name: name, UsernameForLogin: name, Email: name + "@example.com", Password: "hash", Active: true, CreatedAt: created}
+		if err := db.Create(user).Error; err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+	}
+	// As if written outside gorm
+	if err := db.Exec("UPDATE users SET updated_at = NULL WHERE username_for_login = ?", "legacy").Error; err != nil {
+		t.Fatalf("clear updated_at: %v", err)
+	}
+	var current models.User
+	if err := db.Where("username_for_login = ?", "current").First(&current).Error; err != nil {
+		t.Fatalf("load current: %v", err)
+	}
+
+	// Running it again must not change anything
+	for i := 0; i < 2; i++ {
+		if err := backfillUserUpdatedAt(db); err != nil {
+			t.Fatalf("backfill: %v", err)
+		}
+	}
+
+	var users []models.User
+	if err := db.Order("id").Find(&users).Error; err != nil {
+		t.Fatalf("load users: %v", err)
+	}
+	if !users[0].UpdatedAt.Equal(created) {
+		t.Errorf("legacy updated_at = %v, want created_at %v", users[0].UpdatedAt, created)
+	}
+	if !users[1].UpdatedAt.Equal(current.UpdatedAt) {
+		t.Errorf("current updated_at changed from %v to %v", current.UpdatedAt, users[1].UpdatedAt)
+	}
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The helpers below read one environment variable each. A variable that is
+// set and parses is used as is, including 0, so 0 can turn off the
+// settings that support it. Unset, empty, negative or unparseable values
+// give the fallback.
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getInt(key string, fallback int) int {
+	value, err := strconv.Atoi(getEnv(key, ""))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+func getInt64(key string, fallback int64) int64 {
+	value, err := strconv.ParseInt(getEnv(key, ""), 10, 64)
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+func getFloat(key string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(getEnv(key, ""), 64)
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(getEnv(key, ""))
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+func getBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(getEnv(key, ""))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+// getPEM reads a PEM block from the environment. Secret stores often flatten
+// it to one line with escaped newlines, so a literal \n is turned back into
+// a newline; PEM never contains a backslash.
+func getPEM(key string) string {
+	return strings.ReplaceAll(os.Getenv(key), `\n`, "\n")
+}
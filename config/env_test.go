@@ -0,0 +1,136 @@
+package config
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/time/rate"
+)
+
+func TestEnvHelpersAcceptZero(t *testing.T) {
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", time.Hour},
+		{"0", 0},
+		{"0s", 0},
+		{"30m", 30 * time.Minute},
+		{"-1m", time.Hour},
+		{"soon", time.Hour},
+	}
+	for _, tt := range tests {
+		t.Setenv("TEST_DURATION", tt.value)
+		if got := getDuration("TEST_DURATION", time.Hour); got != tt.want {
+			t.Errorf("getDuration(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+
+	for value, want := range map[string]int{"": 5, "0": 0, "7": 7, "-2": 5, "x": 5} {
+		t.Setenv("TEST_INT", value)
+		if got := getInt("TEST_INT", 5); got != want {
+			t.Errorf("getInt(%q) = %d, want %d", value, got, want)
+		}
+	}
+
+	for value, want := range map[string]float64{"": 1.5, "0": 0, "2.5": 2.5, "-1": 1.5} {
+		t.Setenv("TEST_FLOAT", value)
+		if got := getFloat("TEST_FLOAT", 1.5); got != want {
+			t.Errorf("getFloat(%q) = %v, want %v", value, got, want)
+		}
+	}
+}
+
+func TestLoadRateLimitZero(t *testing.T) {
+	t.Setenv("RATE_LIMIT_TEST_RPS", "0")
+	t.Setenv("RATE_LIMIT_TEST_BURST", "0")
+
+	got := loadRateLimit("RATE_LIMIT_TEST", 1, 50)
+	if got.Limit != rate.Inf {
+		t.Errorf("limit = %v, want rate.Inf", got.Limit)
+	}
+	if got.Burst != 50 {
+		t.Errorf("burst = %d, want the default 50", got.Burst)
+	}
+}
+
+func TestLoadAppConfigFromEnv(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("PORT", "9090")
+	t.Setenv("SERVER_SHUTDOWN_TIMEOUT", "0")
+	t.Setenv("DB_MAX_OPEN_CONNS", "40")
+	t.Setenv("AUTH_TOKEN_EXPIRY", "5m")
+	t.Setenv("RATE_LIMIT_AUTH_RPS", "2.5")
+	t.Setenv("RATE_LIMIT_AUTH_BURST", "20")
+	t.Setenv("EXPIRY_INTERVAL", "0")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example.com, https://b.example.com")
+
+	cfg, err := LoadAppConfig()
+	if err != nil {
+		t.Fatalf("LoadAppConfig: %v", err)
+	}
+	if cfg.Server.Port != "9090" || cfg.Server.ShutdownTimeout != 0 {
+		t.Errorf("server = %+v", cfg.Server)
+	}
+	if cfg.Database.MaxOpenConns != 40 {
+		t.Errorf("max open conns = %d, want 40", cfg.Database.MaxOpenConns)
+	}
+	if cfg.Auth.TokenExpiry != 5*time.Minute {
+		t.Errorf("token expiry = %v, want 5m", cfg.Auth.TokenExpiry)
+	}
+	if cfg.RateLimit.Auth != (RateLimit{Limit: 2.5, Burst: 20}) {
+		t.Errorf("auth rate limit = %+v", cfg.RateLimit.Auth)
+	}
+	if cfg.Workers.ExpiryInterval != 0 || cfg.Workers.RenewalInterval != time.Hour {
+		t.Errorf("workers = %+v", cfg.Workers)
+	}
+	if len(cfg.CORS.AllowedOrigins) != 2 {
+		t.Errorf("CORS origins = %v", cfg.CORS.AllowedOrigins)
+	}
+}
+
+func TestLoadAuthConfigInlinePEM(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	privatePEM := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal public key: %v", err)
+	}
+	publicPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}))
+
+	// The private key arrives flattened to one line, the public key as is
+	t.Setenv("AUTH_PRIVATE_KEY_PEM", strings.ReplaceAll(privatePEM, "\n", `\n`))
+	t.Setenv("AUTH_PUBLIC_KEY_PEM", publicPEM)
+
+	cfg := LoadAuthConfig()
+	if cfg.PrivateKeyPEM != privatePEM || cfg.PublicKeyPEM != publicPEM {
+		t.Fatalf("PEM keys not loaded as sent:\n%s\n%s", cfg.PrivateKeyPEM, cfg.PublicKeyPEM)
+	}
+	if _, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(cfg.PrivateKeyPEM)); err != nil {
+		t.Errorf("parse private key: %v", err)
+	}
+	if _, err := jwt.ParseRSAPublicKeyFromPEM([]byte(cfg.PublicKeyPEM)); err != nil {
+		t.Errorf("parse public key: %v", err)
+	}
+}
+
+// Without key settings, RS256 startup must fail on the missing key rather
+// than on a placeholder path that doesn't exist
+func TestLoadAuthConfigNoKeyDefaults(t *testing.T) {
+	for _, key := range []string{"AUTH_PRIVATE_KEY_PEM", "AUTH_PUBLIC_KEY_PEM", "AUTH_PRIVATE_KEY_PATH", "AUTH_PUBLIC_KEY_PATH"} {
+		t.Setenv(key, "")
+	}
+	cfg := LoadAuthConfig()
+	if cfg.PrivateKeyPath != "" || cfg.PublicKeyPath != "" || cfg.PrivateKeyPEM != "" || cfg.PublicKeyPEM != "" {
+		t.Fatalf("key defaults = %q %q %q %q, want all empty", cfg.PrivateKeyPath, cfg.PublicKeyPath, cfg.PrivateKeyPEM, cfg.PublicKeyPEM)
+	}
+}
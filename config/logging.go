@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type LogConfig struct {
+	// Level is debug, info, warn or error
+	Level string
+	// Encoding is json or console
+	Encoding string
+}
+
+// LoadLogConfig reads LOG_LEVEL (default info) and LOG_FORMAT (json or
+// console, default json).
+func LoadLogConfig() LogConfig {
+	return LogConfig{
+		Level:    getEnv("LOG_LEVEL", "info"),
+		Encoding: getEnv("LOG_FORMAT", "json"),
+	}
+}
+
+// NewLogger builds a logger on zap's production settings with the given
+// level and encoding. Console encoding also colors levels for local use.
+func NewLogger(level, encoding string) (*zap.Logger, error) {
+	lvl, err := zapcore.ParseLevel(level)
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", level, err)
+	}
+
+	cfg := zap.NewProductionConfig()
+	cfg.Level = zap.NewAtomicLevelAt(lvl)
+
+	switch strings.ToLower(encoding) {
+	case "", "json":
+	case "console":
+		cfg.Encoding = "console"
+		cfg.EncoderConfig.EncodeLevel = zapcore.CapitalColorLevelEncoder
+		cfg.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	default:
+		return nil, fmt.Errorf("invalid log format %q: want json or console", encoding)
+	}
+
+	return cfg.Build()
+}
@@ -0,0 +1,19 @@
+package config
+
+import "time"
+
+type LoginRateLimitConfig struct {
+	// UsernameMaxAttempts is how many logins a single username may attempt
+	// within UsernameWindow, across all client IPs
+	UsernameMaxAttempts int
+	UsernameWindow      time.Duration
+}
+
+// LoadLoginRateLimitConfig reads LOGIN_USERNAME_MAX_ATTEMPTS (default 10)
+// and LOGIN_USERNAME_WINDOW (default 15m).
+func LoadLoginRateLimitConfig() LoginRateLimitConfig {
+	return LoginRateLimitConfig{
+		UsernameMaxAttempts: getInt("LOGIN_USERNAME_MAX_ATTEMPTS", 10),
+		UsernameWindow:      getDuration("LOGIN_USERNAME_WINDOW", 15*time.Minute),
+	}
+}
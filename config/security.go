@@ -0,0 +1,58 @@
+package config
+
+import (
+	"net/http"
+	"strings"
+)
+
+type SecurityHeadersConfig struct {
+	// HSTSEnabled should be false for plain-HTTP local development
+	HSTSEnabled  bool
+	FrameOptions string
+}
+
+// LoadSecurityHeadersConfig reads SECURITY_HSTS_ENABLED (default true) and
+// SECURITY_FRAME_OPTIONS (DENY or SAMEORIGIN, default DENY).
+func LoadSecurityHeadersConfig() SecurityHeadersConfig {
+	return SecurityHeadersConfig{
+		HSTSEnabled:  getBool("SECURITY_HSTS_ENABLED", true),
+		FrameOptions: getEnv("SECURITY_FRAME_OPTIONS", "DENY"),
+	}
+}
+
+// LoadPasswordHistorySize reads PASSWORD_HISTORY_SIZE, the number of recent
+// passwords (including the current one) that cannot be reused. Default 5.
+func LoadPasswordHistorySize() int {
+	return getInt("PASSWORD_HISTORY_SIZE", 5)
+}
+
+// LoadEmailCanonicalization reads EMAIL_CANONICALIZATION (default false).
+// When true, provider aliases such as user+tag@gmail.com are treated as the
+// same address when checking that emails are unique.
+func LoadEmailCanonicalization() bool {
+	return getBool("EMAIL_CANONICALIZATION", false)
+}
+
+type TokenCookieConfig struct {
+	Secure   bool
+	Domain   string
+	SameSite http.SameSite
+}
+
+// LoadTokenCookieConfig reads AUTH_COOKIE_SECURE (default true),
+// AUTH_COOKIE_DOMAIN (default host-only) and AUTH_COOKIE_SAMESITE (strict,
+// lax or none, default strict) for the login token cookie.
+func LoadTokenCookieConfig() TokenCookieConfig {
+	sameSite := http.SameSiteStrictMode
+	switch strings.ToLower(getEnv("AUTH_COOKIE_SAMESITE", "strict")) {
+	case "lax":
+		sameSite = http.SameSiteLaxMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+	return TokenCookieConfig{
+		Secure:   getBool("AUTH_COOKIE_SECURE", true),
+		Domain:   getEnv("AUTH_COOKIE_DOMAIN", ""),
+		SameSite: sameSite,
+	}
+}
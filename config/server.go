@@ -0,0 +1,115 @@
+package config
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type ServerConfig struct {
+	Port              string
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	// WriteTimeout must outlast the slowest handler (bulk import allows 60s)
+	WriteTimeout    time.Duration
+	IdleTimeout     time.Duration
+	ShutdownTimeout time.Duration
+	// TrustedProxies are the IPs or CIDRs whose X-Forwarded-For header is
+	// believed when resolving the client IP; empty trusts no proxy
+	TrustedProxies []string
+	// TLSCertFile and TLSKeyFile serve HTTPS directly when both are set;
+	// otherwise the server speaks plain HTTP behind a terminating proxy
+	TLSCertFile string
+	TLSKeyFile  string
+}
+
+// TLSEnabled reports whether the server should serve HTTPS itself
+func (c ServerConfig) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+// LoadServerConfig reads the listen port and HTTP timeouts. Durations use
+// Go syntax (e.g. "15s"); 0 means no timeout and invalid values fall back to
+// the default.
+func LoadServerConfig() ServerConfig {
+	return ServerConfig{
+		Port:              getEnv("PORT", "8080"),
+		ReadHeaderTimeout: getDuration("SERVER_READ_HEADER_TIMEOUT", 5*time.Second),
+		ReadTimeout:       getDuration("SERVER_READ_TIMEOUT", 15*time.Second),
+		WriteTimeout:      getDuration("SERVER_WRITE_TIMEOUT", 75*time.Second),
+		IdleTimeout:       getDuration("SERVER_IDLE_TIMEOUT", 120*time.Second),
+		ShutdownTimeout:   getDuration("SERVER_SHUTDOWN_TIMEOUT", 30*time.Second),
+		TrustedProxies:    loadTrustedProxies(),
+		TLSCertFile:       getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:        getEnv("TLS_KEY_FILE", ""),
+	}
+}
+
+// loadTrustedProxies reads the comma-separated TRUSTED_PROXIES list,
+// defaulting to loopback. "none" trusts no proxy, so the client IP is
+// always the address of the TCP peer.
+func loadTrustedProxies() []string {
+	value := getEnv("TRUSTED_PROXIES", "127.0.0.1,::1")
+	if strings.EqualFold(strings.TrimSpace(value), "none") {
+		return nil
+	}
+	return splitList(value)
+}
+
+// HandlerTimeoutConfig bounds how long a single handler may spend on the
+// database and other downstream calls
+type HandlerTimeoutConfig struct {
+	// Read covers lookups and token checks
+	Read time.Duration
+	// Write covers creates, updates, deletes and login
+	Write time.Duration
+	// Bulk covers the admin bulk import
+	Bulk time.Duration
+}
+
+// LoadHandlerTimeoutConfig reads HANDLER_READ_TIMEOUT, HANDLER_WRITE_TIMEOUT
+// and HANDLER_BULK_TIMEOUT. Raising the bulk timeout may also require a
+// longer SERVER_WRITE_TIMEOUT.
+func LoadHandlerTimeoutConfig() HandlerTimeoutConfig {
+	return HandlerTimeoutConfig{
+		Read:  getDuration("HANDLER_READ_TIMEOUT", 5*time.Second),
+		Write: getDuration("HANDLER_WRITE_TIMEOUT", 10*time.Second),
+		Bulk:  getDuration("HANDLER_BULK_TIMEOUT", 60*time.Second),
+	}
+}
+
+// NewServer builds an http.Server for handler with the configured timeouts.
+// With TLS enabled it also gets a TLS config limited to modern protocols.
+func NewServer(cfg ServerConfig, handler http.Handler) *http.Server {
+	srv := &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		ReadTimeout:       cfg.ReadTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+	if cfg.TLSEnabled() {
+		srv.TLSConfig = newTLSConfig()
+	}
+	return srv
+}
+
+// newTLSConfig requires TLS 1.2 or later and, for TLS 1.2, only forward
+// secret AEAD cipher suites. TLS 1.3 suites are not configurable and are
+// all considered secure.
+func newTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:       tls.VersionTLS12,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		},
+	}
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/JorgeSaicoski/login-go/internal/version"
+)
+
+type TracingConfig struct {
+	// OTLPEndpoint is the collector URL, e.g. http://otel-collector:4318.
+	// Tracing stays a no-op when it is empty.
+	OTLPEndpoint string
+	ServiceName  string
+}
+
+// LoadTracingConfig reads OTEL_EXPORTER_OTLP_ENDPOINT and OTEL_SERVICE_NAME
+// (default login-go).
+func LoadTracingConfig() TracingConfig {
+	return TracingConfig{
+		OTLPEndpoint: getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		ServiceName:  getEnv("OTEL_SERVICE_NAME", "login-go"),
+	}
+}
+
+// SetupTracing installs the global tracer provider exporting spans over
+// OTLP/HTTP and returns a function that flushes and stops it. Without an
+// endpoint nothing is installed and spans cost next to nothing.
+func SetupTracing(ctx context.Context, cfg TracingConfig) (func(context.Context) error, error) {
+	if cfg.OTLPEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.OTLPEndpoint))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", cfg.ServiceName),
+			attribute.String("service.version", version.Version),
+		)),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"time"
+)
+
+type WorkerConfig struct {
+	RenewalInterval time.Duration
+	RenewalWindow   time.Duration
+	ExpiryInterval  time.Duration
+	// NotifyInterval and NotifyWindow control how often expiry notices are
+	// sent and how far ahead of the end date
+	NotifyInterval time.Duration
+	NotifyWindow   time.Duration
+	// TokenCleanupInterval is how often expired revocations and refresh
+	// tokens are purged
+	TokenCleanupInterval time.Duration
+}
+
+// LoadWorkerConfig reads the background job intervals. Values use Go
+// duration syntax (e.g. "30m", "1h"); an interval of 0 disables the job and
+// invalid values fall back to the default.
+func LoadWorkerConfig() WorkerConfig {
+	return WorkerConfig{
+		RenewalInterval: getDuration("RENEWAL_INTERVAL", time.Hour),
+		RenewalWindow:   getDuration("RENEWAL_WINDOW", 24*time.Hour),
+		ExpiryInterval:  getDuration("EXPIRY_INTERVAL", 15*time.Minute),
+		NotifyInterval:  getDuration("EXPIRY_NOTIFY_INTERVAL", time.Hour),
+		NotifyWindow:    getDuration("EXPIRY_NOTIFY_WINDOW", 7*24*time.Hour),
+
+		TokenCleanupInterval: getDuration("TOKEN_CLEANUP_INTERVAL", time.Hour),
+	}
+}
+
+// LoadSubscriptionEvents reads SUBSCRIPTION_EVENTS_ENABLED (default false).
+// When true, subscription changes are streamed to clients over SSE.
+func LoadSubscriptionEvents() bool {
+	return getBool("SUBSCRIPTION_EVENTS_ENABLED", false)
+}
@@ -0,0 +1,151 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/JorgeSaicoski/login-go/internal/metrics"
+)
+
+// Subscription event types
+const (
+	SubscriptionCreated     = "subscription.created"
+	SubscriptionUpdated     = "subscription.updated"
+	SubscriptionPlanChanged = "subscription.plan_changed"
+	SubscriptionCancelled   = "subscription.cancelled"
+	SubscriptionRenewed     = "subscription.renewed"
+	SubscriptionExpired     = "subscription.expired"
+)
+
+// subscriberBuffer is how many events a slow subscriber may fall behind
+// before further events to it are dropped
+const subscriberBuffer = 16
+
+var (
+	eventsPublished = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "subscription_events_published_total",
+			Help: "Total number of subscription events published",
+		},
+		[]string{"type"},
+	)
+
+	eventsDropped = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "subscription_events_dropped_total",
+			Help: "Total number of subscription events dropped because a subscriber fell behind",
+		},
+	)
+
+	eventSubscribers = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "subscription_event_subscribers",
+			Help: "Number of open subscription event streams",
+		},
+	)
+)
+
+func init() {
+	metrics.Register(eventsPublished, eventsDropped, eventSubscribers)
+}
+
+// SubscriptionEvent reports a change to one of a user's subscriptions
+type SubscriptionEvent struct {
+	Type   string `json:"type"`
+	UserID uint   `json:"user_id"`
+	// UserSubscriptionID is the ID of the user subscription that changed
+	UserSubscriptionID uint      `json:"user_subscription_id"`
+	At                 time.Time `json:"at"`
+}
+
+type subscriber struct {
+	ch chan SubscriptionEvent
+}
+
+// Broker fans subscription events out to the subscribers of each user.
+// It only reaches subscribers in this process. A nil *Broker is valid and
+// discards everything, so publishers don't need to check whether events
+// are enabled.
+type Broker struct {
+	mu          sync.RWMutex
+	subscribers map[uint]map[*subscriber]struct{}
+	closed      bool
+}
+
+func NewBroker() *Broker {
+	return &Broker{subscribers: make(map[uint]map[*subscriber]struct{})}
+}
+
+// Publish delivers event to every subscriber of event.UserID without
+// blocking; subscribers whose buffer is full miss the event.
+func (b *Broker) Publish(event SubscriptionEvent) {
+	if b == nil {
+		return
+	}
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+	eventsPublished.WithLabelValues(event.Type).Inc()
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for sub := range b.subscribers[event.UserID] {
+		select {
+		case sub.ch <- event:
+		default:
+			eventsDropped.Inc()
+		}
+	}
+}
+
+// Subscribe returns a channel of the user's events and a function that
+// unsubscribes and closes the channel. The function must be called once
+// the caller stops reading.
+func (b *Broker) Subscribe(userID uint) (<-chan SubscriptionEvent, func()) {
+	sub := &subscriber{ch: make(chan SubscriptionEvent, subscriberBuffer)}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		close(sub.ch)
+		return sub.ch, func() {}
+	}
+	if b.subscribers[userID] == nil {
+		b.subscribers[userID] = make(map[*subscriber]struct{})
+	}
+	b.subscribers[userID][sub] = struct{}{}
+	eventSubscribers.Inc()
+
+	return sub.ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		// Close may already have removed and closed it
+		if _, ok := b.subscribers[userID][sub]; !ok {
+			return
+		}
+		delete(b.subscribers[userID], sub)
+		if len(b.subscribers[userID]) == 0 {
+			delete(b.subscribers, userID)
+		}
+		close(sub.ch)
+		eventSubscribers.Dec()
+	}
+}
+
+// Close closes every subscriber's channel so open streams end, e.g. before
+// a graceful shutdown that would otherwise wait for them. Later
+// subscriptions get an already closed channel.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	for userID, subs := range b.subscribers {
+		for sub := range subs {
+			close(sub.ch)
+			eventSubscribers.Dec()
+		}
+		delete(b.subscribers, userID)
+	}
+}
@@ -2,7 +2,9 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,6 +14,8 @@ import (
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
 
+	"github.com/JorgeSaicoski/login-go/internal/metrics"
+	"github.com/JorgeSaicoski/login-go/internal/models"
 	"github.com/JorgeSaicoski/login-go/internal/repository"
 	"github.com/JorgeSaicoski/login-go/internal/services"
 )
@@ -35,32 +39,84 @@ var (
 )
 
 func init() {
-	prometheus.MustRegister(authHandlerOperations, authHandlerDuration)
+	metrics.Register(authHandlerOperations, authHandlerDuration)
 }
 
 type AuthHandler struct {
-	authService *services.AuthService
-	userRepo    *repository.UserRepository
-	logger      *zap.Logger
-	validator   *validator.Validate
-	rateLimiter *rate.Limiter
+	authService  *services.AuthService
+	verification *services.EmailVerificationService
+	userRepo     *repository.UserRepository
+	subRepo      *repository.UserSubscriptionRepository
+	logger       *zap.Logger
+	validator    *validator.Validate
+	rateLimiter  *IPRateLimiter
+	// loginLimiter caps login attempts per username regardless of source IP
+	loginLimiter *SlidingWindowLimiter
+	tokenCookie  TokenCookieOptions
+	timeouts     Timeouts
 }
 
+// LoginRequest takes either an identifier (username or email) or the
+// older username field; identifier wins when both are sent.
 type LoginRequest struct {
-	Username string `json:"username" validate:"required,min=3,max=50"`
-	Password string `json:"password" validate:"required,min=8"`
+	Identifier string `json:"identifier" validate:"required_without=Username,omitempty,min=3,max=254"`
+	Username   string `json:"username" validate:"required_without=Identifier,omitempty,min=3,max=50"`
+	Password   string `json:"password" validate:"required,min=8"`
+	RememberMe bool   `json:"remember_me"`
 }
 
-func NewAuthHandler(authService *services.AuthService, userRepo *repository.UserRepository, logger *zap.Logger) *AuthHandler {
+// ExpiredPasswordRequest changes an expired password with the account's
+// credentials, for users that strict expiry keeps from logging in
+type ExpiredPasswordRequest struct {
+	Identifier  string `json:"identifier" validate:"required,min=3,max=254"`
+	Password    string `json:"password" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,max=100,strongpassword"`
+}
+
+type IntrospectRequest struct {
+	Token string `json:"token" form:"token"`
+}
+
+// IntrospectionResponse follows RFC 7662; only Active is set for tokens
+// that are not currently valid.
+type IntrospectionResponse struct {
+	Active   bool     `json:"active"`
+	Sub      string   `json:"sub,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Exp      int64    `json:"exp,omitempty"`
+	Iat      int64    `json:"iat,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" validate:"required"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+func NewAuthHandler(authService *services.AuthService, verification *services.EmailVerificationService, userRepo *repository.UserRepository, subRepo *repository.UserSubscriptionRepository, loginLimiter *SlidingWindowLimiter, logger *zap.Logger, validate *validator.Validate, limit rate.Limit, burst int, timeouts Timeouts) *AuthHandler {
 	return &AuthHandler{
-		authService: authService,
-		userRepo:    userRepo,
-		logger:      logger,
-		validator:   validator.New(),
-		rateLimiter: rate.NewLimiter(rate.Every(time.Second), 10), // 10 login attempts per second
+		authService:  authService,
+		verification: verification,
+		userRepo:     userRepo,
+		subRepo:      subRepo,
+		logger:       logger,
+		validator:    validatorOrDefault(validate),
+		rateLimiter:  NewIPRateLimiter(limit, burst, defaultLimiterTTL),
+		loginLimiter: loginLimiter,
+		tokenCookie:  DefaultTokenCookieOptions(),
+		timeouts:     timeouts.withDefaults(),
 	}
 }
 
+// Login issues an access and refresh token. With ?cookie=true the access
+// token is also set as an HttpOnly cookie for browser clients.
 func (h *AuthHandler) Login(c *gin.Context) {
 	start := time.Now()
 	defer func() {
@@ -68,55 +124,327 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}()
 
 	// Rate limiting
-	if !h.rateLimiter.Allow() {
+	if !allowRequest(c, h.rateLimiter) {
 		authHandlerOperations.WithLabelValues("login", "rate_limited").Inc()
-		c.JSON(http.StatusTooManyRequests, gin.H{"error": "too many login attempts"})
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "too many login attempts"})
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(withClientInfo(c, c.Request.Context()), h.timeouts.Write)
 	defer cancel()
 
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		authHandlerOperations.WithLabelValues("login", "failed").Inc()
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format"})
+		respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "invalid request format"})
 		return
 	}
 
 	if err := h.validator.Struct(req); err != nil {
 		authHandlerOperations.WithLabelValues("login", "failed").Inc()
-		c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "details": err.Error()})
+		respondError(c, validationError(err))
 		return
 	}
 
 	// Sanitize inputs
-	req.Username = strings.TrimSpace(req.Username)
+	identifier := strings.TrimSpace(req.Identifier)
+	if identifier == "" {
+		identifier = strings.TrimSpace(req.Username)
+	}
 	req.Password = strings.TrimSpace(req.Password)
 
-	user, token, err := h.authService.Login(ctx, req.Username, req.Password)
+	if err := h.authService.CheckLoginIdentifier(identifier); err != nil {
+		authHandlerOperations.WithLabelValues("login", "failed").Inc()
+		respondError(c, identifierNotAllowed(h.authService.LoginIdentifier()))
+		return
+	}
+
+	limiterKey := models.NormalizeIdentifier(identifier)
+	if h.loginLimiter != nil && !h.loginLimiter.Allow(limiterKey) {
+		requestLogger(c, h.logger).Warn("login rate limited for identifier",
+			zap.String("identifier", identifier),
+		)
+		setRetryAfter(c, h.loginLimiter.RetryAfter(limiterKey))
+		authHandlerOperations.WithLabelValues("login", "rate_limited").Inc()
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "too many login attempts"})
+		return
+	}
+
+	result, err := h.authService.Login(ctx, identifier, req.Password, req.RememberMe)
 	if err != nil {
-		h.logger.Warn("login failed",
-			zap.String("username", req.Username),
+		requestLogger(c, h.logger).Warn("login failed",
+			zap.String("identifier", identifier),
 			zap.Error(err),
 		)
+		if errors.Is(err, services.ErrAccountLocked) {
+			authHandlerOperations.WithLabelValues("login", "locked").Inc()
+			respondError(c, &AppError{Status: http.StatusLocked, Code: CodeAccountLocked, Message: "account temporarily locked"})
+			return
+		}
+		if errors.Is(err, services.ErrAccountSuspended) {
+			authHandlerOperations.WithLabelValues("login", "suspended").Inc()
+			respondError(c, &AppError{Status: http.StatusForbidden, Code: CodeAccountSuspended, Message: "account suspended"})
+			return
+		}
+		if errors.Is(err, services.ErrEmailNotVerified) {
+			authHandlerOperations.WithLabelValues("login", "unverified").Inc()
+			respondError(c, &AppError{Status: http.StatusForbidden, Code: CodeEmailNotVerified, Message: "email address not verified"})
+			return
+		}
+		if errors.Is(err, services.ErrIdentifierNotAllowed) {
+			authHandlerOperations.WithLabelValues("login", "failed").Inc()
+			respondError(c, identifierNotAllowed(h.authService.LoginIdentifier()))
+			return
+		}
+		if errors.Is(err, services.ErrPasswordExpired) {
+			authHandlerOperations.WithLabelValues("login", "password_expired").Inc()
+			respondError(c, &AppError{Status: http.StatusForbidden, Code: CodePasswordExpired, Message: "password expired"})
+			return
+		}
 		authHandlerOperations.WithLabelValues("login", "failed").Inc()
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid credentials"})
+		respondError(c, &AppError{Status: http.StatusUnauthorized, Code: CodeInvalidCredentials, Message: "invalid credentials"})
 		return
 	}
 
-	// Don't return password in response
-	user.Password = ""
+	user := result.User
+	refreshToken, err := h.authService.GenerateRefreshToken(ctx, user, services.WithSessionID(result.SessionID))
+	if err != nil {
+		logFailure(c, h.logger, err, "failed to generate refresh token",
+			zap.Uint("user_id", user.ID),
+		)
+		authHandlerOperations.WithLabelValues("login", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to generate token", Err: err})
+		return
+	}
 
-	h.logger.Info("successful login",
+	if h.loginLimiter != nil {
+		h.loginLimiter.Reset(limiterKey)
+	}
+
+	if c.Query("cookie") == "true" {
+		h.setTokenCookie(c, result.Token, time.Until(result.ExpiresAt))
+	}
+
+	requestLogger(c, h.logger).Info("successful login",
 		zap.String("username", user.UsernameForLogin),
 		zap.Uint("user_id", user.ID),
 	)
 
+	resp := gin.H{
+		"token":         result.Token,
+		"expires_at":    result.ExpiresAt.UTC().Format(time.RFC3339),
+		"expires_in":    int64(time.Until(result.ExpiresAt).Seconds()),
+		"refresh_token": refreshToken,
+		"user":          newUserResponse(user),
+	}
+	if result.PasswordExpiresAt != nil {
+		resp["password_expired"] = result.PasswordExpired
+		resp["password_expires_at"] = result.PasswordExpiresAt.UTC().Format(time.RFC3339)
+	}
+
+	// Saves the client a round trip; login still succeeds without them
+	subscriptions, err := h.subRepo.GetActiveByUserIDWithContext(ctx, user.ID)
+	if err != nil {
+		requestLogger(c, h.logger).Warn("login: failed to load active subscriptions",
+			zap.Uint("user_id", user.ID),
+			zap.Error(err),
+		)
+	} else {
+		resp["subscriptions"] = newUserSubscriptionResponses(subscriptions)
+	}
+
 	authHandlerOperations.WithLabelValues("login", "success").Inc()
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		authHandlerDuration.WithLabelValues("refresh").Observe(time.Since(start).Seconds())
+	}()
+
+	if !allowRequest(c, h.rateLimiter) {
+		authHandlerOperations.WithLabelValues("refresh", "rate_limited").Inc()
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "too many requests"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Read)
+	defer cancel()
+
+	var req RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		authHandlerOperations.WithLabelValues("refresh", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "invalid request format"})
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		authHandlerOperations.WithLabelValues("refresh", "failed").Inc()
+		respondError(c, validationError(err))
+		return
+	}
+
+	token, err := h.authService.RefreshAccessToken(ctx, strings.TrimSpace(req.RefreshToken))
+	if err != nil {
+		requestLogger(c, h.logger).Warn("token refresh failed",
+			zap.Error(err),
+		)
+		authHandlerOperations.WithLabelValues("refresh", "failed").Inc()
+		switch {
+		case errors.Is(err, services.ErrTokenExpired):
+			respondError(c, &AppError{Status: http.StatusUnauthorized, Code: CodeTokenExpired, Message: "refresh token expired"})
+		case errors.Is(err, services.ErrInvalidTokenType):
+			respondError(c, &AppError{Status: http.StatusUnauthorized, Code: CodeInvalidToken, Message: "token is not a refresh token"})
+		case errors.Is(err, services.ErrTokenRevoked):
+			respondError(c, &AppError{Status: http.StatusUnauthorized, Code: CodeTokenRevoked, Message: "refresh token revoked"})
+		case errors.Is(err, services.ErrAccountSuspended):
+			respondError(c, &AppError{Status: http.StatusForbidden, Code: CodeAccountSuspended, Message: "account suspended"})
+		case errors.Is(err, services.ErrInvalidToken):
+			respondError(c, &AppError{Status: http.StatusUnauthorized, Code: CodeInvalidToken, Message: "invalid refresh token"})
+		default:
+			respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to refresh token", Err: err})
+		}
+		return
+	}
+
+	authHandlerOperations.WithLabelValues("refresh", "success").Inc()
+	c.JSON(http.StatusOK, gin.H{"token": token})
+}
+
+// Renew exchanges the caller's access token for a fresh one while its login
+// is recent enough, so clients without refresh tokens can stay signed in
+func (h *AuthHandler) Renew(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		authHandlerDuration.WithLabelValues("renew").Observe(time.Since(start).Seconds())
+	}()
+
+	if !allowRequest(c, h.rateLimiter) {
+		authHandlerOperations.WithLabelValues("renew", "rate_limited").Inc()
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "too many requests"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Read)
+	defer cancel()
+
+	token, expiresAt, err := h.authService.RenewAccessToken(ctx, h.requestToken(c))
+	if err != nil {
+		requestLogger(c, h.logger).Warn("token renewal failed",
+			zap.Error(err),
+		)
+		switch {
+		case errors.Is(err, services.ErrRenewalExpired):
+			authHandlerOperations.WithLabelValues("renew", "too_old").Inc()
+			respondError(c, &AppError{Status: http.StatusUnauthorized, Code: CodeRenewalExpired, Message: "token too old to renew, log in again"})
+		case errors.Is(err, services.ErrAccountSuspended):
+			authHandlerOperations.WithLabelValues("renew", "suspended").Inc()
+			respondError(c, &AppError{Status: http.StatusForbidden, Code: CodeAccountSuspended, Message: "account suspended"})
+		case errors.Is(err, services.ErrInvalidToken), errors.Is(err, services.ErrTokenExpired),
+			errors.Is(err, services.ErrTokenRevoked), errors.Is(err, services.ErrInvalidTokenType):
+			authHandlerOperations.WithLabelValues("renew", "failed").Inc()
+			respondError(c, tokenError(err))
+		default:
+			authHandlerOperations.WithLabelValues("renew", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to renew token", Err: err})
+		}
+		return
+	}
+
+	// Keep the browser cookie in step when that is how the token was sent
+	if _, err := c.Cookie(h.tokenCookie.Name); err == nil && c.GetHeader("Authorization") == "" {
+		h.setTokenCookie(c, token, time.Until(expiresAt))
+	}
+
+	authHandlerOperations.WithLabelValues("renew", "success").Inc()
+	c.JSON(http.StatusOK, gin.H{
+		"token":      token,
+		"expires_at": expiresAt.UTC().Format(time.RFC3339),
+		"expires_in": int64(time.Until(expiresAt).Seconds()),
+	})
+}
+
+func (h *AuthHandler) Logout(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		authHandlerDuration.WithLabelValues("logout").Observe(time.Since(start).Seconds())
+	}()
+
+	ctx, cancel := context.WithTimeout(withClientInfo(c, c.Request.Context()), h.timeouts.Read)
+	defer cancel()
+
+	token := h.requestToken(c)
+	if token == "" {
+		authHandlerOperations.WithLabelValues("logout", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusUnauthorized, Code: CodeTokenMissing, Message: "no token provided"})
+		return
+	}
+
+	// The refresh token is optional; an empty body only revokes the access token
+	var req LogoutRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			authHandlerOperations.WithLabelValues("logout", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "invalid request format"})
+			return
+		}
+	}
+
+	if err := h.authService.Logout(ctx, token, strings.TrimSpace(req.RefreshToken)); err != nil {
+		requestLogger(c, h.logger).Warn("logout failed",
+			zap.Error(err),
+		)
+		authHandlerOperations.WithLabelValues("logout", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusUnauthorized, Code: CodeInvalidToken, Message: "invalid token"})
+		return
+	}
+
+	h.clearTokenCookie(c)
+
+	authHandlerOperations.WithLabelValues("logout", "success").Inc()
+	c.JSON(http.StatusOK, gin.H{"message": "logged out"})
+}
+
+// LogoutAll revokes every refresh token of the authenticated user, signing
+// them out of all sessions once their access tokens expire.
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		authHandlerDuration.WithLabelValues("logout_all").Observe(time.Since(start).Seconds())
+	}()
+
+	ctx, cancel := context.WithTimeout(withClientInfo(c, c.Request.Context()), h.timeouts.Write)
+	defer cancel()
+
+	token := h.requestToken(c)
+	if token == "" {
+		authHandlerOperations.WithLabelValues("logout_all", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusUnauthorized, Code: CodeTokenMissing, Message: "no token provided"})
+		return
+	}
+
+	revoked, err := h.authService.LogoutAll(ctx, token)
+	if err != nil {
+		requestLogger(c, h.logger).Warn("logout all failed",
+			zap.Error(err),
+		)
+		if errors.Is(err, repository.ErrDatabaseOperation) {
+			authHandlerOperations.WithLabelValues("logout_all", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to revoke sessions", Err: err})
+			return
+		}
+		authHandlerOperations.WithLabelValues("logout_all", "unauthorized").Inc()
+		respondError(c, &AppError{Status: http.StatusUnauthorized, Code: CodeInvalidToken, Message: "invalid token"})
+		return
+	}
+
+	h.clearTokenCookie(c)
+
+	authHandlerOperations.WithLabelValues("logout_all", "success").Inc()
 	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user":  user,
+		"message": "logged out of all sessions",
+		"revoked": revoked,
 	})
 }
 
@@ -126,26 +454,23 @@ func (h *AuthHandler) ValidateToken(c *gin.Context) {
 		authHandlerDuration.WithLabelValues("validate_token").Observe(time.Since(start).Seconds())
 	}()
 
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Read)
 	defer cancel()
 
-	token := c.GetHeader("Authorization")
+	token := h.requestToken(c)
 	if token == "" {
 		authHandlerOperations.WithLabelValues("validate_token", "failed").Inc()
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "no token provided"})
+		respondError(c, &AppError{Status: http.StatusUnauthorized, Code: CodeTokenMissing, Message: "no token provided"})
 		return
 	}
 
-	// Remove 'Bearer ' prefix if present
-	token = strings.TrimPrefix(token, "Bearer ")
-
 	claims, err := h.authService.ValidateToken(ctx, token)
 	if err != nil {
-		h.logger.Warn("token validation failed",
+		requestLogger(c, h.logger).Warn("token validation failed",
 			zap.Error(err),
 		)
 		authHandlerOperations.WithLabelValues("validate_token", "failed").Inc()
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		respondError(c, tokenError(err))
 		return
 	}
 
@@ -153,6 +478,233 @@ func (h *AuthHandler) ValidateToken(c *gin.Context) {
 	c.JSON(http.StatusOK, claims)
 }
 
+// Introspect reports whether a token is active in the RFC 7662 format. Invalid,
+// expired and revoked tokens get 200 with active=false, not an error.
+func (h *AuthHandler) Introspect(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		authHandlerDuration.WithLabelValues("introspect").Observe(time.Since(start).Seconds())
+	}()
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Read)
+	defer cancel()
+
+	// The token may come as a form field (per the RFC), a JSON body, or
+	// the Authorization header
+	var req IntrospectRequest
+	_ = c.ShouldBind(&req)
+	token := strings.TrimSpace(req.Token)
+	if token == "" {
+		token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	if token == "" {
+		authHandlerOperations.WithLabelValues("introspect", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeTokenMissing, Message: "no token provided"})
+		return
+	}
+
+	claims, err := h.authService.ValidateToken(ctx, token)
+	if err != nil {
+		requestLogger(c, h.logger).Debug("introspected inactive token",
+			zap.Error(err),
+		)
+		authHandlerOperations.WithLabelValues("introspect", "inactive").Inc()
+		c.JSON(http.StatusOK, IntrospectionResponse{Active: false})
+		return
+	}
+
+	resp := IntrospectionResponse{
+		Active:   true,
+		Sub:      claims.Subject,
+		Username: claims.Username,
+		Roles:    claims.Roles,
+	}
+	if claims.ExpiresAt != nil {
+		resp.Exp = claims.ExpiresAt.Unix()
+	}
+	if claims.IssuedAt != nil {
+		resp.Iat = claims.IssuedAt.Unix()
+	}
+
+	authHandlerOperations.WithLabelValues("introspect", "active").Inc()
+	c.JSON(http.StatusOK, resp)
+}
+
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		authHandlerDuration.WithLabelValues("verify_email").Observe(time.Since(start).Seconds())
+	}()
+
+	if !allowRequest(c, h.rateLimiter) {
+		authHandlerOperations.WithLabelValues("verify_email", "rate_limited").Inc()
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "too many requests"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Write)
+	defer cancel()
+
+	token := strings.TrimSpace(c.Query("token"))
+	if token == "" {
+		authHandlerOperations.WithLabelValues("verify_email", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeTokenMissing, Message: "token is required"})
+		return
+	}
+
+	user, err := h.verification.Verify(ctx, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrVerificationTokenExpired):
+			authHandlerOperations.WithLabelValues("verify_email", "expired").Inc()
+			respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeTokenExpired, Message: "verification token expired"})
+		case errors.Is(err, services.ErrVerificationTokenInvalid):
+			authHandlerOperations.WithLabelValues("verify_email", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeInvalidToken, Message: "invalid verification token"})
+		default:
+			logFailure(c, h.logger, err, "failed to verify email")
+			authHandlerOperations.WithLabelValues("verify_email", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to verify email", Err: err})
+		}
+		return
+	}
+
+	authHandlerOperations.WithLabelValues("verify_email", "success").Inc()
+	c.JSON(http.StatusOK, gin.H{
+		"message": "email verified",
+		"user_id": user.ID,
+	})
+}
+
+// ConfirmEmail completes an email change requested through the user update
+// endpoint, using the token sent to the new address
+func (h *AuthHandler) ConfirmEmail(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		authHandlerDuration.WithLabelValues("confirm_email").Observe(time.Since(start).Seconds())
+	}()
+
+	if !allowRequest(c, h.rateLimiter) {
+		authHandlerOperations.WithLabelValues("confirm_email", "rate_limited").Inc()
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "too many requests"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Write)
+	defer cancel()
+
+	token := strings.TrimSpace(c.Query("token"))
+	if token == "" {
+		authHandlerOperations.WithLabelValues("confirm_email", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeTokenMissing, Message: "token is required"})
+		return
+	}
+
+	user, err := h.verification.ConfirmEmailChange(ctx, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrVerificationTokenExpired):
+			authHandlerOperations.WithLabelValues("confirm_email", "expired").Inc()
+			respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeTokenExpired, Message: "confirmation token expired"})
+		case errors.Is(err, services.ErrVerificationTokenInvalid):
+			authHandlerOperations.WithLabelValues("confirm_email", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeInvalidToken, Message: "invalid confirmation token"})
+		case errors.Is(err, services.ErrEmailTaken):
+			authHandlerOperations.WithLabelValues("confirm_email", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusConflict, Code: CodeEmailTaken, Message: "email already in use"})
+		default:
+			logFailure(c, h.logger, err, "failed to confirm email change")
+			authHandlerOperations.WithLabelValues("confirm_email", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to confirm email", Err: err})
+		}
+		return
+	}
+
+	authHandlerOperations.WithLabelValues("confirm_email", "success").Inc()
+	c.JSON(http.StatusOK, gin.H{
+		"message": "email changed",
+		"user_id": user.ID,
+		"email":   user.Email,
+	})
+}
+
+// ResendVerification always answers the same way so it can't be used to
+// discover which emails are registered
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		authHandlerDuration.WithLabelValues("resend_verification").Observe(time.Since(start).Seconds())
+	}()
+
+	if !allowRequest(c, h.rateLimiter) {
+		authHandlerOperations.WithLabelValues("resend_verification", "rate_limited").Inc()
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "too many requests"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Write)
+	defer cancel()
+
+	var req ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		authHandlerOperations.WithLabelValues("resend_verification", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "invalid request format"})
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		authHandlerOperations.WithLabelValues("resend_verification", "failed").Inc()
+		respondError(c, validationError(err))
+		return
+	}
+
+	email := strings.TrimSpace(strings.ToLower(req.Email))
+	if err := h.verification.Resend(ctx, email); err != nil {
+		requestLogger(c, h.logger).Warn("verification resend not sent",
+			zap.Error(err),
+		)
+	}
+
+	authHandlerOperations.WithLabelValues("resend_verification", "success").Inc()
+	c.JSON(http.StatusAccepted, gin.H{"message": "if the address is registered and unverified, a verification email has been sent"})
+}
+
+// Me returns the user behind the token validated by AuthMiddleware
+func (h *AuthHandler) Me(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		authHandlerDuration.WithLabelValues("me").Observe(time.Since(start).Seconds())
+	}()
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Read)
+	defer cancel()
+
+	userID, exists := GetAuthenticatedUserID(c)
+	if !exists {
+		authHandlerOperations.WithLabelValues("me", "unauthorized").Inc()
+		respondError(c, &AppError{Status: http.StatusUnauthorized, Message: "not authenticated"})
+		return
+	}
+
+	user, err := h.userRepo.GetByIDWithContext(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			authHandlerOperations.WithLabelValues("me", "not_found").Inc()
+			respondError(c, &AppError{Status: http.StatusNotFound, Message: "user not found"})
+			return
+		}
+		logFailure(c, h.logger, err, "failed to get current user",
+			zap.Uint("user_id", userID),
+		)
+		authHandlerOperations.WithLabelValues("me", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to get user", Err: err})
+		return
+	}
+
+	authHandlerOperations.WithLabelValues("me", "success").Inc()
+	respondWithETag(c, newUserResponse(user), user.UpdatedAt)
+}
+
 // Middleware for protected routes
 func (h *AuthHandler) AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -161,38 +713,177 @@ func (h *AuthHandler) AuthMiddleware() gin.HandlerFunc {
 			authHandlerDuration.WithLabelValues("middleware").Observe(time.Since(start).Seconds())
 		}()
 
-		token := c.GetHeader("Authorization")
+		// Browser clients send the token cookie instead of the header
+		token := h.requestToken(c)
 		if token == "" {
 			authHandlerOperations.WithLabelValues("middleware", "failed").Inc()
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "no token provided"})
+			AbortWithError(c, &AppError{Status: http.StatusUnauthorized, Code: CodeTokenMissing, Message: "no token provided"})
 			return
 		}
 
-		// Remove 'Bearer ' prefix if present
-		token = strings.TrimPrefix(token, "Bearer ")
-
-		ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Read)
 		defer cancel()
 
 		claims, err := h.authService.ValidateToken(ctx, token)
 		if err != nil {
-			h.logger.Warn("auth middleware: token validation failed",
+			requestLogger(c, h.logger).Warn("auth middleware: token validation failed",
 				zap.Error(err),
 			)
 			authHandlerOperations.WithLabelValues("middleware", "failed").Inc()
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+			// The session lookup can fail without the token being at fault
+			if errors.Is(err, repository.ErrDatabaseOperation) || errors.Is(err, repository.ErrRequestCancelled) {
+				AbortWithError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to verify token", Err: err})
+				return
+			}
+			AbortWithError(c, tokenError(err))
+			return
+		}
+
+		if err := h.authService.EnsureActive(ctx, claims.UserID); err != nil {
+			requestLogger(c, h.logger).Warn("auth middleware: user not active",
+				zap.Uint("user_id", claims.UserID),
+				zap.Error(err),
+			)
+			switch {
+			case errors.Is(err, services.ErrAccountSuspended):
+				authHandlerOperations.WithLabelValues("middleware", "suspended").Inc()
+				AbortWithError(c, &AppError{Status: http.StatusForbidden, Code: CodeAccountSuspended, Message: "account suspended"})
+			case errors.Is(err, services.ErrInvalidToken):
+				authHandlerOperations.WithLabelValues("middleware", "failed").Inc()
+				AbortWithError(c, &AppError{Status: http.StatusUnauthorized, Code: CodeInvalidToken, Message: "invalid token"})
+			default:
+				authHandlerOperations.WithLabelValues("middleware", "failed").Inc()
+				AbortWithError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to verify account", Err: err})
+			}
 			return
 		}
 
 		// Set user info in context for use in subsequent handlers
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
+		c.Set("roles", claims.Roles)
+		c.Set("session_id", claims.SessionID)
 
 		authHandlerOperations.WithLabelValues("middleware", "success").Inc()
 		c.Next()
 	}
 }
 
+// tokenError returns a 401 with a machine-readable code for a rejected
+// access token. token_expired means the client should refresh; the other
+// codes mean it has to log in again or fix its configuration.
+func tokenError(err error) *AppError {
+	code, message := CodeInvalidToken, "invalid token"
+	switch {
+	case errors.Is(err, services.ErrTokenExpired):
+		code, message = CodeTokenExpired, "token expired"
+	case errors.Is(err, services.ErrTokenNotYetValid):
+		code, message = CodeTokenNotYetValid, "token not yet valid"
+	case errors.Is(err, services.ErrTokenMalformed):
+		code, message = CodeTokenMalformed, "malformed token"
+	case errors.Is(err, services.ErrTokenRevoked):
+		code, message = CodeTokenRevoked, "token revoked"
+	case errors.Is(err, services.ErrInvalidIssuer):
+		code, message = CodeInvalidIssuer, "token issuer not accepted"
+	case errors.Is(err, services.ErrInvalidAudience):
+		code, message = CodeInvalidAudience, "token audience not accepted"
+	}
+	return &AppError{Status: http.StatusUnauthorized, Code: code, Message: message}
+}
+
+// RequireRole only lets requests through when the token validated by
+// AuthMiddleware carries at least one of roles. It must run after AuthMiddleware.
+func (h *AuthHandler) RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userRoles, exists := GetAuthenticatedRoles(c)
+		if !exists {
+			authHandlerOperations.WithLabelValues("require_role", "unauthorized").Inc()
+			AbortWithError(c, &AppError{Status: http.StatusUnauthorized, Message: "not authenticated"})
+			return
+		}
+
+		for _, required := range roles {
+			for _, role := range userRoles {
+				if role == required {
+					authHandlerOperations.WithLabelValues("require_role", "success").Inc()
+					c.Next()
+					return
+				}
+			}
+		}
+
+		userID, _ := GetAuthenticatedUserID(c)
+		requestLogger(c, h.logger).Warn("access denied: missing role",
+			zap.Uint("user_id", userID),
+			zap.Strings("required", roles),
+		)
+		authHandlerOperations.WithLabelValues("require_role", "forbidden").Inc()
+		AbortWithError(c, &AppError{Status: http.StatusForbidden, Message: "insufficient permissions"})
+	}
+}
+
+// RequireSelfOrAdmin only lets requests through when the user ID in the
+// path parameter param is the authenticated user, or the caller is an
+// admin. It must run after AuthMiddleware.
+func (h *AuthHandler) RequireSelfOrAdmin(param string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authUserID, exists := GetAuthenticatedUserID(c)
+		if !exists {
+			authHandlerOperations.WithLabelValues("require_self", "unauthorized").Inc()
+			AbortWithError(c, &AppError{Status: http.StatusUnauthorized, Message: "not authenticated"})
+			return
+		}
+
+		pathUserID, err := strconv.ParseUint(c.Param(param), 10, 32)
+		if err != nil {
+			authHandlerOperations.WithLabelValues("require_self", "failed").Inc()
+			AbortWithError(c, &AppError{Status: http.StatusBadRequest, Message: "invalid user ID"})
+			return
+		}
+
+		if uint(pathUserID) == authUserID || hasRole(c, models.RoleAdmin) {
+			authHandlerOperations.WithLabelValues("require_self", "success").Inc()
+			c.Next()
+			return
+		}
+
+		requestLogger(c, h.logger).Warn("access denied: not the path user",
+			zap.Uint("user_id", authUserID),
+			zap.Uint64("path_user_id", pathUserID),
+		)
+		authHandlerOperations.WithLabelValues("require_self", "forbidden").Inc()
+		AbortWithError(c, &AppError{Status: http.StatusForbidden, Message: "unauthorized access"})
+	}
+}
+
+func hasRole(c *gin.Context, role string) bool {
+	roles, _ := GetAuthenticatedRoles(c)
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// identifierNotAllowed tells the client which identifier the login policy
+// expects
+func identifierNotAllowed(policy services.LoginIdentifier) *AppError {
+	message := "log in with your username or email"
+	switch policy {
+	case services.LoginIdentifierUsername:
+		message = "log in with your username"
+	case services.LoginIdentifierEmail:
+		message = "log in with your email address"
+	}
+	return &AppError{
+		Status:  http.StatusBadRequest,
+		Code:    CodeIdentifierNotAllowed,
+		Message: message,
+		Details: map[string]interface{}{"allowed": policy},
+	}
+}
+
 // Helper method to get authenticated user ID from context
 func GetAuthenticatedUserID(c *gin.Context) (uint, bool) {
 	userID, exists := c.Get("user_id")
@@ -201,3 +892,95 @@ func GetAuthenticatedUserID(c *gin.Context) (uint, bool) {
 	}
 	return userID.(uint), true
 }
+
+// Helper method to get authenticated user roles from context
+func GetAuthenticatedRoles(c *gin.Context) ([]string, bool) {
+	roles, exists := c.Get("roles")
+	if !exists {
+		return nil, false
+	}
+	return roles.([]string), true
+}
+
+// ChangeExpiredPassword lets a user whose password expired set a new one
+// with their current credentials, since with strict expiry they can't get
+// the token POST /user/:id/password requires. It is throttled like login.
+func (h *AuthHandler) ChangeExpiredPassword(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		authHandlerDuration.WithLabelValues("change_expired_password").Observe(time.Since(start).Seconds())
+	}()
+
+	if !allowRequest(c, h.rateLimiter) {
+		authHandlerOperations.WithLabelValues("change_expired_password", "rate_limited").Inc()
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "too many requests"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(withClientInfo(c, c.Request.Context()), h.timeouts.Write)
+	defer cancel()
+
+	var req ExpiredPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		authHandlerOperations.WithLabelValues("change_expired_password", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "invalid request format"})
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		authHandlerOperations.WithLabelValues("change_expired_password", "failed").Inc()
+		respondError(c, validationError(err))
+		return
+	}
+
+	identifier := strings.TrimSpace(req.Identifier)
+	limiterKey := models.NormalizeIdentifier(identifier)
+	if h.loginLimiter != nil && !h.loginLimiter.Allow(limiterKey) {
+		setRetryAfter(c, h.loginLimiter.RetryAfter(limiterKey))
+		authHandlerOperations.WithLabelValues("change_expired_password", "rate_limited").Inc()
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "too many login attempts"})
+		return
+	}
+
+	err := h.authService.ChangeExpiredPassword(ctx, identifier, req.Password, req.NewPassword)
+	if err != nil {
+		requestLogger(c, h.logger).Warn("expired password change failed",
+			zap.String("identifier", identifier),
+			zap.Error(err),
+		)
+		switch {
+		case errors.Is(err, services.ErrIdentifierNotAllowed):
+			authHandlerOperations.WithLabelValues("change_expired_password", "failed").Inc()
+			respondError(c, identifierNotAllowed(h.authService.LoginIdentifier()))
+		case errors.Is(err, services.ErrAccountLocked):
+			authHandlerOperations.WithLabelValues("change_expired_password", "locked").Inc()
+			respondError(c, &AppError{Status: http.StatusLocked, Code: CodeAccountLocked, Message: "account temporarily locked"})
+		case errors.Is(err, services.ErrAccountSuspended):
+			authHandlerOperations.WithLabelValues("change_expired_password", "suspended").Inc()
+			respondError(c, &AppError{Status: http.StatusForbidden, Code: CodeAccountSuspended, Message: "account suspended"})
+		case errors.Is(err, services.ErrEmailNotVerified):
+			authHandlerOperations.WithLabelValues("change_expired_password", "unverified").Inc()
+			respondError(c, &AppError{Status: http.StatusForbidden, Code: CodeEmailNotVerified, Message: "email address not verified"})
+		case errors.Is(err, services.ErrPasswordNotExpired):
+			authHandlerOperations.WithLabelValues("change_expired_password", "not_expired").Inc()
+			respondError(c, &AppError{Status: http.StatusConflict, Code: CodePasswordNotExpired, Message: "password has not expired"})
+		case errors.Is(err, services.ErrPasswordReused):
+			authHandlerOperations.WithLabelValues("change_expired_password", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodePasswordReused, Message: "password was used recently"})
+		case errors.Is(err, services.ErrInvalidCredentials):
+			authHandlerOperations.WithLabelValues("change_expired_password", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusUnauthorized, Code: CodeInvalidCredentials, Message: "invalid credentials"})
+		default:
+			authHandlerOperations.WithLabelValues("change_expired_password", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to change password", Err: err})
+		}
+		return
+	}
+
+	if h.loginLimiter != nil {
+		h.loginLimiter.Reset(limiterKey)
+	}
+
+	authHandlerOperations.WithLabelValues("change_expired_password", "success").Inc()
+	c.JSON(http.StatusOK, gin.H{"message": "password changed"})
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/JorgeSaicoski/login-go/internal/services"
+)
+
+func TestTokenErrorCodes(t *testing.T) {
+	tests := []struct {
+		err  error
+		code string
+	}{
+		{services.ErrTokenExpired, CodeTokenExpired},
+		{fmt.Errorf("%w: %w", services.ErrTokenNotYetValid, services.ErrInvalidToken), CodeTokenNotYetValid},
+		{fmt.Errorf("%w: %w", services.ErrTokenMalformed, services.ErrInvalidToken), CodeTokenMalformed},
+		{services.ErrTokenRevoked, CodeTokenRevoked},
+		{services.ErrInvalidToken, CodeInvalidToken},
+	}
+	for _, tt := range tests {
+		appErr := tokenError(tt.err)
+		if appErr.Status != http.StatusUnauthorized || appErr.Code != tt.code {
+			t.Errorf("tokenError(%v) = %d %q, want 401 %q", tt.err, appErr.Status, appErr.Code, tt.code)
+		}
+	}
+}
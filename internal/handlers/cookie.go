@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DefaultTokenCookieName is the cookie holding the access token for
+// browser clients that log in with ?cookie=true
+const DefaultTokenCookieName = "access_token"
+
+type TokenCookieOptions struct {
+	Name string
+	// Secure should only be false for plain-HTTP local development
+	Secure   bool
+	Domain   string
+	SameSite http.SameSite
+}
+
+// DefaultTokenCookieOptions is Secure and SameSite=Strict, so the cookie is
+// never sent cross-site
+func DefaultTokenCookieOptions() TokenCookieOptions {
+	return TokenCookieOptions{
+		Name:     DefaultTokenCookieName,
+		Secure:   true,
+		SameSite: http.SameSiteStrictMode,
+	}
+}
+
+// SetTokenCookieOptions replaces the options used for the token cookie
+func (h *AuthHandler) SetTokenCookieOptions(opts TokenCookieOptions) {
+	if opts.Name == "" {
+		opts.Name = DefaultTokenCookieName
+	}
+	if opts.SameSite == 0 {
+		opts.SameSite = http.SameSiteStrictMode
+	}
+	h.tokenCookie = opts
+}
+
+func (h *AuthHandler) setTokenCookie(c *gin.Context, token string, expiry time.Duration) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     h.tokenCookie.Name,
+		Value:    token,
+		Path:     "/",
+		Domain:   h.tokenCookie.Domain,
+		MaxAge:   int(expiry.Seconds()),
+		Secure:   h.tokenCookie.Secure,
+		HttpOnly: true,
+		SameSite: h.tokenCookie.SameSite,
+	})
+}
+
+func (h *AuthHandler) clearTokenCookie(c *gin.Context) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     h.tokenCookie.Name,
+		Value:    "",
+		Path:     "/",
+		Domain:   h.tokenCookie.Domain,
+		MaxAge:   -1,
+		Secure:   h.tokenCookie.Secure,
+		HttpOnly: true,
+		SameSite: h.tokenCookie.SameSite,
+	})
+}
+
+// requestToken returns the bearer token from the Authorization header,
+// falling back to the token cookie for browser clients
+func (h *AuthHandler) requestToken(c *gin.Context) string {
+	if header := c.GetHeader("Authorization"); header != "" {
+		// Remove 'Bearer ' prefix if present
+		return strings.TrimPrefix(header, "Bearer ")
+	}
+	token, err := c.Cookie(h.tokenCookie.Name)
+	if err != nil {
+		return ""
+	}
+	return token
+}
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JorgeSaicoski/login-go/internal/repository"
+)
+
+// Error codes are part of the API: clients switch on them instead of
+// parsing messages, so a code must never change meaning once released.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeInvalidRequest   = "invalid_request"
+	CodeValidationFailed = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeBodyTooLarge     = "body_too_large"
+	CodeRateLimited      = "rate_limited"
+	CodeInternal         = "internal_error"
+	CodeRequestTimeout   = "request_timeout"
+	CodeRequestCancelled = "request_cancelled"
+	CodeUnavailable      = "unavailable"
+
+	CodeInvalidCredentials   = "invalid_credentials"
+	CodeIdentifierNotAllowed = "identifier_not_allowed"
+	CodeAccountLocked        = "account_locked"
+	CodeAccountSuspended     = "account_suspended"
+	CodeEmailNotVerified     = "email_not_verified"
+	CodeTokenMissing         = "token_missing"
+	CodeInvalidToken         = "invalid_token"
+	CodeTokenExpired         = "token_expired"
+	CodeTokenRevoked         = "token_revoked"
+	CodeRenewalExpired       = "renewal_expired"
+	CodeTokenNotYetValid     = "token_not_yet_valid"
+	CodeTokenMalformed       = "token_malformed"
+	CodeInvalidIssuer        = "invalid_issuer"
+	CodeInvalidAudience      = "invalid_audience"
+	CodeUsernameTaken        = "username_taken"
+	CodeEmailTaken           = "email_taken"
+	CodeWeakPassword         = "weak_password"
+	CodePasswordReused       = "password_reused"
+	CodePasswordExpired      = "password_expired"
+	CodePasswordNotExpired   = "password_not_expired"
+
+	CodePlanNameTaken        = "plan_name_taken"
+	CodePlanInUse            = "plan_in_use"
+	CodeSeatLimitReached     = "seat_limit_reached"
+	CodeSubscriptionExists   = "subscription_exists"
+	CodeSubscriptionInactive = "subscription_inactive"
+	CodeAlreadyCancelled     = "subscription_already_cancelled"
+	CodeSamePlan             = "same_plan"
+)
+
+// StatusClientClosedRequest is the non-standard status (from nginx) used
+// when the client disconnected before the response was ready
+const StatusClientClosedRequest = 499
+
+// AppError is an error with everything needed to answer the request: the
+// HTTP status, a stable code and a message safe to show the client. Err is
+// the underlying cause and is never sent to the client.
+type AppError struct {
+	Status int
+	// Code defaults to the generic code for Status when empty
+	Code    string
+	Message string
+	Details interface{}
+	Err     error
+}
+
+func (e *AppError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %v", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorResponse is the body of every error response:
+// {"error": {"code": "...", "message": "...", "details": ...}}
+type ErrorResponse struct {
+	Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// validationError wraps validator errors as a 400 with per-field details.
+// A request whose only problem is a weak password gets CodeWeakPassword.
+func validationError(err error) *AppError {
+	code := CodeValidationFailed
+	if onlyWeakPassword(err) {
+		code = CodeWeakPassword
+	}
+	return &AppError{
+		Status:  http.StatusBadRequest,
+		Code:    code,
+		Message: "validation failed",
+		Details: validationDetails(err),
+	}
+}
+
+// respondError writes err as an error response. Errors that are not an
+// AppError become a generic 500 so internal details never reach the client.
+func respondError(c *gin.Context, err error) {
+	c.JSON(errorResponse(err))
+}
+
+// AbortWithError writes err like respondError and stops the handler chain,
+// for use in middleware.
+func AbortWithError(c *gin.Context, err error) {
+	c.AbortWithStatusJSON(errorResponse(err))
+}
+
+func errorResponse(err error) (int, ErrorResponse) {
+	var appErr *AppError
+	if !errors.As(err, &appErr) {
+		appErr = &AppError{Status: http.StatusInternalServerError, Message: "internal server error"}
+	}
+	// A query that stopped because the request timed out or the client left
+	// is not a server fault, whatever status the handler picked
+	if errors.Is(err, repository.ErrRequestCancelled) {
+		appErr = cancelledError(err)
+	}
+	code := appErr.Code
+	if code == "" {
+		code = codeForStatus(appErr.Status)
+	}
+	return appErr.Status, ErrorResponse{Error: ErrorBody{
+		Code:    code,
+		Message: appErr.Message,
+		Details: appErr.Details,
+	}}
+}
+
+func cancelledError(err error) *AppError {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &AppError{Status: http.StatusRequestTimeout, Code: CodeRequestTimeout, Message: "request timed out", Err: err}
+	}
+	return &AppError{Status: StatusClientClosedRequest, Code: CodeRequestCancelled, Message: "request cancelled", Err: err}
+}
+
+func codeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusRequestEntityTooLarge:
+		return CodeBodyTooLarge
+	case http.StatusLocked:
+		return CodeAccountLocked
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	default:
+		return CodeInternal
+	}
+}
@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// respondWithETag writes body as a 200 JSON response tagged with a weak
+// ETag, or a bare 304 when the client's If-None-Match already matches it.
+// The tag hashes the serialized body together with updatedAt, so it changes
+// whenever any returned field does.
+func respondWithETag(c *gin.Context, body interface{}, updatedAt time.Time) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to encode response", Err: err})
+		return
+	}
+
+	etag := weakETag(data, updatedAt)
+	c.Header("ETag", etag)
+
+	if etagMatches(c.GetHeader("If-None-Match"), etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
+
+func weakETag(data []byte, updatedAt time.Time) string {
+	h := sha256.New()
+	h.Write(data)
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(updatedAt.UnixNano()))
+	h.Write(ts[:])
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// etagMatches implements the weak comparison If-None-Match calls for: the
+// header may list several tags, and a W/ prefix on either side is ignored.
+func etagMatches(header, etag string) bool {
+	if header == "" {
+		return false
+	}
+	want := strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == want {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/JorgeSaicoski/login-go/internal/events"
+)
+
+// eventHeartbeat is how often an idle event stream gets a comment line, so
+// proxies don't close it and dead clients are noticed
+const eventHeartbeat = 30 * time.Second
+
+// SetEventBroker enables the subscription event stream. Without a broker
+// Events answers 404.
+func (h *UserSubscriptionHandler) SetEventBroker(broker *events.Broker) {
+	h.events = broker
+}
+
+// Events streams the user's subscription changes as Server-Sent Events
+// until the client disconnects or the server shuts down. Each event is
+// named after its type and carries the SubscriptionEvent as JSON.
+func (h *UserSubscriptionHandler) Events(c *gin.Context) {
+	if h.events == nil {
+		respondError(c, &AppError{Status: http.StatusNotFound, Message: "Subscription events are disabled"})
+		return
+	}
+
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		subscriptionOperations.WithLabelValues("events", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "Invalid user ID"})
+		return
+	}
+
+	// The stream outlives the server's write timeout
+	if err := http.NewResponseController(c.Writer).SetWriteDeadline(time.Time{}); err != nil {
+		requestLogger(c, h.logger).Warn("failed to clear write deadline for event stream",
+			zap.Error(err),
+		)
+	}
+
+	ch, unsubscribe := h.events.Subscribe(uint(userID))
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// Stop nginx from buffering the stream
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+
+	ctx := c.Request.Context()
+	subscriptionOperations.WithLabelValues("events", "success").Inc()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-ctx.Done():
+			return false
+		case event, ok := <-ch:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Type, event)
+			return true
+		case <-heartbeat.C:
+			_, err := io.WriteString(w, ": keepalive\n\n")
+			return err == nil
+		}
+	})
+}
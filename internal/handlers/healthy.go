@@ -1,42 +1,90 @@
 package handlers
 
 import (
+	"context"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
+
+	"github.com/JorgeSaicoski/login-go/internal/workers"
 )
 
+const defaultPingTimeout = 2 * time.Second
+
 type HealthHandler struct {
-	db *gorm.DB
+	db          *gorm.DB
+	pingTimeout time.Duration
+	workers     *workers.Registry
 }
 
-func NewHealthHandler(db *gorm.DB) *HealthHandler {
-	return &HealthHandler{db: db}
+func NewHealthHandler(db *gorm.DB, pingTimeout time.Duration) *HealthHandler {
+	if pingTimeout <= 0 {
+		pingTimeout = defaultPingTimeout
+	}
+	return &HealthHandler{
+		db:          db,
+		pingTimeout: pingTimeout,
+	}
+}
+
+// SetWorkerRegistry makes Readiness report the status of the background
+// workers in registry
+func (h *HealthHandler) SetWorkerRegistry(registry *workers.Registry) {
+	h.workers = registry
+}
+
+// Liveness reports that the process is up; it never checks dependencies
+func (h *HealthHandler) Liveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": "alive",
+	})
 }
 
-func (h *HealthHandler) Check(c *gin.Context) {
+// Readiness reports whether the dependencies needed to serve traffic are
+// reachable. A stalled background worker marks the service degraded but
+// still ready, since requests can be served without it.
+func (h *HealthHandler) Readiness(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.pingTimeout)
+	defer cancel()
+
+	checks := gin.H{}
+	ready := true
+
 	// Check DB connection
 	sqlDB, err := h.db.DB()
 	if err != nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"status": "unhealthy",
-			"db":     "unavailable",
-		})
-		return
+		checks["db"] = "unavailable"
+		ready = false
+	} else if err := sqlDB.PingContext(ctx); err != nil {
+		checks["db"] = "no response"
+		ready = false
+	} else {
+		checks["db"] = "connected"
 	}
 
-	err = sqlDB.Ping()
-	if err != nil {
+	if !ready {
 		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"status": "unhealthy",
-			"db":     "no response",
+			"status": "not ready",
+			"checks": checks,
 		})
 		return
 	}
 
+	status := "ready"
+	if h.workers != nil {
+		workerStatuses := h.workers.Status()
+		for _, w := range workerStatuses {
+			if !w.Healthy {
+				status = "degraded"
+			}
+		}
+		checks["workers"] = workerStatuses
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"status": "healthy",
-		"db":     "connected",
+		"status": status,
+		"checks": checks,
 	})
 }
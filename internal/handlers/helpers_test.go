@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/JorgeSaicoski/login-go/internal/models"
+)
+
+// newTestContext returns a gin context for calling handler helpers directly
+func newTestContext() *gin.Context {
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	return c
+}
+
+func createTestUser(t *testing.T, db *gorm.DB, username string) *models.User {
+	t.Helper()
+	user := &models.User{
+		Name:             username,
+		UsernameForLogin: username,
+		Email:            username + "@example.com",
+		Password:         "hash",
+		Active:           true,
+	}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func createTestSubscription(t *testing.T, db *gorm.DB, user *models.User) *models.UserSubscription {
+	t.Helper()
+	plan := &models.Subscription{Name: "plan-" + user.UsernameForLogin, Price: 10, PeriodMonths: 1}
+	if err := db.Create(plan).Error; err != nil {
+		t.Fatalf("create plan: %v", err)
+	}
+	us := &models.UserSubscription{
+		UserID:         user.ID,
+		SubscriptionID: plan.ID,
+		Type:           models.Individual,
+		StartDate:      time.Now(),
+		EndDate:        time.Now().AddDate(0, 1, 0),
+		IsActive:       true,
+	}
+	if err := db.Create(us).Error; err != nil {
+		t.Fatalf("create subscription: %v", err)
+	}
+	return us
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/JorgeSaicoski/login-go/internal/logging"
+	"github.com/JorgeSaicoski/login-go/internal/repository"
+	"github.com/JorgeSaicoski/login-go/internal/services"
+)
+
+// requestLogger tags logger with the ID set by the request ID middleware
+func requestLogger(c *gin.Context, logger *zap.Logger) *zap.Logger {
+	return logging.FromContext(c.Request.Context(), logger)
+}
+
+// logFailure logs a failed operation at error level, or at warn when err
+// only means the client went away or the request timed out
+func logFailure(c *gin.Context, logger *zap.Logger, err error, msg string, fields ...zap.Field) {
+	fields = append([]zap.Field{zap.Error(err)}, fields...)
+	if errors.Is(err, repository.ErrRequestCancelled) {
+		requestLogger(c, logger).Warn(msg, fields...)
+		return
+	}
+	requestLogger(c, logger).Error(msg, fields...)
+}
+
+// withClientInfo adds the caller's IP and user agent to ctx for audit events
+func withClientInfo(c *gin.Context, ctx context.Context) context.Context {
+	return services.WithClientInfo(ctx, c.ClientIP(), c.Request.UserAgent())
+}
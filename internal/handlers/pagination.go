@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+type PaginatedResponse struct {
+	Data   interface{} `json:"data"`
+	Total  int64       `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+}
+
+// parsePagination reads the limit and offset query params, applying the
+// defaults and capping limit at maxPageLimit.
+func parsePagination(c *gin.Context) (int, int, error) {
+	limit := defaultPageLimit
+	if raw := c.Query("limit"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value <= 0 {
+			return 0, 0, &AppError{Status: http.StatusBadRequest, Message: "Invalid limit"}
+		}
+		limit = value
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	offset := 0
+	if raw := c.Query("offset"); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			return 0, 0, &AppError{Status: http.StatusBadRequest, Message: "Invalid offset"}
+		}
+		offset = value
+	}
+
+	return limit, offset, nil
+}
@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+const defaultLimiterTTL = 10 * time.Minute
+
+type limiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// IPRateLimiter keeps an independent token bucket per client key (usually
+// the client IP). Entries idle for longer than the TTL are evicted.
+type IPRateLimiter struct {
+	mu        sync.Mutex
+	limiters  map[string]*limiterEntry
+	limit     rate.Limit
+	burst     int
+	ttl       time.Duration
+	lastSweep time.Time
+}
+
+func NewIPRateLimiter(limit rate.Limit, burst int, ttl time.Duration) *IPRateLimiter {
+	if ttl <= 0 {
+		ttl = defaultLimiterTTL
+	}
+	return &IPRateLimiter{
+		limiters:  make(map[string]*limiterEntry),
+		limit:     limit,
+		burst:     burst,
+		ttl:       ttl,
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow reports whether a request for key may proceed now.
+func (l *IPRateLimiter) Allow(key string) bool {
+	return l.Delay(key) == 0
+}
+
+// Delay takes a token for key and returns 0, or returns how long until the
+// next token is available without taking one. A limiter that can never
+// allow a request reports its TTL.
+func (l *IPRateLimiter) Delay(key string) time.Duration {
+	now := time.Now()
+	reservation := l.get(key).ReserveN(now, 1)
+	if !reservation.OK() {
+		return l.ttl
+	}
+	delay := reservation.DelayFrom(now)
+	if delay > 0 {
+		reservation.CancelAt(now)
+	}
+	return delay
+}
+
+func (l *IPRateLimiter) get(key string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) >= l.ttl {
+		l.sweep(now)
+	}
+
+	entry, ok := l.limiters[key]
+	if !ok {
+		entry = &limiterEntry{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.limiters[key] = entry
+	}
+	entry.lastSeen = now
+	return entry.limiter
+}
+
+// sweep evicts idle limiters. Callers must hold the lock.
+func (l *IPRateLimiter) sweep(now time.Time) {
+	for key, entry := range l.limiters {
+		if now.Sub(entry.lastSeen) >= l.ttl {
+			delete(l.limiters, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// SlidingWindowLimiter allows at most max attempts per key within any
+// window-long period. Unlike IPRateLimiter it is meant for keys such as
+// usernames, where attempts may come from many clients.
+type SlidingWindowLimiter struct {
+	mu        sync.Mutex
+	attempts  map[string][]time.Time
+	max       int
+	window    time.Duration
+	lastSweep time.Time
+}
+
+// NewSlidingWindowLimiter allows max attempts per key within window. A max
+// of 0 or less turns the limiter off.
+func NewSlidingWindowLimiter(max int, window time.Duration) *SlidingWindowLimiter {
+	return &SlidingWindowLimiter{
+		attempts:  make(map[string][]time.Time),
+		max:       max,
+		window:    window,
+		lastSweep: time.Now(),
+	}
+}
+
+// Allow records an attempt for key and reports whether it is within the
+// limit. Rejected attempts are not recorded.
+func (l *SlidingWindowLimiter) Allow(key string) bool {
+	if l.max <= 0 {
+		return true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastSweep) >= l.window {
+		l.sweep(now)
+	}
+
+	recent := prune(l.attempts[key], now.Add(-l.window))
+	if len(recent) >= l.max {
+		l.attempts[key] = recent
+		return false
+	}
+	l.attempts[key] = append(recent, now)
+	return true
+}
+
+// RetryAfter is how long until key may attempt again, or 0 if it may now.
+func (l *SlidingWindowLimiter) RetryAfter(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	recent := prune(l.attempts[key], now.Add(-l.window))
+	if len(recent) < l.max {
+		return 0
+	}
+	// The attempt that frees a slot is the max-th most recent one
+	return recent[len(recent)-l.max].Add(l.window).Sub(now)
+}
+
+// Reset forgets all attempts for key, e.g. after a successful login.
+func (l *SlidingWindowLimiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.attempts, key)
+}
+
+// sweep drops keys with no attempts inside the window. Callers must hold the lock.
+func (l *SlidingWindowLimiter) sweep(now time.Time) {
+	cutoff := now.Add(-l.window)
+	for key, times := range l.attempts {
+		if len(prune(times, cutoff)) == 0 {
+			delete(l.attempts, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// prune drops the attempts at or before cutoff; times is in ascending order.
+func prune(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+// allowRequest applies limiter to the client IP. Rejected requests get a
+// Retry-After header; the caller still writes the 429 response.
+func allowRequest(c *gin.Context, limiter *IPRateLimiter) bool {
+	delay := limiter.Delay(c.ClientIP())
+	if delay == 0 {
+		return true
+	}
+	setRetryAfter(c, delay)
+	return false
+}
+
+// setRetryAfter sets Retry-After in whole seconds, rounded up so clients
+// that honor it don't come back a moment too early
+func setRetryAfter(c *gin.Context, delay time.Duration) {
+	seconds := int64(math.Ceil(delay.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.FormatInt(seconds, 10))
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+func TestIPRateLimiterKeepsIndependentBudgets(t *testing.T) {
+	limiter := NewIPRateLimiter(rate.Every(time.Hour), 2, time.Minute)
+
+	for i := 0; i < 2; i++ {
+		if !limiter.Allow("10.0.0.1") {
+			t.Fatalf("request %d from 10.0.0.1 throttled within its burst", i+1)
+		}
+	}
+	if limiter.Allow("10.0.0.1") {
+		t.Fatal("10.0.0.1 allowed past its burst")
+	}
+
+	// Another client still has its whole burst
+	for i := 0; i < 2; i++ {
+		if !limiter.Allow("10.0.0.2") {
+			t.Fatalf("request %d from 10.0.0.2 throttled by another client", i+1)
+		}
+	}
+}
+
+func TestIPRateLimiterRefillsAtConfiguredRate(t *testing.T) {
+	limiter := NewIPRateLimiter(rate.Every(50*time.Millisecond), 1, time.Minute)
+
+	if !limiter.Allow("10.0.0.1") {
+		t.Fatal("first request throttled")
+	}
+	delay := limiter.Delay("10.0.0.1")
+	if delay <= 0 || delay > 50*time.Millisecond {
+		t.Fatalf("delay = %v, want within the 50ms refill interval", delay)
+	}
+
+	time.Sleep(delay)
+	if !limiter.Allow("10.0.0.1") {
+		t.Fatal("request throttled after the refill interval")
+	}
+}
+
+func TestIPRateLimiterEvictsIdleEntries(t *testing.T) {
+	limiter := NewIPRateLimiter(rate.Every(time.Hour), 1, 20*time.Millisecond)
+	limiter.Allow("10.0.0.1")
+
+	time.Sleep(30 * time.Millisecond)
+	// Any lookup after the TTL sweeps idle entries
+	limiter.Allow("10.0.0.2")
+
+	limiter.mu.Lock()
+	_, kept := limiter.limiters["10.0.0.1"]
+	limiter.mu.Unlock()
+	if kept {
+		t.Fatal("idle limiter was not evicted")
+	}
+}
+
+func TestAllowRequestSetsRetryAfter(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := NewIPRateLimiter(rate.Every(time.Minute), 1, time.Hour)
+	router := gin.New()
+	router.GET("/", func(c *gin.Context) {
+		if !allowRequest(c, limiter) {
+			c.Status(http.StatusTooManyRequests)
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	request := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = ip + ":1234"
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := request("192.0.2.1"); w.Code != http.StatusOK {
+		t.Fatalf("first request: status = %d", w.Code)
+	}
+	w := request("192.0.2.1")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: status = %d, want 429", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "60" {
+		t.Fatalf("Retry-After = %q, want 60", got)
+	}
+	if w := request("192.0.2.2"); w.Code != http.StatusOK {
+		t.Fatalf("other client: status = %d, want 200", w.Code)
+	}
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/JorgeSaicoski/login-go/internal/models"
+)
+
+// The response types below are the wire format of the API. Handlers map
+// models onto them instead of serializing gorm entities, so schema changes
+// and internal fields never leak into responses by accident.
+
+type UserResponse struct {
+	ID            uint                       `json:"id"`
+	Name          string                     `json:"name"`
+	Username      string                     `json:"username"`
+	Email         string                     `json:"email"`
+	Role          string                     `json:"role"`
+	EmailVerified bool                       `json:"email_verified"`
+	PendingEmail  string                     `json:"pending_email,omitempty"`
+	Active        bool                       `json:"active"`
+	Subscriptions []UserSubscriptionResponse `json:"subscriptions,omitempty"`
+	CreatedAt     time.Time                  `json:"created_at"`
+	UpdatedAt     time.Time                  `json:"updated_at"`
+}
+
+type SubscriptionResponse struct {
+	ID           uint      `json:"id"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	Price        float64   `json:"price"`
+	PeriodMonths int       `json:"period_months"`
+	MaxSeats     int       `json:"max_seats"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// PlanStatsResponse is the active subscriber count of a plan.
+// EstimatedRevenue is ActiveSubscriptions × Price, per billing period.
+type PlanStatsResponse struct {
+	SubscriptionID      uint    `json:"subscription_id"`
+	Name                string  `json:"name"`
+	Price               float64 `json:"price"`
+	PeriodMonths        int     `json:"period_months"`
+	ActiveSubscriptions int64   `json:"active_subscriptions"`
+	EstimatedRevenue    float64 `json:"estimated_revenue"`
+}
+
+type SubscriptionStatsResponse struct {
+	Plans               []PlanStatsResponse `json:"plans"`
+	ActiveSubscriptions int64               `json:"active_subscriptions"`
+	EstimatedRevenue    float64             `json:"estimated_revenue"`
+}
+
+// SeatsResponse is a company's seat usage on a plan. MaxSeats is 0 and
+// Remaining -1 when the plan has no seat limit.
+type SeatsResponse struct {
+	SubscriptionID uint   `json:"subscription_id"`
+	CompanyName    string `json:"company_name"`
+	MaxSeats       int    `json:"max_seats"`
+	Used           int64  `json:"used"`
+	Remaining      int64  `json:"remaining"`
+}
+
+// SessionResponse is a device the user is logged in on. Current marks the
+// session of the token used for the request.
+type SessionResponse struct {
+	ID         uint      `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+type UserSubscriptionResponse struct {
+	ID             uint                    `json:"id"`
+	UserID         uint                    `json:"user_id"`
+	SubscriptionID uint                    `json:"subscription_id"`
+	Subscription   *SubscriptionResponse   `json:"subscription,omitempty"`
+	Type           models.SubscriptionType `json:"type"`
+	CompanyName    string                  `json:"company_name,omitempty"`
+	Role           string                  `json:"role"`
+	StartDate      time.Time               `json:"start_date"`
+	EndDate        time.Time               `json:"end_date"`
+	IsActive       bool                    `json:"is_active"`
+	AutoRenew      bool                    `json:"auto_renew"`
+	CreatedAt      time.Time               `json:"created_at"`
+	UpdatedAt      time.Time               `json:"updated_at"`
+}
+
+func newUserResponse(u *models.User) UserResponse {
+	return UserResponse{
+		ID:            u.ID,
+		Name:          u.Name,
+		Username:      u.UsernameForLogin,
+		Email:         u.Email,
+		Role:          u.Role,
+		EmailVerified: u.EmailVerified,
+		PendingEmail:  u.PendingEmail,
+		Active:        u.Active,
+		Subscriptions: newUserSubscriptionResponses(u.Subscriptions),
+		CreatedAt:     u.CreatedAt,
+		UpdatedAt:     u.UpdatedAt,
+	}
+}
+
+func newUserResponses(users []models.User) []UserResponse {
+	resp := make([]UserResponse, 0, len(users))
+	for i := range users {
+		resp = append(resp, newUserResponse(&users[i]))
+	}
+	return resp
+}
+
+func newSubscriptionResponse(s *models.Subscription) SubscriptionResponse {
+	return SubscriptionResponse{
+		ID:           s.ID,
+		Name:         s.Name,
+		Description:  s.Description,
+		Price:        s.Price,
+		PeriodMonths: s.PeriodMonths,
+		MaxSeats:     s.MaxSeats,
+		CreatedAt:    s.CreatedAt,
+		UpdatedAt:    s.UpdatedAt,
+	}
+}
+
+func newUserSubscriptionResponse(us *models.UserSubscription) UserSubscriptionResponse {
+	resp := UserSubscriptionResponse{
+		ID:             us.ID,
+		UserID:         us.UserID,
+		SubscriptionID: us.SubscriptionID,
+		Type:           us.Type,
+		CompanyName:    us.CompanyName,
+		Role:           us.Role,
+		StartDate:      us.StartDate,
+		EndDate:        us.EndDate,
+		IsActive:       us.IsActive,
+		AutoRenew:      us.AutoRenew,
+		CreatedAt:      us.CreatedAt,
+		UpdatedAt:      us.UpdatedAt,
+	}
+	// The plan is only set when it was preloaded
+	if us.Subscription.ID != 0 {
+		plan := newSubscriptionResponse(&us.Subscription)
+		resp.Subscription = &plan
+	}
+	return resp
+}
+
+func newUserSubscriptionResponses(subscriptions []models.UserSubscription) []UserSubscriptionResponse {
+	if subscriptions == nil {
+		return nil
+	}
+	resp := make([]UserSubscriptionResponse, 0, len(subscriptions))
+	for i := range subscriptions {
+		resp = append(resp, newUserSubscriptionResponse(&subscriptions[i]))
+	}
+	return resp
+}
+
+// withoutPlans drops the embedded plans, leaving only SubscriptionID, for
+// list responses where the caller didn't ask to expand them
+func withoutPlans(resp []UserSubscriptionResponse) []UserSubscriptionResponse {
+	for i := range resp {
+		resp[i].Subscription = nil
+	}
+	return resp
+}
+
+func newSessionResponses(sessions []models.Session, currentID uint) []SessionResponse {
+	resp := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		resp = append(resp, SessionResponse{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			IP:         s.IP,
+			CreatedAt:  s.CreatedAt,
+			LastSeenAt: s.LastSeenAt,
+			ExpiresAt:  s.ExpiresAt,
+			Current:    currentID != 0 && s.ID == currentID,
+		})
+	}
+	return resp
+}
+
+func newSubscriptionStatsResponse(plans []models.Subscription, counts map[uint]int64) SubscriptionStatsResponse {
+	resp := SubscriptionStatsResponse{Plans: make([]PlanStatsResponse, 0, len(plans))}
+	for _, plan := range plans {
+		count := counts[plan.ID]
+		revenue := float64(count) * plan.Price
+		resp.Plans = append(resp.Plans, PlanStatsResponse{
+			SubscriptionID:      plan.ID,
+			Name:                plan.Name,
+			Price:               plan.Price,
+			PeriodMonths:        plan.PeriodMonths,
+			ActiveSubscriptions: count,
+			EstimatedRevenue:    revenue,
+		})
+		resp.ActiveSubscriptions += count
+		resp.EstimatedRevenue += revenue
+	}
+	return resp
+}
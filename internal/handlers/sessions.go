@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+
+	"github.com/JorgeSaicoski/login-go/internal/repository"
+	"github.com/JorgeSaicoski/login-go/internal/services"
+)
+
+// GetAuthenticatedSessionID returns the session of the request's token. It
+// is 0 when sessions are not tracked or the token predates them.
+func GetAuthenticatedSessionID(c *gin.Context) uint {
+	sessionID, _ := c.Get("session_id")
+	id, _ := sessionID.(uint)
+	return id
+}
+
+// Sessions lists the authenticated user's active sessions, flagging the one
+// the request was made with
+func (h *AuthHandler) Sessions(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		authHandlerDuration.WithLabelValues("sessions").Observe(time.Since(start).Seconds())
+	}()
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Read)
+	defer cancel()
+
+	userID, exists := GetAuthenticatedUserID(c)
+	if !exists {
+		authHandlerOperations.WithLabelValues("sessions", "unauthorized").Inc()
+		respondError(c, &AppError{Status: http.StatusUnauthorized, Message: "not authenticated"})
+		return
+	}
+
+	sessions, err := h.authService.ListSessions(ctx, userID)
+	if err != nil {
+		if errors.Is(err, services.ErrSessionsDisabled) {
+			authHandlerOperations.WithLabelValues("sessions", "disabled").Inc()
+			respondError(c, &AppError{Status: http.StatusNotFound, Message: "sessions are disabled"})
+			return
+		}
+		logFailure(c, h.logger, err, "failed to list sessions",
+			zap.Uint("user_id", userID),
+		)
+		authHandlerOperations.WithLabelValues("sessions", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to list sessions", Err: err})
+		return
+	}
+
+	authHandlerOperations.WithLabelValues("sessions", "success").Inc()
+	c.JSON(http.StatusOK, newSessionResponses(sessions, GetAuthenticatedSessionID(c)))
+}
+
+// RevokeSession signs one of the authenticated user's sessions out. Its
+// tokens are rejected from the next request on.
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		authHandlerDuration.WithLabelValues("revoke_session").Observe(time.Since(start).Seconds())
+	}()
+
+	ctx, cancel := context.WithTimeout(withClientInfo(c, c.Request.Context()), h.timeouts.Write)
+	defer cancel()
+
+	userID, exists := GetAuthenticatedUserID(c)
+	if !exists {
+		authHandlerOperations.WithLabelValues("revoke_session", "unauthorized").Inc()
+		respondError(c, &AppError{Status: http.StatusUnauthorized, Message: "not authenticated"})
+		return
+	}
+
+	sessionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		authHandlerOperations.WithLabelValues("revoke_session", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "invalid session ID"})
+		return
+	}
+
+	if err := h.authService.RevokeSession(ctx, userID, uint(sessionID)); err != nil {
+		switch {
+		case errors.Is(err, services.ErrSessionsDisabled):
+			authHandlerOperations.WithLabelValues("revoke_session", "disabled").Inc()
+			respondError(c, &AppError{Status: http.StatusNotFound, Message: "sessions are disabled"})
+		case errors.Is(err, repository.ErrNotFound):
+			authHandlerOperations.WithLabelValues("revoke_session", "not_found").Inc()
+			respondError(c, &AppError{Status: http.StatusNotFound, Message: "session not found"})
+		default:
+			logFailure(c, h.logger, err, "failed to revoke session",
+				zap.Uint("user_id", userID),
+				zap.Uint64("session_id", sessionID),
+			)
+			authHandlerOperations.WithLabelValues("revoke_session", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to revoke session", Err: err})
+		}
+		return
+	}
+
+	// Revoking the current session logs this client out too
+	if uint(sessionID) == GetAuthenticatedSessionID(c) {
+		h.clearTokenCookie(c)
+	}
+
+	authHandlerOperations.WithLabelValues("revoke_session", "success").Inc()
+	c.JSON(http.StatusOK, gin.H{"message": "session revoked"})
+}
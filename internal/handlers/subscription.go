@@ -1,44 +1,163 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
 
+	"github.com/JorgeSaicoski/login-go/internal/metrics"
 	"github.com/JorgeSaicoski/login-go/internal/models"
 	"github.com/JorgeSaicoski/login-go/internal/repository"
 )
 
+var (
+	planOperations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "subscription_plan_operations_total",
+			Help: "Total number of subscription plan operations",
+		},
+		[]string{"operation", "status"},
+	)
+
+	planDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "subscription_plan_duration_seconds",
+			Help:    "Duration of subscription plan operations in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"operation"},
+	)
+)
+
+func init() {
+	metrics.Register(planOperations, planDuration)
+}
+
 type SubscriptionHandler struct {
-	repo *repository.SubscriptionRepository
+	repo              *repository.SubscriptionRepository
+	userSubscriptions *repository.UserSubscriptionRepository
+	timeouts          Timeouts
 }
 
-func NewSubscriptionHandler(repo *repository.SubscriptionRepository) *SubscriptionHandler {
+func NewSubscriptionHandler(repo *repository.SubscriptionRepository, userSubscriptions *repository.UserSubscriptionRepository, timeouts Timeouts) *SubscriptionHandler {
 	return &SubscriptionHandler{
-		repo: repo,
+		repo:              repo,
+		userSubscriptions: userSubscriptions,
+		timeouts:          timeouts.withDefaults(),
+	}
+}
+
+func (h *SubscriptionHandler) Create(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		planDuration.WithLabelValues("create").Observe(time.Since(start).Seconds())
+	}()
+
+	ctx, cancel := context.WithTimeout(repository.WithPrimary(c.Request.Context()), h.timeouts.Write)
+	defer cancel()
+
+	// Bind JSON request body to subscription struct
+	var createData models.Subscription
+	if err := c.ShouldBindJSON(&createData); err != nil {
+		planOperations.WithLabelValues("create", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "Invalid request body", Err: err})
+		return
+	}
+
+	name := strings.TrimSpace(createData.Name)
+	if name == "" {
+		planOperations.WithLabelValues("create", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "Name is required"})
+		return
+	}
+	if createData.Price < 0 {
+		planOperations.WithLabelValues("create", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "Price must not be negative"})
+		return
+	}
+	if createData.PeriodMonths < 0 {
+		planOperations.WithLabelValues("create", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "Period must not be negative"})
+		return
+	}
+	if createData.MaxSeats < 0 {
+		planOperations.WithLabelValues("create", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "Max seats must not be negative"})
+		return
+	}
+
+	// Plan names must be unique
+	if _, err := h.repo.GetByNameWithContext(ctx, name); err == nil {
+		planOperations.WithLabelValues("create", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusConflict, Code: CodePlanNameTaken, Message: "Subscription name already exists"})
+		return
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		planOperations.WithLabelValues("create", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "Failed to create subscription", Err: err})
+		return
+	}
+
+	// Only copy the fields clients are allowed to set
+	subscription := &models.Subscription{
+		Name:         name,
+		Description:  createData.Description,
+		Price:        createData.Price,
+		PeriodMonths: createData.PeriodMonths,
+		MaxSeats:     createData.MaxSeats,
+	}
+
+	// Use repository to save the new subscription
+	if err := h.repo.CreateWithContext(ctx, subscription); err != nil {
+		planOperations.WithLabelValues("create", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "Failed to create subscription", Err: err})
+		return
 	}
+
+	planOperations.WithLabelValues("create", "success").Inc()
+	c.JSON(http.StatusCreated, newSubscriptionResponse(subscription))
 }
 
 func (h *SubscriptionHandler) UpdateByID(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		planDuration.WithLabelValues("update").Observe(time.Since(start).Seconds())
+	}()
+
+	ctx, cancel := context.WithTimeout(repository.WithPrimary(c.Request.Context()), h.timeouts.Write)
+	defer cancel()
+
 	// Convert ID from string to uint
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		planOperations.WithLabelValues("update", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "Invalid ID format"})
 		return
 	}
 
 	// Get existing subscription using repository
-	subscription, err := h.repo.GetByID(uint(id))
+	subscription, err := h.repo.GetByIDWithContext(ctx, uint(id))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		if errors.Is(err, repository.ErrNotFound) {
+			planOperations.WithLabelValues("update", "not_found").Inc()
+			respondError(c, &AppError{Status: http.StatusNotFound, Message: "Subscription not found"})
+			return
+		}
+		planOperations.WithLabelValues("update", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "Failed to get subscription", Err: err})
 		return
 	}
 
 	// Bind JSON request body to subscription struct
 	var updateData models.Subscription
 	if err := c.ShouldBindJSON(&updateData); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		planOperations.WithLabelValues("update", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "Invalid request body", Err: err})
 		return
 	}
 
@@ -46,30 +165,123 @@ func (h *SubscriptionHandler) UpdateByID(c *gin.Context) {
 	subscription.Name = updateData.Name
 	subscription.Description = updateData.Description
 	subscription.Price = updateData.Price
+	if updateData.PeriodMonths > 0 {
+		subscription.PeriodMonths = updateData.PeriodMonths
+	}
+	if updateData.MaxSeats < 0 {
+		planOperations.WithLabelValues("update", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "Max seats must not be negative"})
+		return
+	}
+	subscription.MaxSeats = updateData.MaxSeats
 
 	// Use repository to save changes
-	if err := h.repo.Update(subscription); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update subscription"})
+	if err := h.repo.UpdateWithContext(ctx, subscription); err != nil {
+		planOperations.WithLabelValues("update", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "Failed to update subscription", Err: err})
 		return
 	}
 
-	c.JSON(http.StatusOK, subscription)
+	planOperations.WithLabelValues("update", "success").Inc()
+	c.JSON(http.StatusOK, newSubscriptionResponse(subscription))
 }
 
 func (h *SubscriptionHandler) GetByID(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		planDuration.WithLabelValues("get").Observe(time.Since(start).Seconds())
+	}()
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Read)
+	defer cancel()
+
 	// Convert ID from string to uint
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ID format"})
+		planOperations.WithLabelValues("get", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "Invalid ID format"})
 		return
 	}
 
 	// Use repository to get subscription
-	subscription, err := h.repo.GetByID(uint(id))
+	subscription, err := h.repo.GetByIDWithContext(ctx, uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			planOperations.WithLabelValues("get", "not_found").Inc()
+			respondError(c, &AppError{Status: http.StatusNotFound, Message: "Subscription not found"})
+			return
+		}
+		planOperations.WithLabelValues("get", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "Failed to get subscription", Err: err})
+		return
+	}
+
+	planOperations.WithLabelValues("get", "success").Inc()
+	respondWithETag(c, newSubscriptionResponse(subscription), subscription.UpdatedAt)
+}
+
+func (h *SubscriptionHandler) DeleteByID(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		planDuration.WithLabelValues("delete").Observe(time.Since(start).Seconds())
+	}()
+
+	ctx, cancel := context.WithTimeout(repository.WithPrimary(c.Request.Context()), h.timeouts.Write)
+	defer cancel()
+
+	// Convert ID from string to uint
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		planOperations.WithLabelValues("delete", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "Invalid ID format"})
+		return
+	}
+
+	// Use repository to delete subscription
+	if err := h.repo.DeleteWithContext(ctx, uint(id)); err != nil {
+		switch {
+		case errors.Is(err, repository.ErrSubscriptionInUse):
+			planOperations.WithLabelValues("delete", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusConflict, Code: CodePlanInUse, Message: "Subscription is assigned to users"})
+		case errors.Is(err, repository.ErrNotFound):
+			planOperations.WithLabelValues("delete", "not_found").Inc()
+			respondError(c, &AppError{Status: http.StatusNotFound, Message: "Subscription not found"})
+		default:
+			planOperations.WithLabelValues("delete", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "Failed to delete subscription", Err: err})
+		}
+		return
+	}
+
+	planOperations.WithLabelValues("delete", "success").Inc()
+	c.Status(http.StatusNoContent)
+}
+
+// Stats reports the active subscribers of every plan and the revenue they
+// bring in per billing period
+func (h *SubscriptionHandler) Stats(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		planDuration.WithLabelValues("stats").Observe(time.Since(start).Seconds())
+	}()
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Read)
+	defer cancel()
+
+	plans, err := h.repo.ListWithContext(ctx)
+	if err != nil {
+		planOperations.WithLabelValues("stats", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "Failed to get subscription stats", Err: err})
+		return
+	}
+
+	counts, err := h.userSubscriptions.CountActiveBySubscriptionID(ctx)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Subscription not found"})
+		planOperations.WithLabelValues("stats", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "Failed to get subscription stats", Err: err})
 		return
 	}
 
-	c.JSON(http.StatusOK, subscription)
+	planOperations.WithLabelValues("stats", "success").Inc()
+	c.JSON(http.StatusOK, newSubscriptionStatsResponse(plans, counts))
 }
@@ -0,0 +1,36 @@
+package handlers
+
+import "time"
+
+// Timeouts bound the context each handler passes to the repositories and
+// services. Zero fields fall back to DefaultTimeouts.
+type Timeouts struct {
+	// Read is used by lookups and token checks
+	Read time.Duration
+	// Write is used by anything that changes data, including login
+	Write time.Duration
+	// Bulk is used by the admin bulk import
+	Bulk time.Duration
+}
+
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Read:  5 * time.Second,
+		Write: 10 * time.Second,
+		Bulk:  60 * time.Second,
+	}
+}
+
+func (t Timeouts) withDefaults() Timeouts {
+	defaults := DefaultTimeouts()
+	if t.Read <= 0 {
+		t.Read = defaults.Read
+	}
+	if t.Write <= 0 {
+		t.Write = defaults.Write
+	}
+	if t.Bulk <= 0 {
+		t.Bulk = defaults.Bulk
+	}
+	return t
+}
@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JorgeSaicoski/login-go/internal/models"
+	"github.com/JorgeSaicoski/login-go/internal/repository"
+	"github.com/JorgeSaicoski/login-go/internal/testutil"
+)
+
+func TestTimeoutsWithDefaults(t *testing.T) {
+	got := Timeouts{Read: time.Second, Write: -1}.withDefaults()
+	want := DefaultTimeouts()
+	want.Read = time.Second
+	if got != want {
+		t.Fatalf("withDefaults = %+v, want %+v", got, want)
+	}
+}
+
+// TestShortTimeoutReturnsRequestTimeout checks that a configured timeout
+// reaches the repository call and surfaces as a 408, not a 500.
+func TestShortTimeoutReturnsRequestTimeout(t *testing.T) {
+	db := testutil.NewDB(t)
+	plan := &models.Subscription{Name: "basic", PeriodMonths: 1}
+	if err := db.Create(plan).Error; err != nil {
+		t.Fatalf("create plan: %v", err)
+	}
+
+	get := func(timeouts Timeouts) *httptest.ResponseRecorder {
+		h := NewSubscriptionHandler(repository.NewSubscriptionRepository(db), nil, timeouts)
+		rec := httptest.NewRecorder()
+		gin.SetMode(gin.TestMode)
+		c, _ := gin.CreateTestContext(rec)
+		c.Request = httptest.NewRequest(http.MethodGet, "/subscription/"+strconv.Itoa(int(plan.ID)), nil)
+		c.Params = gin.Params{{Key: "id", Value: strconv.Itoa(int(plan.ID))}}
+		h.GetByID(c)
+		return rec
+	}
+
+	if rec := get(Timeouts{}); rec.Code != http.StatusOK {
+		t.Fatalf("default timeouts: status %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+
+	rec := get(Timeouts{Read: time.Nanosecond})
+	if rec.Code != http.StatusRequestTimeout {
+		t.Fatalf("status %d, want 408: %s", rec.Code, rec.Body.String())
+	}
+	var body ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decode body: %v", err)
+	}
+	if body.Error.Code != CodeRequestTimeout {
+		t.Fatalf("code = %q, want %q", body.Error.Code, CodeRequestTimeout)
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
@@ -15,8 +16,10 @@ import (
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
 
+	"github.com/JorgeSaicoski/login-go/internal/metrics"
 	"github.com/JorgeSaicoski/login-go/internal/models"
 	"github.com/JorgeSaicoski/login-go/internal/repository"
+	"github.com/JorgeSaicoski/login-go/internal/services"
 )
 
 var (
@@ -38,22 +41,57 @@ var (
 )
 
 func init() {
-	prometheus.MustRegister(userHandlerOperations, userHandlerDuration)
+	metrics.Register(userHandlerOperations, userHandlerDuration)
 }
 
 type UserHandler struct {
-	repo        *repository.UserRepository
-	logger      *zap.Logger
-	validator   *validator.Validate
-	rateLimiter *rate.Limiter
-	mu          sync.RWMutex
+	repo            *repository.UserRepository
+	verification    *services.EmailVerificationService
+	audit           *services.AuditService
+	passwordHistory *services.PasswordHistoryService
+	logger          *zap.Logger
+	validator       *validator.Validate
+	rateLimiter     *IPRateLimiter
+	timeouts        Timeouts
+	// availabilityLimiter is stricter than rateLimiter since the
+	// availability check is unauthenticated and cheap to call
+	availabilityLimiter *IPRateLimiter
+	mu                  sync.RWMutex
 }
 
+const (
+	availabilityLimit = rate.Limit(0.5)
+	availabilityBurst = 10
+)
+
 type CreateUserRequest struct {
 	Name             string `json:"name" validate:"required,min=2,max=100"`
 	UsernameForLogin string `json:"username" validate:"required,min=3,max=50,alphanum"`
 	Email            string `json:"email" validate:"required,email"`
-	Password         string `json:"password" validate:"required,min=8,max=100"`
+	Password         string `json:"password" validate:"required,max=100,strongpassword"`
+}
+
+// BulkCreateResult reports the outcome for one row of a bulk import, in
+// request order
+type BulkCreateResult struct {
+	Index   int          `json:"index"`
+	Status  string       `json:"status"`
+	ID      uint         `json:"id,omitempty"`
+	Reason  string       `json:"reason,omitempty"`
+	Details []FieldError `json:"details,omitempty"`
+}
+
+// AvailabilityQuery uses the same rules as CreateUserRequest so a value
+// reported available is also valid to register
+type AvailabilityQuery struct {
+	UsernameForLogin string `form:"username" validate:"required_without=Email,omitempty,min=3,max=50,alphanum"`
+	Email            string `form:"email" validate:"required_without=UsernameForLogin,omitempty,email"`
+}
+
+// AvailabilityResponse only carries the fields that were asked about
+type AvailabilityResponse struct {
+	UsernameAvailable *bool `json:"username_available,omitempty"`
+	EmailAvailable    *bool `json:"email_available,omitempty"`
 }
 
 type UpdateUserRequest struct {
@@ -61,12 +99,23 @@ type UpdateUserRequest struct {
 	Email string `json:"email" validate:"omitempty,email"`
 }
 
-func NewUserHandler(repo *repository.UserRepository, logger *zap.Logger) *UserHandler {
+type ChangePasswordRequest struct {
+	OldPassword string `json:"old_password" validate:"required"`
+	NewPassword string `json:"new_password" validate:"required,max=100,strongpassword"`
+}
+
+func NewUserHandler(repo *repository.UserRepository, verification *services.EmailVerificationService, audit *services.AuditService, passwordHistory *services.PasswordHistoryService, logger *zap.Logger, validate *validator.Validate, limit rate.Limit, burst int, timeouts Timeouts) *UserHandler {
 	return &UserHandler{
-		repo:        repo,
-		logger:      logger,
-		validator:   validator.New(),
-		rateLimiter: rate.NewLimiter(rate.Every(time.Second), 50),
+		repo:            repo,
+		verification:    verification,
+		audit:           audit,
+		passwordHistory: passwordHistory,
+		logger:          logger,
+		validator:       validatorOrDefault(validate),
+		rateLimiter:     NewIPRateLimiter(limit, burst, defaultLimiterTTL),
+		timeouts:        timeouts.withDefaults(),
+
+		availabilityLimiter: NewIPRateLimiter(availabilityLimit, availabilityBurst, defaultLimiterTTL),
 	}
 }
 
@@ -76,25 +125,25 @@ func (h *UserHandler) Create(c *gin.Context) {
 		userHandlerDuration.WithLabelValues("create").Observe(time.Since(start).Seconds())
 	}()
 
-	if !h.rateLimiter.Allow() {
+	if !allowRequest(c, h.rateLimiter) {
 		userHandlerOperations.WithLabelValues("create", "rate_limited").Inc()
-		c.JSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "rate limit exceeded"})
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(repository.WithPrimary(c.Request.Context()), h.timeouts.Write)
 	defer cancel()
 
 	var req CreateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		userHandlerOperations.WithLabelValues("create", "failed").Inc()
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format"})
+		respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "invalid request format"})
 		return
 	}
 
 	if err := h.validator.Struct(req); err != nil {
 		userHandlerOperations.WithLabelValues("create", "failed").Inc()
-		c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "details": err.Error()})
+		respondError(c, validationError(err))
 		return
 	}
 
@@ -107,15 +156,15 @@ func (h *UserHandler) Create(c *gin.Context) {
 	defer h.mu.Unlock()
 
 	// Check if username or email already exists
-	if _, err := h.repo.GetByUsername(req.UsernameForLogin); err == nil {
+	if _, err := h.repo.GetByUsernameWithContext(ctx, req.UsernameForLogin); err == nil {
 		userHandlerOperations.WithLabelValues("create", "failed").Inc()
-		c.JSON(http.StatusConflict, gin.H{"error": "username already taken"})
+		respondError(c, &AppError{Status: http.StatusConflict, Code: CodeUsernameTaken, Message: "username already taken"})
 		return
 	}
 
-	if _, err := h.repo.GetByEmail(req.Email); err == nil {
+	if _, err := h.repo.GetByEmailWithContext(ctx, req.Email); err == nil {
 		userHandlerOperations.WithLabelValues("create", "failed").Inc()
-		c.JSON(http.StatusConflict, gin.H{"error": "email already registered"})
+		respondError(c, &AppError{Status: http.StatusConflict, Code: CodeEmailTaken, Message: "email already registered"})
 		return
 	}
 
@@ -127,25 +176,204 @@ func (h *UserHandler) Create(c *gin.Context) {
 	}
 
 	if err := h.repo.CreateWithContext(ctx, user); err != nil {
-		h.logger.Error("failed to create user",
-			zap.Error(err),
+		if errors.Is(err, repository.ErrDuplicateEntry) {
+			// Also covers an alias of a registered address when email
+			// canonicalization is on
+			userHandlerOperations.WithLabelValues("create", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusConflict, Message: "username or email already registered"})
+			return
+		}
+		logFailure(c, h.logger, err, "failed to create user",
 			zap.String("username", req.UsernameForLogin),
 		)
 		userHandlerOperations.WithLabelValues("create", "failed").Inc()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create user"})
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to create user", Err: err})
 		return
 	}
 
-	h.logger.Info("user created",
+	requestLogger(c, h.logger).Info("user created",
 		zap.String("username", user.UsernameForLogin),
 		zap.Uint("user_id", user.ID),
 	)
 
-	// Don't return the password
-	user.Password = ""
+	// A failed send shouldn't fail registration; the user can ask for a resend
+	if err := h.verification.Issue(ctx, user); err != nil {
+		logFailure(c, h.logger, err, "failed to issue verification token",
+			zap.Uint("user_id", user.ID),
+		)
+	}
 
 	userHandlerOperations.WithLabelValues("create", "success").Inc()
-	c.JSON(http.StatusCreated, user)
+	c.JSON(http.StatusCreated, newUserResponse(user))
+}
+
+// Availability tells the signup form whether a username and/or email can
+// still be registered, without creating anything
+func (h *UserHandler) Availability(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		userHandlerDuration.WithLabelValues("availability").Observe(time.Since(start).Seconds())
+	}()
+
+	if !allowRequest(c, h.availabilityLimiter) {
+		userHandlerOperations.WithLabelValues("availability", "rate_limited").Inc()
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "rate limit exceeded"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Read)
+	defer cancel()
+
+	var query AvailabilityQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		userHandlerOperations.WithLabelValues("availability", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "invalid request format"})
+		return
+	}
+
+	if err := h.validator.Struct(query); err != nil {
+		userHandlerOperations.WithLabelValues("availability", "failed").Inc()
+		respondError(c, validationError(err))
+		return
+	}
+
+	var resp AvailabilityResponse
+	if query.UsernameForLogin != "" {
+		taken, err := h.repo.UsernameTakenWithContext(ctx, query.UsernameForLogin)
+		if err != nil {
+			userHandlerOperations.WithLabelValues("availability", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to check availability", Err: err})
+			return
+		}
+		available := !taken
+		resp.UsernameAvailable = &available
+	}
+	if query.Email != "" {
+		taken, err := h.repo.EmailTakenWithContext(ctx, query.Email)
+		if err != nil {
+			userHandlerOperations.WithLabelValues("availability", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to check availability", Err: err})
+			return
+		}
+		available := !taken
+		resp.EmailAvailable = &available
+	}
+
+	userHandlerOperations.WithLabelValues("availability", "success").Inc()
+	c.JSON(http.StatusOK, resp)
+}
+
+// BulkCreate imports many users in one transaction; admin only. Rows that
+// fail validation or collide with an existing user are reported and skipped.
+func (h *UserHandler) BulkCreate(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		userHandlerDuration.WithLabelValues("bulk_create").Observe(time.Since(start).Seconds())
+	}()
+
+	if !allowRequest(c, h.rateLimiter) {
+		userHandlerOperations.WithLabelValues("bulk_create", "rate_limited").Inc()
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "rate limit exceeded"})
+		return
+	}
+
+	// Hashing hundreds of passwords takes a while
+	ctx, cancel := context.WithTimeout(repository.WithPrimary(c.Request.Context()), h.timeouts.Bulk)
+	defer cancel()
+
+	var reqs []CreateUserRequest
+	if err := c.ShouldBindJSON(&reqs); err != nil {
+		userHandlerOperations.WithLabelValues("bulk_create", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "invalid request format"})
+		return
+	}
+
+	if len(reqs) == 0 || len(reqs) > repository.MaxBulkCreate {
+		userHandlerOperations.WithLabelValues("bulk_create", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: fmt.Sprintf("between 1 and %d users are allowed per request", repository.MaxBulkCreate)})
+		return
+	}
+
+	results := make([]BulkCreateResult, len(reqs))
+	users := make([]*models.User, 0, len(reqs))
+	rowIndex := make([]int, 0, len(reqs))
+	for i, req := range reqs {
+		results[i] = BulkCreateResult{Index: i, Status: "failed"}
+
+		if err := h.validator.Struct(req); err != nil {
+			results[i].Reason = "validation failed"
+			results[i].Details = validationDetails(err)
+			continue
+		}
+
+		users = append(users, &models.User{
+			Name:             strings.TrimSpace(req.Name),
+			UsernameForLogin: req.UsernameForLogin,
+			Email:            req.Email,
+			Password:         req.Password,
+		})
+		rowIndex = append(rowIndex, i)
+	}
+
+	if len(users) > 0 {
+		// No handler lock: hashing up to MaxBulkCreate passwords would stall
+		// every other user request. The transaction and the unique indexes
+		// keep concurrent imports and registrations from clashing.
+		rowErrs, err := h.repo.BulkCreateWithContext(ctx, users)
+		if err != nil {
+			logFailure(c, h.logger, err, "failed to bulk create users",
+				zap.Int("count", len(users)),
+			)
+			userHandlerOperations.WithLabelValues("bulk_create", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to import users", Err: err})
+			return
+		}
+
+		for j, rowErr := range rowErrs {
+			result := &results[rowIndex[j]]
+			switch {
+			case rowErr == nil:
+				result.Status = "created"
+				result.ID = users[j].ID
+			case errors.Is(rowErr, repository.ErrDuplicateEntry):
+				result.Reason = "username or email already exists"
+			default:
+				result.Reason = "invalid user"
+			}
+		}
+
+		// As in Create, a failed send doesn't fail the import; the user can
+		// ask for a resend
+		for j, rowErr := range rowErrs {
+			if rowErr != nil {
+				continue
+			}
+			if err := h.verification.Issue(ctx, users[j]); err != nil {
+				logFailure(c, h.logger, err, "failed to issue verification token",
+					zap.Uint("user_id", users[j].ID),
+				)
+			}
+		}
+	}
+
+	created := 0
+	for _, result := range results {
+		if result.Status == "created" {
+			created++
+		}
+	}
+
+	requestLogger(c, h.logger).Info("bulk user import finished",
+		zap.Int("requested", len(reqs)),
+		zap.Int("created", created),
+	)
+
+	userHandlerOperations.WithLabelValues("bulk_create", "success").Inc()
+	c.JSON(http.StatusOK, gin.H{
+		"created": created,
+		"failed":  len(reqs) - created,
+		"results": results,
+	})
 }
 
 func (h *UserHandler) GetByID(c *gin.Context) {
@@ -154,13 +382,13 @@ func (h *UserHandler) GetByID(c *gin.Context) {
 		userHandlerDuration.WithLabelValues("get").Observe(time.Since(start).Seconds())
 	}()
 
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Read)
 	defer cancel()
 
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		userHandlerOperations.WithLabelValues("get", "failed").Inc()
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "invalid ID format"})
 		return
 	}
 
@@ -168,7 +396,7 @@ func (h *UserHandler) GetByID(c *gin.Context) {
 	authUserID, exists := GetAuthenticatedUserID(c)
 	if !exists || authUserID != uint(id) {
 		userHandlerOperations.WithLabelValues("get", "unauthorized").Inc()
-		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized access"})
+		respondError(c, &AppError{Status: http.StatusForbidden, Message: "unauthorized access"})
 		return
 	}
 
@@ -179,23 +407,19 @@ func (h *UserHandler) GetByID(c *gin.Context) {
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			userHandlerOperations.WithLabelValues("get", "not_found").Inc()
-			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			respondError(c, &AppError{Status: http.StatusNotFound, Message: "user not found"})
 			return
 		}
-		h.logger.Error("failed to get user",
-			zap.Error(err),
+		logFailure(c, h.logger, err, "failed to get user",
 			zap.Uint64("user_id", id),
 		)
 		userHandlerOperations.WithLabelValues("get", "failed").Inc()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get user"})
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to get user", Err: err})
 		return
 	}
 
-	// Don't return the password
-	user.Password = ""
-
 	userHandlerOperations.WithLabelValues("get", "success").Inc()
-	c.JSON(http.StatusOK, user)
+	respondWithETag(c, newUserResponse(user), user.UpdatedAt)
 }
 
 func (h *UserHandler) UpdateByID(c *gin.Context) {
@@ -204,19 +428,19 @@ func (h *UserHandler) UpdateByID(c *gin.Context) {
 		userHandlerDuration.WithLabelValues("update").Observe(time.Since(start).Seconds())
 	}()
 
-	if !h.rateLimiter.Allow() {
+	if !allowRequest(c, h.rateLimiter) {
 		userHandlerOperations.WithLabelValues("update", "rate_limited").Inc()
-		c.JSON(http.StatusTooManyRequests, gin.H{"error": "rate limit exceeded"})
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "rate limit exceeded"})
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(repository.WithPrimary(c.Request.Context()), h.timeouts.Write)
 	defer cancel()
 
 	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		userHandlerOperations.WithLabelValues("update", "failed").Inc()
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid ID format"})
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "invalid ID format"})
 		return
 	}
 
@@ -224,20 +448,20 @@ func (h *UserHandler) UpdateByID(c *gin.Context) {
 	authUserID, exists := GetAuthenticatedUserID(c)
 	if !exists || authUserID != uint(id) {
 		userHandlerOperations.WithLabelValues("update", "unauthorized").Inc()
-		c.JSON(http.StatusForbidden, gin.H{"error": "unauthorized access"})
+		respondError(c, &AppError{Status: http.StatusForbidden, Message: "unauthorized access"})
 		return
 	}
 
 	var req UpdateUserRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		userHandlerOperations.WithLabelValues("update", "failed").Inc()
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid request format"})
+		respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "invalid request format"})
 		return
 	}
 
 	if err := h.validator.Struct(req); err != nil {
 		userHandlerOperations.WithLabelValues("update", "failed").Inc()
-		c.JSON(http.StatusBadRequest, gin.H{"error": "validation failed", "details": err.Error()})
+		respondError(c, validationError(err))
 		return
 	}
 
@@ -248,15 +472,14 @@ func (h *UserHandler) UpdateByID(c *gin.Context) {
 	if err != nil {
 		if errors.Is(err, repository.ErrNotFound) {
 			userHandlerOperations.WithLabelValues("update", "not_found").Inc()
-			c.JSON(http.StatusNotFound, gin.H{"error": "user not found"})
+			respondError(c, &AppError{Status: http.StatusNotFound, Message: "user not found"})
 			return
 		}
-		h.logger.Error("failed to get user for update",
-			zap.Error(err),
+		logFailure(c, h.logger, err, "failed to get user for update",
 			zap.Uint64("user_id", id),
 		)
 		userHandlerOperations.WithLabelValues("update", "failed").Inc()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update user"})
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to update user", Err: err})
 		return
 	}
 
@@ -264,36 +487,471 @@ func (h *UserHandler) UpdateByID(c *gin.Context) {
 	if req.Name != "" {
 		user.Name = strings.TrimSpace(req.Name)
 	}
+
+	// A new email only takes effect once confirmed from its inbox, so an
+	// account can't be moved to an address its owner doesn't control
+	var newEmail string
 	if req.Email != "" {
-		newEmail := strings.TrimSpace(strings.ToLower(req.Email))
-		if newEmail != user.Email {
-			// Check if new email is already in use
-			if _, err := h.repo.GetByEmail(newEmail); err == nil {
+		newEmail = strings.TrimSpace(strings.ToLower(req.Email))
+		switch newEmail {
+		case user.Email:
+			user.ClearPendingEmail()
+			newEmail = ""
+		case user.PendingEmail:
+			// Already pending; send a fresh token
+		default:
+			if _, err := h.repo.GetByEmailWithContext(ctx, newEmail); err == nil {
 				userHandlerOperations.WithLabelValues("update", "failed").Inc()
-				c.JSON(http.StatusConflict, gin.H{"error": "email already in use"})
+				respondError(c, &AppError{Status: http.StatusConflict, Code: CodeEmailTaken, Message: "email already in use"})
 				return
 			}
-			user.Email = newEmail
 		}
 	}
 
-	if err := h.repo.UpdateWithContext(ctx, user); err != nil {
-		h.logger.Error("failed to update user",
-			zap.Error(err),
+	if newEmail != "" {
+		err = h.verification.RequestEmailChange(ctx, user, newEmail)
+	} else {
+		err = h.repo.UpdateWithContext(ctx, user)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrDuplicateEntry) {
+			userHandlerOperations.WithLabelValues("update", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusConflict, Code: CodeEmailTaken, Message: "email already in use"})
+			return
+		}
+		logFailure(c, h.logger, err, "failed to update user",
 			zap.Uint("user_id", user.ID),
 		)
 		userHandlerOperations.WithLabelValues("update", "failed").Inc()
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update user"})
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to update user", Err: err})
 		return
 	}
 
-	h.logger.Info("user updated",
+	requestLogger(c, h.logger).Info("user updated",
 		zap.Uint("user_id", user.ID),
 	)
 
-	// Don't return the password
-	user.Password = ""
-
 	userHandlerOperations.WithLabelValues("update", "success").Inc()
-	c.JSON(http.StatusOK, user)
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+func (h *UserHandler) DeleteByID(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		userHandlerDuration.WithLabelValues("delete").Observe(time.Since(start).Seconds())
+	}()
+
+	if !allowRequest(c, h.rateLimiter) {
+		userHandlerOperations.WithLabelValues("delete", "rate_limited").Inc()
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "rate limit exceeded"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(repository.WithPrimary(c.Request.Context()), h.timeouts.Write)
+	defer cancel()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		userHandlerOperations.WithLabelValues("delete", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "invalid ID format"})
+		return
+	}
+
+	// Check if user is deleting their own account
+	authUserID, exists := GetAuthenticatedUserID(c)
+	if !exists || authUserID != uint(id) {
+		userHandlerOperations.WithLabelValues("delete", "unauthorized").Inc()
+		respondError(c, &AppError{Status: http.StatusForbidden, Message: "unauthorized access"})
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	user, err := h.repo.DeleteAndReturnWithContext(ctx, uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			userHandlerOperations.WithLabelValues("delete", "not_found").Inc()
+			respondError(c, &AppError{Status: http.StatusNotFound, Message: "user not found"})
+			return
+		}
+		logFailure(c, h.logger, err, "failed to delete user",
+			zap.Uint64("user_id", id),
+		)
+		userHandlerOperations.WithLabelValues("delete", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to delete user", Err: err})
+		return
+	}
+
+	requestLogger(c, h.logger).Info("user deleted",
+		zap.Uint64("user_id", id),
+	)
+
+	userHandlerOperations.WithLabelValues("delete", "success").Inc()
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// Restore undeletes a soft-deleted user; admin only
+func (h *UserHandler) Restore(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		userHandlerDuration.WithLabelValues("restore").Observe(time.Since(start).Seconds())
+	}()
+
+	if !allowRequest(c, h.rateLimiter) {
+		userHandlerOperations.WithLabelValues("restore", "rate_limited").Inc()
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "rate limit exceeded"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(repository.WithPrimary(c.Request.Context()), h.timeouts.Write)
+	defer cancel()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		userHandlerOperations.WithLabelValues("restore", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "invalid ID format"})
+		return
+	}
+
+	if err := h.repo.RestoreUser(ctx, uint(id)); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			userHandlerOperations.WithLabelValues("restore", "not_found").Inc()
+			respondError(c, &AppError{Status: http.StatusNotFound, Message: "deleted user not found"})
+			return
+		}
+		logFailure(c, h.logger, err, "failed to restore user",
+			zap.Uint64("user_id", id),
+		)
+		userHandlerOperations.WithLabelValues("restore", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to restore user", Err: err})
+		return
+	}
+
+	user, err := h.repo.GetByIDWithContext(ctx, uint(id))
+	if err != nil {
+		logFailure(c, h.logger, err, "failed to load restored user",
+			zap.Uint64("user_id", id),
+		)
+		userHandlerOperations.WithLabelValues("restore", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to restore user", Err: err})
+		return
+	}
+
+	requestLogger(c, h.logger).Info("user restored",
+		zap.Uint64("user_id", id),
+	)
+
+	userHandlerOperations.WithLabelValues("restore", "success").Inc()
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+// Suspend blocks a user from logging in or using their existing tokens
+// without deleting the account
+func (h *UserHandler) Suspend(c *gin.Context) {
+	h.setActive(c, false, "suspend")
+}
+
+// Reactivate lifts a suspension
+func (h *UserHandler) Reactivate(c *gin.Context) {
+	h.setActive(c, true, "reactivate")
+}
+
+func (h *UserHandler) setActive(c *gin.Context, active bool, operation string) {
+	start := time.Now()
+	defer func() {
+		userHandlerDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	}()
+
+	if !allowRequest(c, h.rateLimiter) {
+		userHandlerOperations.WithLabelValues(operation, "rate_limited").Inc()
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "rate limit exceeded"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(repository.WithPrimary(c.Request.Context()), h.timeouts.Write)
+	defer cancel()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		userHandlerOperations.WithLabelValues(operation, "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "invalid ID format"})
+		return
+	}
+
+	if authUserID, _ := GetAuthenticatedUserID(c); !active && authUserID == uint(id) {
+		userHandlerOperations.WithLabelValues(operation, "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "cannot suspend your own account"})
+		return
+	}
+
+	if err := h.repo.SetActiveWithContext(ctx, uint(id), active); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			userHandlerOperations.WithLabelValues(operation, "not_found").Inc()
+			respondError(c, &AppError{Status: http.StatusNotFound, Message: "user not found"})
+			return
+		}
+		logFailure(c, h.logger, err, "failed to update user active state",
+			zap.Uint64("user_id", id),
+			zap.Bool("active", active),
+		)
+		userHandlerOperations.WithLabelValues(operation, "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to update user", Err: err})
+		return
+	}
+
+	user, err := h.repo.GetByIDWithContext(ctx, uint(id))
+	if err != nil {
+		logFailure(c, h.logger, err, "failed to load user",
+			zap.Uint64("user_id", id),
+		)
+		userHandlerOperations.WithLabelValues(operation, "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to update user", Err: err})
+		return
+	}
+
+	requestLogger(c, h.logger).Info("user active state changed",
+		zap.Uint64("user_id", id),
+		zap.Bool("active", active),
+	)
+
+	userHandlerOperations.WithLabelValues(operation, "success").Inc()
+	c.JSON(http.StatusOK, newUserResponse(user))
+}
+
+func (h *UserHandler) ChangePassword(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		userHandlerDuration.WithLabelValues("change_password").Observe(time.Since(start).Seconds())
+	}()
+
+	if !allowRequest(c, h.rateLimiter) {
+		userHandlerOperations.WithLabelValues("change_password", "rate_limited").Inc()
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "rate limit exceeded"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(repository.WithPrimary(c.Request.Context()), h.timeouts.Write)
+	defer cancel()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		userHandlerOperations.WithLabelValues("change_password", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "invalid ID format"})
+		return
+	}
+
+	// Check if user is changing their own password
+	authUserID, exists := GetAuthenticatedUserID(c)
+	if !exists || authUserID != uint(id) {
+		userHandlerOperations.WithLabelValues("change_password", "unauthorized").Inc()
+		respondError(c, &AppError{Status: http.StatusForbidden, Message: "unauthorized access"})
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		userHandlerOperations.WithLabelValues("change_password", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "invalid request format"})
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		userHandlerOperations.WithLabelValues("change_password", "failed").Inc()
+		respondError(c, validationError(err))
+		return
+	}
+
+	// The bcrypt checks and hashing run before taking the lock, so one
+	// password change doesn't stall every other user write
+	user, err := h.repo.GetByIDWithContext(ctx, uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			userHandlerOperations.WithLabelValues("change_password", "not_found").Inc()
+			respondError(c, &AppError{Status: http.StatusNotFound, Message: "user not found"})
+			return
+		}
+		logFailure(c, h.logger, err, "failed to get user for password change",
+			zap.Uint64("user_id", id),
+		)
+		userHandlerOperations.WithLabelValues("change_password", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to change password", Err: err})
+		return
+	}
+
+	if err := user.CheckPassword(req.OldPassword); err != nil {
+		requestLogger(c, h.logger).Warn("password change failed: invalid old password",
+			zap.Uint("user_id", user.ID),
+		)
+		userHandlerOperations.WithLabelValues("change_password", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusUnauthorized, Code: CodeInvalidCredentials, Message: "invalid old password"})
+		return
+	}
+
+	if err := h.passwordHistory.CheckReuse(ctx, user, req.NewPassword); err != nil {
+		if errors.Is(err, services.ErrPasswordReused) {
+			userHandlerOperations.WithLabelValues("change_password", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodePasswordReused, Message: "password was used recently"})
+			return
+		}
+		logFailure(c, h.logger, err, "failed to check password history",
+			zap.Uint("user_id", user.ID),
+		)
+		userHandlerOperations.WithLabelValues("change_password", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to change password", Err: err})
+		return
+	}
+
+	oldHash := user.Password
+	user.Password = req.NewPassword
+	if err := user.HashPassword(); err != nil {
+		logFailure(c, h.logger, err, "failed to hash password",
+			zap.Uint("user_id", user.ID),
+		)
+		userHandlerOperations.WithLabelValues("change_password", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to change password", Err: err})
+		return
+	}
+	// Only the new hash carries over to the row reloaded below
+	newHash, changedAt := user.Password, user.PasswordChangedAt
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Reload under the lock so a concurrent profile update isn't overwritten
+	current, err := h.repo.GetByIDWithContext(ctx, uint(id))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			userHandlerOperations.WithLabelValues("change_password", "not_found").Inc()
+			respondError(c, &AppError{Status: http.StatusNotFound, Message: "user not found"})
+			return
+		}
+		logFailure(c, h.logger, err, "failed to reload user for password change",
+			zap.Uint64("user_id", id),
+		)
+		userHandlerOperations.WithLabelValues("change_password", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to change password", Err: err})
+		return
+	}
+	if current.Password != oldHash {
+		userHandlerOperations.WithLabelValues("change_password", "conflict").Inc()
+		respondError(c, &AppError{Status: http.StatusConflict, Message: "password was changed by another request"})
+		return
+	}
+	current.Password, current.PasswordChangedAt = newHash, changedAt
+
+	if err := h.repo.UpdateWithContext(ctx, current); err != nil {
+		logFailure(c, h.logger, err, "failed to save new password",
+			zap.Uint("user_id", current.ID),
+		)
+		userHandlerOperations.WithLabelValues("change_password", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to change password", Err: err})
+		return
+	}
+
+	// The new password is already saved, so a failure here only weakens
+	// the reuse check for this one hash
+	if err := h.passwordHistory.Remember(ctx, current.ID, oldHash); err != nil {
+		logFailure(c, h.logger, err, "failed to record password history",
+			zap.Uint("user_id", current.ID),
+		)
+	}
+
+	h.audit.Record(withClientInfo(c, ctx), current.ID, models.AuthEventPasswordChange)
+
+	requestLogger(c, h.logger).Info("password changed",
+		zap.Uint("user_id", current.ID),
+	)
+
+	userHandlerOperations.WithLabelValues("change_password", "success").Inc()
+	c.JSON(http.StatusOK, gin.H{"message": "password changed"})
+}
+
+// List returns a page of users for support staff, optionally filtered by ?search=
+func (h *UserHandler) List(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		userHandlerDuration.WithLabelValues("list").Observe(time.Since(start).Seconds())
+	}()
+
+	if !allowRequest(c, h.rateLimiter) {
+		userHandlerOperations.WithLabelValues("list", "rate_limited").Inc()
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "rate limit exceeded"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Read)
+	defer cancel()
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		userHandlerOperations.WithLabelValues("list", "failed").Inc()
+		respondError(c, err)
+		return
+	}
+
+	users, total, err := h.repo.List(ctx, limit, offset, c.Query("search"))
+	if err != nil {
+		logFailure(c, h.logger, err, "failed to list users")
+		userHandlerOperations.WithLabelValues("list", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to list users", Err: err})
+		return
+	}
+
+	userHandlerOperations.WithLabelValues("list", "success").Inc()
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:   newUserResponses(users),
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// ListAuditEvents returns a page of a user's authentication events; admin only
+func (h *UserHandler) ListAuditEvents(c *gin.Context) {
+	start := time.Now()
+	defer func() {
+		userHandlerDuration.WithLabelValues("list_audit").Observe(time.Since(start).Seconds())
+	}()
+
+	if !allowRequest(c, h.rateLimiter) {
+		userHandlerOperations.WithLabelValues("list_audit", "rate_limited").Inc()
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "rate limit exceeded"})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Read)
+	defer cancel()
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		userHandlerOperations.WithLabelValues("list_audit", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "invalid ID format"})
+		return
+	}
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		userHandlerOperations.WithLabelValues("list_audit", "failed").Inc()
+		respondError(c, err)
+		return
+	}
+
+	events, total, err := h.audit.ListByUserID(ctx, uint(id), limit, offset)
+	if err != nil {
+		logFailure(c, h.logger, err, "failed to list audit events",
+			zap.Uint64("user_id", id),
+		)
+		userHandlerOperations.WithLabelValues("list_audit", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "failed to list audit events", Err: err})
+		return
+	}
+
+	userHandlerOperations.WithLabelValues("list_audit", "success").Inc()
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:   events,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
 }
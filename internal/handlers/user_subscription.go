@@ -2,11 +2,16 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
@@ -14,6 +19,8 @@ import (
 	"go.uber.org/zap"
 	"golang.org/x/time/rate"
 
+	"github.com/JorgeSaicoski/login-go/internal/events"
+	"github.com/JorgeSaicoski/login-go/internal/metrics"
 	"github.com/JorgeSaicoski/login-go/internal/models"
 	"github.com/JorgeSaicoski/login-go/internal/repository"
 )
@@ -39,8 +46,7 @@ var (
 )
 
 func init() {
-	prometheus.MustRegister(subscriptionOperations)
-	prometheus.MustRegister(subscriptionDuration)
+	metrics.Register(subscriptionOperations, subscriptionDuration)
 }
 
 type UserSubscriptionHandler struct {
@@ -48,41 +54,61 @@ type UserSubscriptionHandler struct {
 	mu          sync.RWMutex
 	logger      *zap.Logger
 	validator   *validator.Validate
-	rateLimiter *rate.Limiter
+	rateLimiter *IPRateLimiter
+	timeouts    Timeouts
+	events      *events.Broker
 }
 
-type HandlerError struct {
-	Status  int
-	Message string
-	Err     error
+type ChangePlanRequest struct {
+	SubscriptionID uint                    `json:"subscription_id" validate:"required"`
+	Type           models.SubscriptionType `json:"type" validate:"omitempty,subscriptiontype"`
 }
 
-func (e *HandlerError) Error() string {
-	if e.Err != nil {
-		return fmt.Sprintf("%s: %v", e.Message, e.Err)
-	}
-	return e.Message
+// Proration is the amount owed for the rest of the current term after a plan
+// change. A positive amount is a charge, a negative amount is a credit.
+type Proration struct {
+	OldPrice      float64 `json:"old_price"`
+	NewPrice      float64 `json:"new_price"`
+	RemainingDays int     `json:"remaining_days"`
+	Amount        float64 `json:"amount"`
+}
+
+type ChangePlanResponse struct {
+	Subscription UserSubscriptionResponse `json:"subscription"`
+	Proration    Proration                `json:"proration"`
 }
 
-func NewUserSubscriptionHandler(repo *repository.UserSubscriptionRepository, logger *zap.Logger) *UserSubscriptionHandler {
+func NewUserSubscriptionHandler(repo *repository.UserSubscriptionRepository, logger *zap.Logger, validate *validator.Validate, limit rate.Limit, burst int, timeouts Timeouts) *UserSubscriptionHandler {
 	return &UserSubscriptionHandler{
 		repo:        repo,
 		logger:      logger,
-		validator:   validator.New(),
-		rateLimiter: rate.NewLimiter(rate.Every(time.Second), 100), // 100 requests per second
+		validator:   validatorOrDefault(validate),
+		rateLimiter: NewIPRateLimiter(limit, burst, defaultLimiterTTL),
+		timeouts:    timeouts.withDefaults(),
 	}
 }
 
-// validateSubscriptionDates ensures dates are valid
+// validateSubscriptionDates ensures the end date is not before the start.
+// It is all an update checks, since an existing subscription's start date
+// is usually in the past.
 func (h *UserSubscriptionHandler) validateSubscriptionDates(start, end time.Time) error {
 	if end.Before(start) {
-		return &HandlerError{
+		return &AppError{
 			Status:  http.StatusBadRequest,
 			Message: "End date must be after start date",
 		}
 	}
+	return nil
+}
+
+// validateNewSubscriptionDates also rejects new subscriptions starting more
+// than a day in the past
+func (h *UserSubscriptionHandler) validateNewSubscriptionDates(start, end time.Time) error {
+	if err := h.validateSubscriptionDates(start, end); err != nil {
+		return err
+	}
 	if start.Before(time.Now().Add(-24 * time.Hour)) {
-		return &HandlerError{
+		return &AppError{
 			Status:  http.StatusBadRequest,
 			Message: "Start date cannot be in the past",
 		}
@@ -90,10 +116,53 @@ func (h *UserSubscriptionHandler) validateSubscriptionDates(start, end time.Time
 	return nil
 }
 
+// normalizeSubscriptionText trims and collapses whitespace in CompanyName
+// and Role, then rejects values that are too long or could carry markup
+// into other UIs. Role is further limited to letters, digits, spaces and
+// - _ . so it stays a label rather than free text.
+func (h *UserSubscriptionHandler) normalizeSubscriptionText(us *models.UserSubscription) error {
+	us.CompanyName = strings.Join(strings.Fields(us.CompanyName), " ")
+	us.Role = strings.Join(strings.Fields(us.Role), " ")
+
+	if err := checkSubscriptionText("company_name", us.CompanyName, models.MaxCompanyNameLength); err != nil {
+		return err
+	}
+	if err := checkSubscriptionText("role", us.Role, models.MaxSubscriptionRoleLength); err != nil {
+		return err
+	}
+	for _, r := range us.Role {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(" -_.", r) {
+			return &AppError{
+				Status:  http.StatusBadRequest,
+				Message: "role may only contain letters, digits, spaces and - _ .",
+			}
+		}
+	}
+	return nil
+}
+
+func checkSubscriptionText(field, value string, maxLen int) error {
+	if utf8.RuneCountInString(value) > maxLen {
+		return &AppError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("%s must be at most %d characters", field, maxLen),
+		}
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) || r == '<' || r == '>' {
+			return &AppError{
+				Status:  http.StatusBadRequest,
+				Message: fmt.Sprintf("%s contains invalid characters", field),
+			}
+		}
+	}
+	return nil
+}
+
 // validateSubscriptionType ensures type is valid
 func (h *UserSubscriptionHandler) validateSubscriptionType(subType models.SubscriptionType) error {
-	if subType != models.Individual && subType != models.Enterprise {
-		return &HandlerError{
+	if err := h.validator.Var(string(subType), "subscriptiontype"); err != nil {
+		return &AppError{
 			Status:  http.StatusBadRequest,
 			Message: "Invalid subscription type",
 		}
@@ -102,7 +171,7 @@ func (h *UserSubscriptionHandler) validateSubscriptionType(subType models.Subscr
 }
 
 func (h *UserSubscriptionHandler) Create(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(repository.WithPrimary(c.Request.Context()), h.timeouts.Write)
 	defer cancel()
 
 	start := time.Now()
@@ -111,30 +180,36 @@ func (h *UserSubscriptionHandler) Create(c *gin.Context) {
 	}()
 
 	// Rate limiting
-	if !h.rateLimiter.Allow() {
+	if !allowRequest(c, h.rateLimiter) {
 		subscriptionOperations.WithLabelValues("create", "rate_limited").Inc()
-		handleError(c, &HandlerError{Status: http.StatusTooManyRequests, Message: "Rate limit exceeded"})
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "Rate limit exceeded"})
 		return
 	}
 
 	userID, subscriptionID, err := h.parseUserAndSubscriptionID(c)
 	if err != nil {
 		subscriptionOperations.WithLabelValues("create", "failed").Inc()
-		handleError(c, err)
+		respondError(c, err)
 		return
 	}
 
 	var us models.UserSubscription
 	if err := c.ShouldBindJSON(&us); err != nil {
 		subscriptionOperations.WithLabelValues("create", "failed").Inc()
-		handleError(c, &HandlerError{Status: http.StatusBadRequest, Message: "Invalid request body", Err: err})
+		respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "Invalid request body", Err: err})
 		return
 	}
 
 	// Validate subscription
 	if err := h.validateSubscriptionType(us.Type); err != nil {
 		subscriptionOperations.WithLabelValues("create", "failed").Inc()
-		handleError(c, err)
+		respondError(c, err)
+		return
+	}
+
+	if err := h.normalizeSubscriptionText(&us); err != nil {
+		subscriptionOperations.WithLabelValues("create", "failed").Inc()
+		respondError(c, err)
 		return
 	}
 
@@ -155,33 +230,52 @@ func (h *UserSubscriptionHandler) Create(c *gin.Context) {
 	}
 
 	// Validate dates
-	if err := h.validateSubscriptionDates(us.StartDate, us.EndDate); err != nil {
+	if err := h.validateNewSubscriptionDates(us.StartDate, us.EndDate); err != nil {
 		subscriptionOperations.WithLabelValues("create", "failed").Inc()
-		handleError(c, err)
+		respondError(c, err)
 		return
 	}
 
 	// Create with context
 	if err := h.repo.CreateWithContext(ctx, &us); err != nil {
-		h.logger.Error("failed to create subscription",
+		if errors.Is(err, repository.ErrActiveSubscriptionExists) {
+			subscriptionOperations.WithLabelValues("create", "conflict").Inc()
+			respondError(c, &AppError{Status: http.StatusConflict, Code: CodeSubscriptionExists, Message: "User already has an active subscription to this plan"})
+			return
+		}
+		if errors.Is(err, repository.ErrSeatLimitReached) {
+			subscriptionOperations.WithLabelValues("create", "seat_limit").Inc()
+			respondError(c, &AppError{Status: http.StatusConflict, Code: CodeSeatLimitReached, Message: "No seats left on this plan for the company"})
+			return
+		}
+		if errors.Is(err, repository.ErrPlanNotFound) {
+			subscriptionOperations.WithLabelValues("create", "not_found").Inc()
+			respondError(c, &AppError{Status: http.StatusNotFound, Message: "Subscription plan not found"})
+			return
+		}
+		if errors.Is(err, repository.ErrInvalidInput) {
+			subscriptionOperations.WithLabelValues("create", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusBadRequest, Message: "Invalid subscription", Err: err})
+			return
+		}
+		logFailure(c, h.logger, err, "failed to create subscription",
 			zap.Uint("user_id", userID),
-			zap.Error(err),
 		)
 		subscriptionOperations.WithLabelValues("create", "failed").Inc()
-		handleError(c, &HandlerError{Status: http.StatusInternalServerError, Message: "Failed to create subscription", Err: err})
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "Failed to create subscription", Err: err})
 		return
 	}
 
-	h.logger.Info("subscription created",
+	requestLogger(c, h.logger).Info("subscription created",
 		zap.Uint("user_id", userID),
 		zap.Uint("subscription_id", subscriptionID),
 	)
 	subscriptionOperations.WithLabelValues("create", "success").Inc()
-	c.JSON(http.StatusCreated, us)
+	c.JSON(http.StatusCreated, newUserSubscriptionResponse(&us))
 }
 
 func (h *UserSubscriptionHandler) GetUserSubscriptions(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Second)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Read)
 	defer cancel()
 
 	start := time.Now()
@@ -189,37 +283,108 @@ func (h *UserSubscriptionHandler) GetUserSubscriptions(c *gin.Context) {
 		subscriptionDuration.WithLabelValues("get").Observe(time.Since(start).Seconds())
 	}()
 
-	userID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
 		subscriptionOperations.WithLabelValues("get", "failed").Inc()
-		handleError(c, &HandlerError{Status: http.StatusBadRequest, Message: "Invalid user ID"})
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "Invalid user ID"})
+		return
+	}
+
+	limit, offset, err := parsePagination(c)
+	if err != nil {
+		subscriptionOperations.WithLabelValues("get", "failed").Inc()
+		respondError(c, err)
+		return
+	}
+
+	filter, err := h.parseSubscriptionFilter(c)
+	if err != nil {
+		subscriptionOperations.WithLabelValues("get", "failed").Inc()
+		respondError(c, err)
+		return
+	}
+
+	expandPlan, err := parseExpandSubscription(c)
+	if err != nil {
+		subscriptionOperations.WithLabelValues("get", "failed").Inc()
+		respondError(c, err)
 		return
 	}
 
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
-	subscriptions, err := h.repo.GetByUserIDWithContext(ctx, uint(userID))
+	subscriptions, total, err := h.repo.GetByUserIDFilteredWithContext(ctx, uint(userID), filter, limit, offset)
 	if err != nil {
-		h.logger.Error("failed to get subscriptions",
+		logFailure(c, h.logger, err, "failed to get subscriptions",
 			zap.Uint64("user_id", userID),
-			zap.Error(err),
 		)
 		subscriptionOperations.WithLabelValues("get", "failed").Inc()
-		handleError(c, &HandlerError{Status: http.StatusInternalServerError, Message: "Failed to get subscriptions", Err: err})
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "Failed to get subscriptions", Err: err})
 		return
 	}
 
-	h.logger.Info("subscriptions retrieved",
+	requestLogger(c, h.logger).Info("subscriptions retrieved",
 		zap.Uint64("user_id", userID),
 		zap.Int("count", len(subscriptions)),
+		zap.Int64("total", total),
 	)
+	data := newUserSubscriptionResponses(subscriptions)
+	if !expandPlan {
+		data = withoutPlans(data)
+	}
+
 	subscriptionOperations.WithLabelValues("get", "success").Inc()
-	c.JSON(http.StatusOK, subscriptions)
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:   data,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// GetActiveUserSubscriptions returns only subscriptions that are active and not yet expired
+func (h *UserSubscriptionHandler) GetActiveUserSubscriptions(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Read)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		subscriptionDuration.WithLabelValues("get_active").Observe(time.Since(start).Seconds())
+	}()
+
+	if !allowRequest(c, h.rateLimiter) {
+		subscriptionOperations.WithLabelValues("get_active", "rate_limited").Inc()
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "Rate limit exceeded"})
+		return
+	}
+
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		subscriptionOperations.WithLabelValues("get_active", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "Invalid user ID"})
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	subscriptions, err := h.repo.GetActiveByUserIDWithContext(ctx, uint(userID))
+	if err != nil {
+		logFailure(c, h.logger, err, "failed to get active subscriptions",
+			zap.Uint64("user_id", userID),
+		)
+		subscriptionOperations.WithLabelValues("get_active", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "Failed to get active subscriptions", Err: err})
+		return
+	}
+
+	subscriptionOperations.WithLabelValues("get_active", "success").Inc()
+	c.JSON(http.StatusOK, newUserSubscriptionResponses(subscriptions))
 }
 
 func (h *UserSubscriptionHandler) UpdateUserSubscription(c *gin.Context) {
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(repository.WithPrimary(c.Request.Context()), h.timeouts.Write)
 	defer cancel()
 
 	start := time.Now()
@@ -227,50 +392,50 @@ func (h *UserSubscriptionHandler) UpdateUserSubscription(c *gin.Context) {
 		subscriptionDuration.WithLabelValues("update").Observe(time.Since(start).Seconds())
 	}()
 
-	if !h.rateLimiter.Allow() {
+	if !allowRequest(c, h.rateLimiter) {
 		subscriptionOperations.WithLabelValues("update", "rate_limited").Inc()
-		handleError(c, &HandlerError{Status: http.StatusTooManyRequests, Message: "Rate limit exceeded"})
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "Rate limit exceeded"})
 		return
 	}
 
 	userID, subscriptionID, err := h.parseUserAndSubscriptionID(c)
 	if err != nil {
 		subscriptionOperations.WithLabelValues("update", "failed").Inc()
-		handleError(c, err)
+		respondError(c, err)
 		return
 	}
 
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	currentUs, err := h.repo.GetByIDWithContext(ctx, subscriptionID)
+	currentUs, err := h.loadOwnedSubscription(c, ctx, userID, subscriptionID)
 	if err != nil {
-		subscriptionOperations.WithLabelValues("update", "failed").Inc()
-		handleError(c, &HandlerError{Status: http.StatusNotFound, Message: "User subscription not found"})
-		return
-	}
-
-	if currentUs.UserID != userID {
-		subscriptionOperations.WithLabelValues("update", "failed").Inc()
-		handleError(c, &HandlerError{Status: http.StatusForbidden, Message: "Subscription does not belong to specified user"})
+		subscriptionOperations.WithLabelValues("update", ownershipStatus(err)).Inc()
+		respondError(c, err)
 		return
 	}
 
 	var newUs models.UserSubscription
 	if err := c.ShouldBindJSON(&newUs); err != nil {
 		subscriptionOperations.WithLabelValues("update", "failed").Inc()
-		handleError(c, &HandlerError{Status: http.StatusBadRequest, Message: "Invalid request body", Err: err})
+		respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "Invalid request body", Err: err})
 		return
 	}
 
 	if newUs.Type != "" {
 		if err := h.validateSubscriptionType(newUs.Type); err != nil {
 			subscriptionOperations.WithLabelValues("update", "failed").Inc()
-			handleError(c, err)
+			respondError(c, err)
 			return
 		}
 	}
 
+	if err := h.normalizeSubscriptionText(&newUs); err != nil {
+		subscriptionOperations.WithLabelValues("update", "failed").Inc()
+		respondError(c, err)
+		return
+	}
+
 	// Update fields
 	h.updateSubscriptionFields(currentUs, &newUs)
 
@@ -278,45 +443,438 @@ func (h *UserSubscriptionHandler) UpdateUserSubscription(c *gin.Context) {
 	if !newUs.StartDate.IsZero() || !newUs.EndDate.IsZero() {
 		if err := h.validateSubscriptionDates(currentUs.StartDate, currentUs.EndDate); err != nil {
 			subscriptionOperations.WithLabelValues("update", "failed").Inc()
-			handleError(c, err)
+			respondError(c, err)
 			return
 		}
 	}
 
 	if err := h.repo.UpdateWithContext(ctx, currentUs); err != nil {
-		h.logger.Error("failed to update subscription",
+		if errors.Is(err, repository.ErrInvalidInput) {
+			subscriptionOperations.WithLabelValues("update", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusBadRequest, Message: "Invalid subscription", Err: err})
+			return
+		}
+		logFailure(c, h.logger, err, "failed to update subscription",
 			zap.Uint("user_id", userID),
 			zap.Uint("subscription_id", subscriptionID),
-			zap.Error(err),
 		)
 		subscriptionOperations.WithLabelValues("update", "failed").Inc()
-		handleError(c, &HandlerError{Status: http.StatusInternalServerError, Message: "Failed to update subscription", Err: err})
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "Failed to update subscription", Err: err})
 		return
 	}
 
-	h.logger.Info("subscription updated",
+	requestLogger(c, h.logger).Info("subscription updated",
 		zap.Uint("user_id", userID),
 		zap.Uint("subscription_id", subscriptionID),
 	)
 	subscriptionOperations.WithLabelValues("update", "success").Inc()
-	c.JSON(http.StatusOK, currentUs)
+	c.JSON(http.StatusOK, newUserSubscriptionResponse(currentUs))
+}
+
+func (h *UserSubscriptionHandler) Cancel(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(repository.WithPrimary(c.Request.Context()), h.timeouts.Write)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		subscriptionDuration.WithLabelValues("cancel").Observe(time.Since(start).Seconds())
+	}()
+
+	if !allowRequest(c, h.rateLimiter) {
+		subscriptionOperations.WithLabelValues("cancel", "rate_limited").Inc()
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "Rate limit exceeded"})
+		return
+	}
+
+	userID, subscriptionID, err := h.parseUserAndSubscriptionID(c)
+	if err != nil {
+		subscriptionOperations.WithLabelValues("cancel", "failed").Inc()
+		respondError(c, err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	currentUs, err := h.loadOwnedSubscription(c, ctx, userID, subscriptionID)
+	if err != nil {
+		subscriptionOperations.WithLabelValues("cancel", ownershipStatus(err)).Inc()
+		respondError(c, err)
+		return
+	}
+
+	if !currentUs.IsActive {
+		subscriptionOperations.WithLabelValues("cancel", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusConflict, Code: CodeAlreadyCancelled, Message: "Subscription is already cancelled"})
+		return
+	}
+
+	if err := h.repo.CancelSubscription(ctx, subscriptionID); err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			// Cancelled concurrently between the read above and this update
+			subscriptionOperations.WithLabelValues("cancel", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusConflict, Code: CodeAlreadyCancelled, Message: "Subscription is already cancelled"})
+			return
+		}
+		logFailure(c, h.logger, err, "failed to cancel subscription",
+			zap.Uint("user_id", userID),
+			zap.Uint("subscription_id", subscriptionID),
+		)
+		subscriptionOperations.WithLabelValues("cancel", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "Failed to cancel subscription", Err: err})
+		return
+	}
+
+	cancelledUs, err := h.repo.GetByIDWithContext(ctx, subscriptionID)
+	if err != nil {
+		logFailure(c, h.logger, err, "failed to reload cancelled subscription",
+			zap.Uint("subscription_id", subscriptionID),
+		)
+		subscriptionOperations.WithLabelValues("cancel", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "Failed to load cancelled subscription", Err: err})
+		return
+	}
+
+	requestLogger(c, h.logger).Info("subscription cancelled",
+		zap.Uint("user_id", userID),
+		zap.Uint("subscription_id", subscriptionID),
+	)
+	subscriptionOperations.WithLabelValues("cancel", "success").Inc()
+	c.JSON(http.StatusOK, newUserSubscriptionResponse(cancelledUs))
+}
+
+// CancelAll cancels every active subscription of the user, e.g. when the
+// account is being offboarded, and returns how many were cancelled
+func (h *UserSubscriptionHandler) CancelAll(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(repository.WithPrimary(c.Request.Context()), h.timeouts.Write)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		subscriptionDuration.WithLabelValues("cancel_all").Observe(time.Since(start).Seconds())
+	}()
+
+	if !allowRequest(c, h.rateLimiter) {
+		subscriptionOperations.WithLabelValues("cancel_all", "rate_limited").Inc()
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "Rate limit exceeded"})
+		return
+	}
+
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		subscriptionOperations.WithLabelValues("cancel_all", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "Invalid user ID"})
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cancelled, err := h.repo.CancelAllForUser(ctx, uint(userID))
+	if err != nil {
+		logFailure(c, h.logger, err, "failed to cancel user subscriptions",
+			zap.Uint64("user_id", userID),
+		)
+		subscriptionOperations.WithLabelValues("cancel_all", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "Failed to cancel subscriptions", Err: err})
+		return
+	}
+
+	requestLogger(c, h.logger).Info("user subscriptions cancelled",
+		zap.Uint64("user_id", userID),
+		zap.Int64("cancelled", cancelled),
+	)
+	subscriptionOperations.WithLabelValues("cancel_all", "success").Inc()
+	c.JSON(http.StatusOK, gin.H{"cancelled": cancelled})
+}
+
+// ChangePlan moves a user subscription to another plan for the rest of its
+// current term and returns the prorated price difference
+func (h *UserSubscriptionHandler) ChangePlan(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(repository.WithPrimary(c.Request.Context()), h.timeouts.Write)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		subscriptionDuration.WithLabelValues("change_plan").Observe(time.Since(start).Seconds())
+	}()
+
+	if !allowRequest(c, h.rateLimiter) {
+		subscriptionOperations.WithLabelValues("change_plan", "rate_limited").Inc()
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "Rate limit exceeded"})
+		return
+	}
+
+	userID, subscriptionID, err := h.parseUserAndSubscriptionID(c)
+	if err != nil {
+		subscriptionOperations.WithLabelValues("change_plan", "failed").Inc()
+		respondError(c, err)
+		return
+	}
+
+	var req ChangePlanRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		subscriptionOperations.WithLabelValues("change_plan", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Message: "Invalid request body", Err: err})
+		return
+	}
+
+	if err := h.validator.Struct(req); err != nil {
+		subscriptionOperations.WithLabelValues("change_plan", "failed").Inc()
+		respondError(c, validationError(err))
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	currentUs, err := h.loadOwnedSubscription(c, ctx, userID, subscriptionID)
+	if err != nil {
+		subscriptionOperations.WithLabelValues("change_plan", ownershipStatus(err)).Inc()
+		respondError(c, err)
+		return
+	}
+
+	if !currentUs.IsActive {
+		subscriptionOperations.WithLabelValues("change_plan", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusConflict, Code: CodeSubscriptionInactive, Message: "Subscription is not active"})
+		return
+	}
+
+	if req.SubscriptionID == currentUs.SubscriptionID {
+		subscriptionOperations.WithLabelValues("change_plan", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Code: CodeSamePlan, Message: "Subscription is already on this plan"})
+		return
+	}
+
+	subType := currentUs.Type
+	if req.Type != "" {
+		subType = req.Type
+	}
+
+	oldPlan := currentUs.Subscription
+	updatedUs, err := h.repo.ChangePlanWithContext(ctx, subscriptionID, req.SubscriptionID, subType)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrPlanNotFound):
+			subscriptionOperations.WithLabelValues("change_plan", "not_found").Inc()
+			respondError(c, &AppError{Status: http.StatusNotFound, Message: "Subscription plan not found"})
+		case errors.Is(err, repository.ErrNotFound):
+			subscriptionOperations.WithLabelValues("change_plan", "not_found").Inc()
+			respondError(c, &AppError{Status: http.StatusNotFound, Message: "User subscription not found"})
+		case errors.Is(err, repository.ErrInvalidInput):
+			subscriptionOperations.WithLabelValues("change_plan", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusBadRequest, Message: "Invalid subscription", Err: err})
+		default:
+			logFailure(c, h.logger, err, "failed to change subscription plan",
+				zap.Uint("user_id", userID),
+				zap.Uint("subscription_id", subscriptionID),
+			)
+			subscriptionOperations.WithLabelValues("change_plan", "failed").Inc()
+			respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "Failed to change subscription plan", Err: err})
+		}
+		return
+	}
+
+	proration := prorate(oldPlan.Price, updatedUs.Subscription.Price, updatedUs.StartDate, updatedUs.EndDate, time.Now())
+
+	requestLogger(c, h.logger).Info("subscription plan changed",
+		zap.Uint("user_id", userID),
+		zap.Uint("subscription_id", subscriptionID),
+		zap.Uint("old_plan_id", oldPlan.ID),
+		zap.Uint("new_plan_id", updatedUs.SubscriptionID),
+		zap.Float64("proration_amount", proration.Amount),
+	)
+	subscriptionOperations.WithLabelValues("change_plan", "success").Inc()
+	c.JSON(http.StatusOK, ChangePlanResponse{
+		Subscription: newUserSubscriptionResponse(updatedUs),
+		Proration:    proration,
+	})
+}
+
+// prorate charges or credits the price difference for the unused share of
+// the term, rounded to cents
+func prorate(oldPrice, newPrice float64, termStart, termEnd, now time.Time) Proration {
+	p := Proration{OldPrice: oldPrice, NewPrice: newPrice}
+
+	term := termEnd.Sub(termStart)
+	remaining := termEnd.Sub(now)
+	if term <= 0 || remaining <= 0 {
+		return p
+	}
+	if remaining > term {
+		remaining = term
+	}
+
+	p.RemainingDays = int(math.Ceil(remaining.Hours() / 24))
+	share := float64(remaining) / float64(term)
+	p.Amount = math.Round((newPrice-oldPrice)*share*100) / 100
+	return p
+}
+
+// GetSeats reports how many seats of the plan the company of an enterprise
+// user subscription is using, and how many are left.
+func (h *UserSubscriptionHandler) GetSeats(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), h.timeouts.Read)
+	defer cancel()
+
+	start := time.Now()
+	defer func() {
+		subscriptionDuration.WithLabelValues("get_seats").Observe(time.Since(start).Seconds())
+	}()
+
+	if !allowRequest(c, h.rateLimiter) {
+		subscriptionOperations.WithLabelValues("get_seats", "rate_limited").Inc()
+		respondError(c, &AppError{Status: http.StatusTooManyRequests, Message: "Rate limit exceeded"})
+		return
+	}
+
+	userID, subscriptionID, err := h.parseUserAndSubscriptionID(c)
+	if err != nil {
+		subscriptionOperations.WithLabelValues("get_seats", "failed").Inc()
+		respondError(c, err)
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	us, err := h.loadOwnedSubscription(c, ctx, userID, subscriptionID)
+	if err != nil {
+		subscriptionOperations.WithLabelValues("get_seats", ownershipStatus(err)).Inc()
+		respondError(c, err)
+		return
+	}
+
+	if us.Type != models.Enterprise {
+		subscriptionOperations.WithLabelValues("get_seats", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusBadRequest, Message: "Seats only apply to enterprise subscriptions"})
+		return
+	}
+
+	usage, err := h.repo.SeatUsageWithContext(ctx, us.SubscriptionID, us.CompanyName)
+	if err != nil {
+		if errors.Is(err, repository.ErrPlanNotFound) {
+			subscriptionOperations.WithLabelValues("get_seats", "not_found").Inc()
+			respondError(c, &AppError{Status: http.StatusNotFound, Message: "Subscription plan not found"})
+			return
+		}
+		subscriptionOperations.WithLabelValues("get_seats", "failed").Inc()
+		respondError(c, &AppError{Status: http.StatusInternalServerError, Message: "Failed to get seats", Err: err})
+		return
+	}
+
+	subscriptionOperations.WithLabelValues("get_seats", "success").Inc()
+	c.JSON(http.StatusOK, SeatsResponse{
+		SubscriptionID: us.SubscriptionID,
+		CompanyName:    us.CompanyName,
+		MaxSeats:       usage.MaxSeats,
+		Used:           usage.Used,
+		Remaining:      usage.Remaining(),
+	})
 }
 
 // Helper methods remain mostly unchanged but add context support
 func (h *UserSubscriptionHandler) parseUserAndSubscriptionID(c *gin.Context) (uint, uint, error) {
-	userID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err != nil {
-		return 0, 0, &HandlerError{Status: http.StatusBadRequest, Message: "Invalid user ID"}
+		return 0, 0, &AppError{Status: http.StatusBadRequest, Message: "Invalid user ID"}
 	}
 
 	subscriptionID, err := strconv.ParseUint(c.Param("subscriptionId"), 10, 32)
 	if err != nil {
-		return 0, 0, &HandlerError{Status: http.StatusBadRequest, Message: "Invalid subscription ID"}
+		return 0, 0, &AppError{Status: http.StatusBadRequest, Message: "Invalid subscription ID"}
 	}
 
 	return uint(userID), uint(subscriptionID), nil
 }
 
+// loadOwnedSubscription fetches a user subscription and checks that it
+// belongs to userID. Errors are AppErrors ready for respondError.
+func (h *UserSubscriptionHandler) loadOwnedSubscription(c *gin.Context, ctx context.Context, userID, subscriptionID uint) (*models.UserSubscription, error) {
+	us, err := h.repo.GetByIDWithContext(ctx, subscriptionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, &AppError{Status: http.StatusNotFound, Message: "User subscription not found"}
+		}
+		return nil, &AppError{Status: http.StatusInternalServerError, Message: "Failed to load subscription", Err: err}
+	}
+
+	if err := h.requireOwnership(c, us, userID); err != nil {
+		return nil, err
+	}
+	return us, nil
+}
+
+// requireOwnership returns a 403 AppError when us does not belong to
+// userID, and a 404 when there is no subscription at all.
+func (h *UserSubscriptionHandler) requireOwnership(c *gin.Context, us *models.UserSubscription, userID uint) error {
+	if us == nil {
+		return &AppError{Status: http.StatusNotFound, Message: "User subscription not found"}
+	}
+	if us.UserID != userID {
+		requestLogger(c, h.logger).Warn("subscription ownership mismatch",
+			zap.Uint("user_id", userID),
+			zap.Uint("subscription_id", us.ID),
+		)
+		return &AppError{Status: http.StatusForbidden, Message: "Subscription does not belong to specified user"}
+	}
+	return nil
+}
+
+// ownershipStatus maps an ownership check error to its metrics status label
+func ownershipStatus(err error) string {
+	var appErr *AppError
+	if errors.As(err, &appErr) && appErr.Status == http.StatusNotFound {
+		return "not_found"
+	}
+	return "failed"
+}
+
+// parseSubscriptionFilter reads the optional type and active query params
+func (h *UserSubscriptionHandler) parseSubscriptionFilter(c *gin.Context) (repository.UserSubscriptionFilter, error) {
+	var filter repository.UserSubscriptionFilter
+
+	if raw := c.Query("type"); raw != "" {
+		subType := models.SubscriptionType(raw)
+		if err := h.validateSubscriptionType(subType); err != nil {
+			return filter, err
+		}
+		filter.Type = subType
+	}
+
+	if raw := c.Query("active"); raw != "" {
+		active, err := strconv.ParseBool(raw)
+		if err != nil {
+			return filter, &AppError{Status: http.StatusBadRequest, Message: "Invalid active filter"}
+		}
+		filter.Active = &active
+	}
+
+	return filter, nil
+}
+
+// parseExpandSubscription reports whether the comma-separated expand query
+// param asks for the plan to be embedded in each row. Unknown values are
+// rejected so typos don't silently return the short form.
+func parseExpandSubscription(c *gin.Context) (bool, error) {
+	expand := false
+	for _, field := range strings.Split(c.Query("expand"), ",") {
+		switch strings.TrimSpace(field) {
+		case "":
+		case "subscription":
+			expand = true
+		default:
+			return false, &AppError{
+				Status:  http.StatusBadRequest,
+				Message: "Invalid expand",
+				Details: map[string]interface{}{"allowed": []string{"subscription"}},
+			}
+		}
+	}
+	return expand, nil
+}
+
 func (h *UserSubscriptionHandler) updateSubscriptionFields(current, new *models.UserSubscription) {
 	if new.Type != "" {
 		current.Type = new.Type
@@ -335,11 +893,3 @@ func (h *UserSubscriptionHandler) updateSubscriptionFields(current, new *models.
 	}
 	current.IsActive = new.IsActive
 }
-
-func handleError(c *gin.Context, err error) {
-	if handlerErr, ok := err.(*HandlerError); ok {
-		c.JSON(handlerErr.Status, gin.H{"error": handlerErr.Message})
-		return
-	}
-	c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
-}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+
+	"github.com/JorgeSaicoski/login-go/internal/models"
+	"github.com/JorgeSaicoski/login-go/internal/repository"
+	"github.com/JorgeSaicoski/login-go/internal/testutil"
+)
+
+func TestLoadOwnedSubscription(t *testing.T) {
+	db := testutil.NewDB(t)
+	h := NewUserSubscriptionHandler(repository.NewUserSubscriptionRepository(db, zap.NewNop()), zap.NewNop(), nil, rate.Inf, 1, Timeouts{})
+	alice := createTestUser(t, db, "alice")
+	bob := createTestUser(t, db, "bob")
+	us := createTestSubscription(t, db, alice)
+
+	tests := []struct {
+		name           string
+		userID         uint
+		subscriptionID uint
+		wantStatus     int
+	}{
+		{"owned", alice.ID, us.ID, 0},
+		{"not owned", bob.ID, us.ID, http.StatusForbidden},
+		{"not found", alice.ID, us.ID + 100, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.loadOwnedSubscription(newTestContext(), context.Background(), tt.userID, tt.subscriptionID)
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("err = %v, want nil", err)
+				}
+				if got.ID != us.ID {
+					t.Fatalf("got subscription %d, want %d", got.ID, us.ID)
+				}
+				return
+			}
+
+			var appErr *AppError
+			if !errors.As(err, &appErr) || appErr.Status != tt.wantStatus {
+				t.Fatalf("err = %v, want AppError with status %d", err, tt.wantStatus)
+			}
+			if got != nil {
+				t.Fatalf("returned subscription %d along with an error", got.ID)
+			}
+		})
+	}
+}
+
+func TestRequireOwnershipNilSubscription(t *testing.T) {
+	h := &UserSubscriptionHandler{logger: zap.NewNop()}
+	err := h.requireOwnership(newTestContext(), nil, 1)
+
+	var appErr *AppError
+	if !errors.As(err, &appErr) || appErr.Status != http.StatusNotFound {
+		t.Fatalf("err = %v, want a 404 AppError", err)
+	}
+	if ownershipStatus(err) != "not_found" {
+		t.Fatalf("ownershipStatus = %q, want not_found", ownershipStatus(err))
+	}
+}
+
+func TestNormalizeSubscriptionText(t *testing.T) {
+	h := &UserSubscriptionHandler{}
+
+	us := &models.UserSubscription{CompanyName: "  Acme \t Corp\n", Role: " billing   admin "}
+	if err := h.normalizeSubscriptionText(us); err != nil {
+		t.Fatalf("normalize: %v", err)
+	}
+	if us.CompanyName != "Acme Corp" || us.Role != "billing admin" {
+		t.Fatalf("got %q / %q, want collapsed whitespace", us.CompanyName, us.Role)
+	}
+
+	rejected := []struct {
+		name string
+		us   models.UserSubscription
+	}{
+		{"markup in company", models.UserSubscription{CompanyName: "<script>alert(1)</script>"}},
+		{"control character in company", models.UserSubscription{CompanyName: "Acme\x00Corp"}},
+		{"company too long", models.UserSubscription{CompanyName: strings.Repeat("a", models.MaxCompanyNameLength+1)}},
+		{"role too long", models.UserSubscription{Role: strings.Repeat("a", models.MaxSubscriptionRoleLength+1)}},
+		{"role outside allowlist", models.UserSubscription{Role: "admin;drop"}},
+		{"markup in role", models.UserSubscription{Role: "<b>admin</b>"}},
+	}
+	for _, tt := range rejected {
+		t.Run(tt.name, func(t *testing.T) {
+			us := tt.us
+			err := h.normalizeSubscriptionText(&us)
+			var appErr *AppError
+			if !errors.As(err, &appErr) || appErr.Status != http.StatusBadRequest {
+				t.Fatalf("err = %v, want a 400 AppError", err)
+			}
+		})
+	}
+
+	// Limits count characters, not bytes
+	us = &models.UserSubscription{CompanyName: strings.Repeat("é", models.MaxCompanyNameLength)}
+	if err := h.normalizeSubscriptionText(us); err != nil {
+		t.Fatalf("company at the limit in multi-byte characters: %v", err)
+	}
+}
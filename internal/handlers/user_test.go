@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+
+	"github.com/JorgeSaicoski/login-go/internal/models"
+	"github.com/JorgeSaicoski/login-go/internal/repository"
+	"github.com/JorgeSaicoski/login-go/internal/services"
+	"github.com/JorgeSaicoski/login-go/internal/testutil"
+)
+
+// recordingSender remembers who was sent a verification token
+type recordingSender struct {
+	sentTo []string
+}
+
+func (s *recordingSender) SendVerification(ctx context.Context, user *models.User, token string) error {
+	s.sentTo = append(s.sentTo, user.UsernameForLogin)
+	return nil
+}
+
+func (s *recordingSender) SendEmailChange(ctx context.Context, user *models.User, token string) error {
+	return nil
+}
+
+func TestBulkCreateIssuesVerificationTokens(t *testing.T) {
+	db := testutil.NewDB(t)
+	logger := zap.NewNop()
+	createTestUser(t, db, "existing")
+
+	userRepo := repository.NewUserRepository(db, logger)
+	sender := &recordingSender{}
+	verification := services.NewEmailVerificationService(userRepo, sender, logger, time.Hour)
+	h := NewUserHandler(userRepo, verification, nil, nil, logger, NewValidator(), rate.Inf, 1, Timeouts{})
+
+	body := `[
+		{"name": "Alice", "username": "alice", "email": "alice@example.com", "password": "Secret123"},
+		{"name": "Existing", "username": "existing", "email": "other@example.com", "password": "Secret123"},
+		{"name": "Weak", "username": "weak", "email": "weak@example.com", "password": "short"}
+	]`
+	gin.SetMode(gin.TestMode)
+	rec := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(rec)
+	c.Request = httptest.NewRequest(http.MethodPost, "/admin/users/bulk", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	h.BulkCreate(c)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", rec.Code, rec.Body.String())
+	}
+	if len(sender.sentTo) != 1 || sender.sentTo[0] != "alice" {
+		t.Fatalf("verification sent to %v, want only the created alice", sender.sentTo)
+	}
+
+	var alice models.User
+	if err := db.Where("username_for_login = ?", "alice").First(&alice).Error; err != nil {
+		t.Fatalf("load alice: %v", err)
+	}
+	if alice.VerificationToken == "" || alice.VerificationTokenExpiresAt == nil {
+		t.Fatal("no verification token stored for the imported user")
+	}
+}
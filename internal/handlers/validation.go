@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+
+	"github.com/JorgeSaicoski/login-go/internal/models"
+	"github.com/JorgeSaicoski/login-go/internal/services"
+)
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Tag     string `json:"tag"`
+	Message string `json:"message"`
+}
+
+// NewValidator returns the validator shared by the handlers. It reports
+// fields by their JSON name, so error details match the request body the
+// client sent, and registers the custom rules:
+//
+//   - strongpassword: the password satisfies services.DefaultPasswordPolicy
+//   - subscriptiontype: the value is a known models.SubscriptionType
+//
+// Building one is comparatively expensive, so create it once in main and
+// pass it to every handler.
+func NewValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name := strings.SplitN(field.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	// Registration only fails for empty tags or nil funcs
+	_ = v.RegisterValidation("strongpassword", func(fl validator.FieldLevel) bool {
+		return services.ValidatePasswordStrength(fl.Field().String()) == nil
+	})
+	_ = v.RegisterValidation("subscriptiontype", func(fl validator.FieldLevel) bool {
+		return models.SubscriptionType(fl.Field().String()).Valid()
+	})
+	return v
+}
+
+// validatorOrDefault lets handlers be built without a shared validator
+func validatorOrDefault(v *validator.Validate) *validator.Validate {
+	if v == nil {
+		return NewValidator()
+	}
+	return v
+}
+
+// onlyWeakPassword reports whether every field error in err is a
+// strongpassword failure, so it can keep the more specific weak_password code
+func onlyWeakPassword(err error) bool {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) || len(validationErrs) == 0 {
+		return false
+	}
+	for _, fe := range validationErrs {
+		if fe.Tag() != "strongpassword" {
+			return false
+		}
+	}
+	return true
+}
+
+// validationDetails converts a validator error into per-field details.
+// Errors that are not validation errors come back as a single entry.
+func validationDetails(err error) []FieldError {
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return []FieldError{{Message: err.Error()}}
+	}
+
+	details := make([]FieldError, 0, len(validationErrs))
+	for _, fe := range validationErrs {
+		details = append(details, FieldError{
+			Field:   fe.Field(),
+			Tag:     fe.Tag(),
+			Message: fieldErrorMessage(fe),
+		})
+	}
+	return details
+}
+
+func fieldErrorMessage(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return fmt.Sprintf("%s is required", fe.Field())
+	case "email":
+		return fmt.Sprintf("%s must be a valid email address", fe.Field())
+	case "min":
+		return fmt.Sprintf("%s must be at least %s characters", fe.Field(), fe.Param())
+	case "max":
+		return fmt.Sprintf("%s must be at most %s characters", fe.Field(), fe.Param())
+	case "strongpassword":
+		if err := services.ValidatePasswordStrength(fmt.Sprint(fe.Value())); err != nil {
+			return err.Error()
+		}
+		return fmt.Sprintf("%s is too weak", fe.Field())
+	case "subscriptiontype":
+		return fmt.Sprintf("%s must be one of %s, %s", fe.Field(), models.Individual, models.Enterprise)
+	default:
+		return fmt.Sprintf("%s failed %s validation", fe.Field(), fe.Tag())
+	}
+}
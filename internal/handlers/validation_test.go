@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/JorgeSaicoski/login-go/internal/models"
+	"github.com/JorgeSaicoski/login-go/internal/services"
+)
+
+func TestNewValidatorCustomRules(t *testing.T) {
+	type request struct {
+		Password string                  `json:"password" validate:"strongpassword"`
+		Type     models.SubscriptionType `json:"type" validate:"omitempty,subscriptiontype"`
+	}
+
+	tests := []struct {
+		name    string
+		req     request
+		wantTag string
+		wantMsg string
+	}{
+		{name: "valid", req: request{Password: "Secret123", Type: models.Enterprise}},
+		{name: "type omitted", req: request{Password: "Secret123"}},
+		{name: "too short", req: request{Password: "Se1"}, wantTag: "strongpassword", wantMsg: services.ErrPasswordTooShort.Error()},
+		{name: "no digit", req: request{Password: "SecretPass"}, wantTag: "strongpassword", wantMsg: services.ErrPasswordNoDigit.Error()},
+		{name: "unknown type", req: request{Password: "Secret123", Type: "family"}, wantTag: "subscriptiontype", wantMsg: "type must be one of individual, enterprise"},
+	}
+
+	v := NewValidator()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := v.Struct(tt.req)
+			if tt.wantTag == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			details := validationDetails(err)
+			if len(details) != 1 {
+				t.Fatalf("details = %+v, want one entry", details)
+			}
+			if details[0].Tag != tt.wantTag || details[0].Message != tt.wantMsg {
+				t.Fatalf("details = %+v, want tag %q message %q", details[0], tt.wantTag, tt.wantMsg)
+			}
+			if got := onlyWeakPassword(err); got != (tt.wantTag == "strongpassword") {
+				t.Fatalf("onlyWeakPassword = %v", got)
+			}
+		})
+	}
+}
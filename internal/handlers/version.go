@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"net/http"
+	"runtime"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JorgeSaicoski/login-go/internal/version"
+)
+
+type VersionHandler struct{}
+
+func NewVersionHandler() *VersionHandler {
+	return &VersionHandler{}
+}
+
+// Version reports the build that is running, to confirm a rollout landed
+func (h *VersionHandler) Version(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"version":    version.Version,
+		"commit":     version.Commit,
+		"build_time": version.BuildTime,
+		"go_version": runtime.Version(),
+	})
+}
@@ -0,0 +1,78 @@
+// Package metrics registers the service's Prometheus collectors without
+// panicking when a name is already taken, so the packages can be embedded
+// in a host application that has its own metrics.
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	mu         sync.Mutex
+	registerer prometheus.Registerer = prometheus.DefaultRegisterer
+	gatherer   prometheus.Gatherer   = prometheus.DefaultGatherer
+	collectors []prometheus.Collector
+	// registered holds the collectors this package actually added, so
+	// moving registries never unregisters a host's collector of the same name
+	registered = make(map[prometheus.Collector]bool)
+)
+
+// Register adds collectors to the current registry. A collector that is
+// already registered, by this package or by a host under the same name,
+// is skipped instead of panicking like prometheus.MustRegister.
+func Register(cs ...prometheus.Collector) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	collectors = append(collectors, cs...)
+	registerAll(registerer, cs)
+}
+
+// SetMetricsRegistry moves every collector registered so far, and any
+// registered later, to reg. Hosts call it at startup to keep the service's
+// metrics out of the default registry; /metrics then serves reg. It must
+// be called before the metrics route is set up.
+func SetMetricsRegistry(reg *prometheus.Registry) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, c := range collectors {
+		if registered[c] {
+			registerer.Unregister(c)
+			delete(registered, c)
+		}
+	}
+	registerer = reg
+	gatherer = reg
+	registerAll(registerer, collectors)
+}
+
+// Handler serves the metrics of the current registry
+func Handler() http.Handler {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if gatherer == prometheus.DefaultGatherer {
+		return promhttp.Handler()
+	}
+	return promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{})
+}
+
+func registerAll(reg prometheus.Registerer, cs []prometheus.Collector) {
+	for _, c := range cs {
+		if err := reg.Register(c); err != nil {
+			var already prometheus.AlreadyRegisteredError
+			if errors.As(err, &already) {
+				continue
+			}
+			// Invalid collectors are a programming error, as with MustRegister
+			panic(err)
+		}
+		registered[c] = true
+	}
+}
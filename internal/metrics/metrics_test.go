@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// useTestRegistry points the package at a fresh registry and restores the
+// previous state when the test ends.
+func useTestRegistry(t *testing.T) *prometheus.Registry {
+	t.Helper()
+
+	mu.Lock()
+	prevRegisterer, prevGatherer := registerer, gatherer
+	prevCollectors := collectors
+	prevRegistered := registered
+	registerer, gatherer = prometheus.NewRegistry(), prometheus.NewRegistry()
+	collectors = nil
+	registered = make(map[prometheus.Collector]bool)
+	mu.Unlock()
+
+	t.Cleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		registerer, gatherer = prevRegisterer, prevGatherer
+		collectors = prevCollectors
+		registered = prevRegistered
+	})
+
+	reg := prometheus.NewRegistry()
+	SetMetricsRegistry(reg)
+	return reg
+}
+
+func newTestCounter() prometheus.Counter {
+	return prometheus.NewCounter(prometheus.CounterOpts{Name: "test_events_total", Help: "Test events."})
+}
+
+func TestRegisterTwiceDoesNotPanic(t *testing.T) {
+	reg := useTestRegistry(t)
+
+	counter := newTestCounter()
+	Register(counter)
+	Register(counter)
+	// A different collector under the same name, as a second copy of the
+	// package or a host application would register
+	Register(newTestCounter())
+
+	counter.Inc()
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("gather: %v", err)
+	}
+	if len(families) != 1 || families[0].GetName() != "test_events_total" {
+		t.Fatalf("gathered %v, want one test_events_total family", families)
+	}
+}
+
+func TestRegisterSkipsHostCollector(t *testing.T) {
+	reg := useTestRegistry(t)
+
+	host := newTestCounter()
+	if err := reg.Register(host); err != nil {
+		t.Fatalf("host register: %v", err)
+	}
+	ours := newTestCounter()
+	Register(ours)
+
+	// Moving away must not take the host's collector with it
+	SetMetricsRegistry(prometheus.NewRegistry())
+	if err := reg.Register(host); err == nil {
+		t.Fatal("host collector was unregistered by SetMetricsRegistry")
+	}
+}
+
+func TestSetMetricsRegistryMovesCollectors(t *testing.T) {
+	first := useTestRegistry(t)
+
+	counter := newTestCounter()
+	Register(counter)
+	counter.Inc()
+
+	second := prometheus.NewRegistry()
+	SetMetricsRegistry(second)
+
+	if families, _ := first.Gather(); len(families) != 0 {
+		t.Fatalf("old registry still has %d families", len(families))
+	}
+	if families, _ := second.Gather(); len(families) != 1 {
+		t.Fatalf("new registry has %d families, want 1", len(families))
+	}
+
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "test_events_total 1") {
+		t.Fatalf("handler served %d:\n%s", rec.Code, rec.Body.String())
+	}
+}
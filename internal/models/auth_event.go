@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+type AuthEventType string
+
+const (
+	AuthEventLoginSuccess   AuthEventType = "login_success"
+	AuthEventLoginFailure   AuthEventType = "login_failure"
+	AuthEventLogout         AuthEventType = "logout"
+	AuthEventPasswordChange AuthEventType = "password_change"
+	AuthEventSessionRevoked AuthEventType = "session_revoked"
+)
+
+// AuthEvent is one entry in a user's authentication audit trail
+type AuthEvent struct {
+	ID        uint          `json:"id" gorm:"primaryKey"`
+	UserID    uint          `json:"user_id" gorm:"index"`
+	Event     AuthEventType `json:"event"`
+	IP        string        `json:"ip"`
+	UserAgent string        `json:"user_agent"`
+	CreatedAt time.Time     `json:"created_at" gorm:"index"`
+}
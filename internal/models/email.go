@@ -0,0 +1,49 @@
+package models
+
+import "strings"
+
+type emailProvider struct {
+	// canonicalDomain replaces aliases such as googlemail.com
+	canonicalDomain string
+	stripDots       bool
+}
+
+// emailProviders lists the providers whose "+tag" suffixes (and, for Gmail,
+// dots) are ignored when delivering mail.
+var emailProviders = map[string]emailProvider{
+	"gmail.com":      {canonicalDomain: "gmail.com", stripDots: true},
+	"googlemail.com": {canonicalDomain: "gmail.com", stripDots: true},
+	"outlook.com":    {canonicalDomain: "outlook.com"},
+	"hotmail.com":    {canonicalDomain: "hotmail.com"},
+	"live.com":       {canonicalDomain: "live.com"},
+	"icloud.com":     {canonicalDomain: "icloud.com"},
+	"me.com":         {canonicalDomain: "me.com"},
+	"fastmail.com":   {canonicalDomain: "fastmail.com"},
+	"protonmail.com": {canonicalDomain: "protonmail.com"},
+	"proton.me":      {canonicalDomain: "proton.me"},
+}
+
+// CanonicalizeEmail maps addresses that reach the same inbox onto one form,
+// e.g. "J.Doe+promo@googlemail.com" becomes "jdoe@gmail.com". Addresses at
+// providers not listed in emailProviders are only trimmed and lowercased.
+func CanonicalizeEmail(email string) string {
+	email = NormalizeIdentifier(email)
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return email
+	}
+
+	local, domain := email[:at], email[at+1:]
+	provider, ok := emailProviders[domain]
+	if !ok {
+		return email
+	}
+
+	if plus := strings.Index(local, "+"); plus >= 0 {
+		local = local[:plus]
+	}
+	if provider.stripDots {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + provider.canonicalDomain
+}
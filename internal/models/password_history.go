@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// PasswordHistory keeps a user's previous bcrypt hashes so old passwords
+// cannot be reused.
+type PasswordHistory struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	UserID       uint      `json:"user_id" gorm:"index"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// RefreshToken records an issued refresh token so it can be revoked before
+// it expires. Only the sha256 hash of the token is stored.
+type RefreshToken struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	TokenHash string    `json:"-" gorm:"uniqueIndex"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"index"`
+	Revoked   bool      `json:"revoked" gorm:"default:false"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -2,12 +2,16 @@ package models
 
 import "time"
 
+// Subscription is a plan users can be assigned to. MaxSeats caps the active
+// enterprise subscriptions per company on the plan; 0 means unlimited.
 type Subscription struct {
-	ID          uint               `json:"id" gorm:"primaryKey"`
-	Name        string             `json:"name"`
-	Description string             `json:"description"`
-	Price       float64            `json:"price"`
-	Users       []UserSubscription `json:"users" gorm:"foreignKey:SubscriptionID"`
-	CreatedAt   time.Time          `json:"created_at"`
-	UpdatedAt   time.Time          `json:"updated_at"`
+	ID           uint               `json:"id" gorm:"primaryKey"`
+	Name         string             `json:"name"`
+	Description  string             `json:"description"`
+	Price        float64            `json:"price"`
+	PeriodMonths int                `json:"period_months" gorm:"default:12"`
+	MaxSeats     int                `json:"max_seats" gorm:"not null;default:0"`
+	Users        []UserSubscription `json:"users" gorm:"foreignKey:SubscriptionID"`
+	CreatedAt    time.Time          `json:"created_at"`
+	UpdatedAt    time.Time          `json:"updated_at"`
 }
@@ -1,38 +1,130 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
+// User is an account. PendingEmail replaces Email once the EmailChangeToken
+// sent to it is confirmed; until then login and mail keep using Email.
+// PasswordChangedAt is nil for accounts created before it was tracked.
 type User struct {
-	ID               uint               `json:"id" gorm:"primaryKey"`
-	Name             string             `json:"name"`
-	UsernameForLogin string             `json:"username"`
-	Email            string             `json:"email"`
-	Password         string             `json:"-"`
-	Subscriptions    []UserSubscription `json:"subscriptions" gorm:"foreignKey:UserID"`
-	CreatedAt        time.Time          `json:"created_at"`
-	UpdatedAt        time.Time          `json:"updated_at"`
+	ID                         uint               `json:"id" gorm:"primaryKey"`
+	Name                       string             `json:"name"`
+	UsernameForLogin           string             `json:"username"`
+	Email                      string             `json:"email"`
+	CanonicalEmail             string             `json:"-" gorm:"index"`
+	Password                   string             `json:"-"`
+	PasswordChangedAt          *time.Time         `json:"-"`
+	Role                       string             `json:"role" gorm:"default:user"`
+	EmailVerified              bool               `json:"email_verified" gorm:"default:false"`
+	Active                     bool               `json:"active" gorm:"not null;default:true"`
+	VerificationToken          string             `json:"-" gorm:"index"`
+	VerificationTokenExpiresAt *time.Time         `json:"-"`
+	PendingEmail               string             `json:"pending_email,omitempty"`
+	EmailChangeToken           string             `json:"-" gorm:"index"`
+	EmailChangeTokenExpiresAt  *time.Time         `json:"-"`
+	Subscriptions              []UserSubscription `json:"subscriptions" gorm:"foreignKey:UserID"`
+	CreatedAt                  time.Time          `json:"created_at"`
+	UpdatedAt                  time.Time          `json:"updated_at"`
+	DeletedAt                  gorm.DeletedAt     `json:"-" gorm:"index"`
 }
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+type TokenType string
+
+const (
+	TokenTypeAccess  TokenType = "access"
+	TokenTypeRefresh TokenType = "refresh"
+)
+
+// Claims is the JWT payload. For access tokens "exp" is iat + TokenExpiry,
+// or iat + ExtendedTokenExpiry when the login asked to be remembered;
+// refresh tokens use RefreshTokenExpiry.
 type Claims struct {
-	UserID   uint   `json:"user_id"`
-	Username string `json:"username"`
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	TokenType TokenType `json:"token_type,omitempty"`
+	Roles     []string  `json:"roles,omitempty"`
+	// Extra holds optional claims such as tenant and plan for downstream
+	// services; kept under "ext" so they can't shadow registered claims
+	Extra map[string]interface{} `json:"ext,omitempty"`
+	// AuthTime is when the user last entered their credentials. Renewed
+	// tokens keep it, so renewal can't extend a session forever.
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
+	// SessionID is the Session the token was issued for, when sessions are
+	// tracked
+	SessionID uint `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
+// NormalizeIdentifier is the stored form of usernames and emails: trimmed
+// and lowercased, so uniqueness and lookups are case-insensitive.
+func NormalizeIdentifier(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+// Normalize puts the username and email in their stored form. The email is
+// kept as entered (lowercased) for sending; CanonicalEmail is only used for
+// uniqueness checks when canonicalization is enabled.
+func (u *User) Normalize() {
+	u.UsernameForLogin = NormalizeIdentifier(u.UsernameForLogin)
+	u.Email = NormalizeIdentifier(u.Email)
+	u.CanonicalEmail = CanonicalizeEmail(u.Email)
+}
+
+// BeforeSave makes sure every write path stores normalized identifiers
+func (u *User) BeforeSave(tx *gorm.DB) error {
+	u.Normalize()
+	return nil
+}
+
+// ClearPendingEmail drops a pending email change and its token
+func (u *User) ClearPendingEmail() {
+	u.PendingEmail = ""
+	u.EmailChangeToken = ""
+	u.EmailChangeTokenExpiresAt = nil
+}
+
+// HashPassword replaces the plaintext Password with its bcrypt hash and
+// stamps PasswordChangedAt, since it runs whenever a password is set
 func (u *User) HashPassword() error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return err
 	}
 	u.Password = string(hashedPassword)
+	now := time.Now()
+	u.PasswordChangedAt = &now
 	return nil
 }
 
+// PasswordExpiresAt is when the password becomes older than maxAge. Accounts
+// without PasswordChangedAt count from CreatedAt.
+func (u *User) PasswordExpiresAt(maxAge time.Duration) time.Time {
+	changedAt := u.CreatedAt
+	if u.PasswordChangedAt != nil {
+		changedAt = *u.PasswordChangedAt
+	}
+	return changedAt.Add(maxAge)
+}
+
 func (u *User) CheckPassword(password string) error {
 	return bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 }
+
+// Roles returns the roles to embed in the user's tokens
+func (u *User) Roles() []string {
+	if u.Role == "" {
+		return []string{RoleUser}
+	}
+	return []string{u.Role}
+}
@@ -1,7 +1,10 @@
 package models
 
 import (
+	"errors"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type SubscriptionType string
@@ -11,6 +14,33 @@ const (
 	Enterprise SubscriptionType = "enterprise"
 )
 
+// ErrInvalidSubscriptionType is returned when saving a subscription whose
+// Type is not one of the SubscriptionTypes
+var ErrInvalidSubscriptionType = errors.New("invalid subscription type")
+
+// SubscriptionTypes lists every valid SubscriptionType. The database
+// enforces the same list with a check constraint.
+func SubscriptionTypes() []SubscriptionType {
+	return []SubscriptionType{Individual, Enterprise}
+}
+
+// Valid reports whether t is one of the SubscriptionTypes. Matching is
+// exact, so "INDIVIDUAL" is not valid.
+func (t SubscriptionType) Valid() bool {
+	for _, valid := range SubscriptionTypes() {
+		if t == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// Length limits for the free-text fields of a UserSubscription, in characters
+const (
+	MaxCompanyNameLength      = 100
+	MaxSubscriptionRoleLength = 50
+)
+
 type UserSubscription struct {
 	ID             uint             `json:"id" gorm:"primaryKey"`
 	UserID         uint             `json:"user_id"`
@@ -23,6 +53,21 @@ type UserSubscription struct {
 	StartDate      time.Time        `json:"start_date"`
 	EndDate        time.Time        `json:"end_date"`
 	IsActive       bool             `json:"is_active"`
+	AutoRenew      bool             `json:"auto_renew"`
+	LastNotifiedAt *time.Time       `json:"last_notified_at,omitempty"`
 	CreatedAt      time.Time        `json:"created_at"`
 	UpdatedAt      time.Time        `json:"updated_at"`
+	// DeletedAt is set when the owning user is soft-deleted, so restoring
+	// the user brings the subscriptions back too
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// BeforeSave rejects unknown types before they reach the database. An empty
+// Type is let through because column updates run the hook on a zero model;
+// the check constraint still rejects it on insert.
+func (us *UserSubscription) BeforeSave(tx *gorm.DB) error {
+	if us.Type != "" && !us.Type.Valid() {
+		return ErrInvalidSubscriptionType
+	}
+	return nil
 }
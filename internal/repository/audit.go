@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/JorgeSaicoski/login-go/internal/logging"
+	"github.com/JorgeSaicoski/login-go/internal/models"
+)
+
+type AuditRepository struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+func NewAuditRepository(db *gorm.DB, logger *zap.Logger) *AuditRepository {
+	return &AuditRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *AuditRepository) Record(ctx context.Context, event *models.AuthEvent) error {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("record_auth_event").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "AuditRepository.Record")
+	defer span.End()
+
+	if event == nil {
+		dbOperations.WithLabelValues("record_auth_event", "failed").Inc()
+		return ErrInvalidInput
+	}
+
+	if err := r.db.WithContext(ctx).Create(event).Error; err != nil {
+		logging.FromContext(ctx, r.logger).Error("failed to record auth event",
+			zap.Error(err),
+			zap.Uint("user_id", event.UserID),
+			zap.String("event", string(event.Event)),
+		)
+		dbOperations.WithLabelValues("record_auth_event", "failed").Inc()
+		return fmt.Errorf("%w: %v", ErrDatabaseOperation, err)
+	}
+
+	dbOperations.WithLabelValues("record_auth_event", "success").Inc()
+	return nil
+}
+
+// ListByUserID returns a page of a user's events, newest first, and the total count
+func (r *AuditRepository) ListByUserID(ctx context.Context, userID uint, limit, offset int) ([]models.AuthEvent, int64, error) {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("list_auth_events").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "AuditRepository.ListByUserID")
+	defer span.End()
+
+	query := r.db.WithContext(ctx).Model(&models.AuthEvent{}).Where("user_id = ?", userID)
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logging.FromContext(ctx, r.logger).Error("failed to count auth events",
+			zap.Error(err),
+			zap.Uint("user_id", userID),
+		)
+		dbOperations.WithLabelValues("list_auth_events", "failed").Inc()
+		return nil, 0, fmt.Errorf("%w: %v", ErrDatabaseOperation, err)
+	}
+
+	var events []models.AuthEvent
+	if err := query.
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&events).Error; err != nil {
+		logging.FromContext(ctx, r.logger).Error("failed to list auth events",
+			zap.Error(err),
+			zap.Uint("user_id", userID),
+		)
+		dbOperations.WithLabelValues("list_auth_events", "failed").Inc()
+		return nil, 0, fmt.Errorf("%w: %v", ErrDatabaseOperation, err)
+	}
+
+	dbOperations.WithLabelValues("list_auth_events", "success").Inc()
+	return events, total, nil
+}
@@ -1,16 +1,135 @@
 package repository
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"strings"
 
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
 	"gorm.io/gorm"
+
+	"github.com/JorgeSaicoski/login-go/internal/logging"
+	"github.com/JorgeSaicoski/login-go/internal/models"
 )
 
-// GetByID fetches a record from the database by ID.
+// pgCheckViolation is the Postgres SQLSTATE for a failed check constraint
+const pgCheckViolation = "23514"
+
+// The generic helpers below take a db the caller has bound with
+// db.WithContext(ctx). A failed query returns dbError for that context, so
+// it matches ErrRequestCancelled when the context ended and
+// ErrDatabaseOperation otherwise.
+
+// GetByID fetches a record from the database by ID. A missing record
+// returns an error matching ErrNotFound.
 func GetByID[T any](db *gorm.DB, id uint) (*T, error) {
 	var entity T
 	if err := db.First(&entity, id).Error; err != nil {
-		return nil, errors.New("record not found")
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %v", ErrNotFound, err)
+		}
+		return nil, dbError(db.Statement.Context, err)
 	}
 	return &entity, nil
 }
+
+// Create inserts entity, returning ErrInvalidInput when it is nil.
+func Create[T any](db *gorm.DB, entity *T) error {
+	if entity == nil {
+		return ErrInvalidInput
+	}
+	if err := db.Create(entity).Error; err != nil {
+		return dbError(db.Statement.Context, err)
+	}
+	return nil
+}
+
+// DeleteByID deletes the record with the given ID, returning ErrNotFound
+// when nothing was deleted.
+func DeleteByID[T any](db *gorm.DB, id uint) error {
+	var entity T
+	result := db.Delete(&entity, id)
+	if result.Error != nil {
+		return dbError(db.Statement.Context, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// List returns one page of records ordered by ID, returning ErrInvalidInput
+// for a limit below 1 or a negative offset.
+func List[T any](db *gorm.DB, limit, offset int) ([]T, error) {
+	if limit <= 0 || offset < 0 {
+		return nil, ErrInvalidInput
+	}
+	var entities []T
+	if err := db.Order("id").Limit(limit).Offset(offset).Find(&entities).Error; err != nil {
+		return nil, dbError(db.Statement.Context, err)
+	}
+	return entities, nil
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// escapeLike escapes the LIKE wildcards in user-supplied search terms.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// contextError returns the context error behind a failed query, or nil when
+// the failure was not caused by the caller giving up. Drivers don't always
+// wrap the context error, so ctx itself is checked as well.
+func contextError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return context.Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return context.DeadlineExceeded
+	}
+	return ctx.Err()
+}
+
+// dbError wraps a failed query as ErrRequestCancelled when the caller's
+// context ended, keeping the context error matchable, and as
+// ErrDatabaseOperation otherwise.
+func dbError(ctx context.Context, err error) error {
+	if ctxErr := contextError(ctx, err); ctxErr != nil {
+		return fmt.Errorf("%w: %w", ErrRequestCancelled, ctxErr)
+	}
+	return fmt.Errorf("%w: %v", ErrDatabaseOperation, err)
+}
+
+// dbErrorStatus is the metrics status label for a failed query
+func dbErrorStatus(ctx context.Context, err error) string {
+	if contextError(ctx, err) != nil {
+		return "cancelled"
+	}
+	return "failed"
+}
+
+// logDBError logs a failed query at error level, or at warn when the
+// caller's context ended, since a client going away is not a fault to
+// alert on.
+func logDBError(ctx context.Context, logger *zap.Logger, err error, msg string, fields ...zap.Field) {
+	fields = append([]zap.Field{zap.Error(err)}, fields...)
+	if contextError(ctx, err) != nil {
+		logging.FromContext(ctx, logger).Warn(msg, fields...)
+		return
+	}
+	logging.FromContext(ctx, logger).Error(msg, fields...)
+}
+
+// isInvalidValue reports whether a write failed because a field value was
+// rejected, by a model hook or a database check constraint, rather than
+// because the database failed
+func isInvalidValue(err error) bool {
+	if errors.Is(err, models.ErrInvalidSubscriptionType) {
+		return true
+	}
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgCheckViolation
+}
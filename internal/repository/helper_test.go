@@ -0,0 +1,126 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/JorgeSaicoski/login-go/internal/models"
+	"github.com/JorgeSaicoski/login-go/internal/testutil"
+)
+
+func TestGetByID(t *testing.T) {
+	db := testutil.NewDB(t)
+	alice := createTestUser(t, db, "alice")
+
+	t.Run("found", func(t *testing.T) {
+		user, err := GetByID[models.User](db, alice.ID)
+		if err != nil {
+			t.Fatalf("GetByID: %v", err)
+		}
+		if user.UsernameForLogin != "alice" {
+			t.Fatalf("got user %q, want alice", user.UsernameForLogin)
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		_, err := GetByID[models.User](db, alice.ID+1)
+		if !errors.Is(err, ErrNotFound) {
+			t.Fatalf("err = %v, want ErrNotFound", err)
+		}
+		if errors.Is(err, ErrDatabaseOperation) {
+			t.Fatalf("not found error %v also matches ErrDatabaseOperation", err)
+		}
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		// No table is migrated for this type, so the query itself fails
+		type unmigrated struct{ ID uint }
+		_, err := GetByID[unmigrated](db, 1)
+		if !errors.Is(err, ErrDatabaseOperation) {
+			t.Fatalf("err = %v, want ErrDatabaseOperation", err)
+		}
+		if errors.Is(err, ErrNotFound) {
+			t.Fatalf("database error %v also matches ErrNotFound", err)
+		}
+	})
+}
+
+func TestCreate(t *testing.T) {
+	db := testutil.NewDB(t)
+
+	if err := Create[models.Subscription](db, nil); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("nil entity: err = %v, want ErrInvalidInput", err)
+	}
+
+	plan := &models.Subscription{Name: "basic", PeriodMonths: 1}
+	if err := Create(db, plan); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if plan.ID == 0 {
+		t.Fatal("Create did not set the ID")
+	}
+
+	type unmigrated struct{ ID uint }
+	if err := Create(db, &unmigrated{}); !errors.Is(err, ErrDatabaseOperation) {
+		t.Fatalf("database error: err = %v, want ErrDatabaseOperation", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := Create(db.WithContext(ctx), &models.Subscription{Name: "pro", PeriodMonths: 1})
+	if !errors.Is(err, ErrRequestCancelled) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled context: err = %v, want ErrRequestCancelled", err)
+	}
+}
+
+func TestDeleteByID(t *testing.T) {
+	db := testutil.NewDB(t)
+	alice := createTestUser(t, db, "alice")
+
+	if err := DeleteByID[models.User](db, alice.ID); err != nil {
+		t.Fatalf("DeleteByID: %v", err)
+	}
+	if _, err := GetByID[models.User](db, alice.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("deleted user still found: %v", err)
+	}
+
+	// Nothing left to delete, whether already deleted or never there
+	for _, id := range []uint{alice.ID, alice.ID + 1} {
+		if err := DeleteByID[models.User](db, id); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("delete %d: err = %v, want ErrNotFound", id, err)
+		}
+	}
+
+	type unmigrated struct{ ID uint }
+	if err := DeleteByID[unmigrated](db, 1); !errors.Is(err, ErrDatabaseOperation) {
+		t.Fatalf("database error: err = %v, want ErrDatabaseOperation", err)
+	}
+}
+
+func TestList(t *testing.T) {
+	db := testutil.NewDB(t)
+	var ids []uint
+	for _, name := range []string{"alice", "bob", "carol"} {
+		ids = append(ids, createTestUser(t, db, name).ID)
+	}
+
+	users, err := List[models.User](db, 2, 1)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(users) != 2 || users[0].ID != ids[1] || users[1].ID != ids[2] {
+		t.Fatalf("got %d users starting at %v, want ids %v", len(users), users, ids[1:])
+	}
+
+	for _, page := range [][2]int{{0, 0}, {-1, 0}, {10, -1}} {
+		if _, err := List[models.User](db, page[0], page[1]); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("limit %d offset %d: err = %v, want ErrInvalidInput", page[0], page[1], err)
+		}
+	}
+
+	type unmigrated struct{ ID uint }
+	if _, err := List[unmigrated](db, 10, 0); !errors.Is(err, ErrDatabaseOperation) {
+		t.Fatalf("database error: err = %v, want ErrDatabaseOperation", err)
+	}
+}
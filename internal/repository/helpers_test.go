@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/JorgeSaicoski/login-go/internal/models"
+)
+
+// createTestUser stores an active user directly, bypassing the repository
+func createTestUser(t *testing.T, db *gorm.DB, username string) *models.User {
+	t.Helper()
+	user := &models.User{
+		Name:             username,
+		UsernameForLogin: username,
+		Email:            username + "@example.com",
+		Password:         "hash",
+		Active:           true,
+	}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func createTestPlan(t *testing.T, db *gorm.DB, name string) *models.Subscription {
+	t.Helper()
+	plan := &models.Subscription{Name: name, Price: 10, PeriodMonths: 1}
+	if err := db.Create(plan).Error; err != nil {
+		t.Fatalf("create plan: %v", err)
+	}
+	return plan
+}
+
+// createTestSubscription assigns plan to user for a month from start
+func createTestSubscription(t *testing.T, db *gorm.DB, user *models.User, plan *models.Subscription, start time.Time, active bool) *models.UserSubscription {
+	t.Helper()
+	us := &models.UserSubscription{
+		UserID:         user.ID,
+		SubscriptionID: plan.ID,
+		Type:           models.Individual,
+		Role:           "owner",
+		StartDate:      start,
+		EndDate:        start.AddDate(0, 1, 0),
+		IsActive:       active,
+	}
+	if err := db.Create(us).Error; err != nil {
+		t.Fatalf("create subscription: %v", err)
+	}
+	return us
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/JorgeSaicoski/login-go/internal/logging"
+	"github.com/JorgeSaicoski/login-go/internal/models"
+)
+
+type PasswordHistoryRepository struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+func NewPasswordHistoryRepository(db *gorm.DB, logger *zap.Logger) *PasswordHistoryRepository {
+	return &PasswordHistoryRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+// RecentWithContext returns up to limit of the user's previous hashes, newest first
+func (r *PasswordHistoryRepository) RecentWithContext(ctx context.Context, userID uint, limit int) ([]models.PasswordHistory, error) {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("get_password_history").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "PasswordHistoryRepository.RecentWithContext")
+	defer span.End()
+
+	var history []models.PasswordHistory
+	err := r.db.WithContext(ctx).
+		Where("user_id = ?", userID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Find(&history).Error
+	if err != nil {
+		logging.FromContext(ctx, r.logger).Error("failed to get password history",
+			zap.Error(err),
+			zap.Uint("user_id", userID),
+		)
+		dbOperations.WithLabelValues("get_password_history", "failed").Inc()
+		return nil, fmt.Errorf("%w: %v", ErrDatabaseOperation, err)
+	}
+
+	dbOperations.WithLabelValues("get_password_history", "success").Inc()
+	return history, nil
+}
+
+// AddWithContext stores hash as the user's most recent previous password
+// and deletes all but the newest keep entries.
+func (r *PasswordHistoryRepository) AddWithContext(ctx context.Context, userID uint, hash string, keep int) error {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("add_password_history").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "PasswordHistoryRepository.AddWithContext")
+	defer span.End()
+
+	if hash == "" || keep <= 0 {
+		dbOperations.WithLabelValues("add_password_history", "failed").Inc()
+		return ErrInvalidInput
+	}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		entry := &models.PasswordHistory{UserID: userID, PasswordHash: hash}
+		if err := tx.Create(entry).Error; err != nil {
+			return err
+		}
+
+		keepIDs := tx.Model(&models.PasswordHistory{}).
+			Select("id").
+			Where("user_id = ?", userID).
+			Order("created_at DESC, id DESC").
+			Limit(keep)
+		return tx.Where("user_id = ? AND id NOT IN (?)", userID, keepIDs).
+			Delete(&models.PasswordHistory{}).Error
+	})
+	if err != nil {
+		logging.FromContext(ctx, r.logger).Error("failed to add password history",
+			zap.Error(err),
+			zap.Uint("user_id", userID),
+		)
+		dbOperations.WithLabelValues("add_password_history", "failed").Inc()
+		return fmt.Errorf("%w: %v", ErrDatabaseOperation, err)
+	}
+
+	dbOperations.WithLabelValues("add_password_history", "success").Inc()
+	return nil
+}
@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/JorgeSaicoski/login-go/internal/logging"
+	"github.com/JorgeSaicoski/login-go/internal/models"
+)
+
+type RefreshTokenRepository struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+func NewRefreshTokenRepository(db *gorm.DB, logger *zap.Logger) *RefreshTokenRepository {
+	return &RefreshTokenRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *RefreshTokenRepository) CreateWithContext(ctx context.Context, token *models.RefreshToken) error {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("create_refresh_token").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "RefreshTokenRepository.CreateWithContext")
+	defer span.End()
+
+	if token == nil || token.TokenHash == "" {
+		dbOperations.WithLabelValues("create_refresh_token", "failed").Inc()
+		return ErrInvalidInput
+	}
+
+	if err := r.db.WithContext(ctx).Create(token).Error; err != nil {
+		logging.FromContext(ctx, r.logger).Error("failed to store refresh token",
+			zap.Error(err),
+			zap.Uint("user_id", token.UserID),
+		)
+		dbOperations.WithLabelValues("create_refresh_token", "failed").Inc()
+		return fmt.Errorf("%w: %v", ErrDatabaseOperation, err)
+	}
+
+	dbOperations.WithLabelValues("create_refresh_token", "success").Inc()
+	return nil
+}
+
+func (r *RefreshTokenRepository) GetByHashWithContext(ctx context.Context, tokenHash string) (*models.RefreshToken, error) {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("get_refresh_token").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "RefreshTokenRepository.GetByHashWithContext")
+	defer span.End()
+
+	var token models.RefreshToken
+	err := r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).First(&token).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			dbOperations.WithLabelValues("get_refresh_token", "not_found").Inc()
+			return nil, ErrNotFound
+		}
+		logging.FromContext(ctx, r.logger).Error("failed to get refresh token",
+			zap.Error(err),
+		)
+		dbOperations.WithLabelValues("get_refresh_token", "failed").Inc()
+		return nil, fmt.Errorf("%w: %v", ErrDatabaseOperation, err)
+	}
+
+	dbOperations.WithLabelValues("get_refresh_token", "success").Inc()
+	return &token, nil
+}
+
+// RevokeWithContext marks one refresh token as revoked. Revoking an unknown
+// or already revoked token is not an error.
+func (r *RefreshTokenRepository) RevokeWithContext(ctx context.Context, tokenHash string) error {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("revoke_refresh_token").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "RefreshTokenRepository.RevokeWithContext")
+	defer span.End()
+
+	err := r.db.WithContext(ctx).
+		Model(&models.RefreshToken{}).
+		Where("token_hash = ? AND revoked = ?", tokenHash, false).
+		Update("revoked", true).Error
+	if err != nil {
+		logging.FromContext(ctx, r.logger).Error("failed to revoke refresh token",
+			zap.Error(err),
+		)
+		dbOperations.WithLabelValues("revoke_refresh_token", "failed").Inc()
+		return fmt.Errorf("%w: %v", ErrDatabaseOperation, err)
+	}
+
+	dbOperations.WithLabelValues("revoke_refresh_token", "success").Inc()
+	return nil
+}
+
+// RevokeAllForUserWithContext revokes every outstanding refresh token of a
+// user and returns how many were revoked.
+func (r *RefreshTokenRepository) RevokeAllForUserWithContext(ctx context.Context, userID uint) (int64, error) {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("revoke_user_refresh_tokens").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "RefreshTokenRepository.RevokeAllForUserWithContext")
+	defer span.End()
+
+	result := r.db.WithContext(ctx).
+		Model(&models.RefreshToken{}).
+		Where("user_id = ? AND revoked = ?", userID, false).
+		Update("revoked", true)
+	if result.Error != nil {
+		logging.FromContext(ctx, r.logger).Error("failed to revoke user refresh tokens",
+			zap.Error(result.Error),
+			zap.Uint("user_id", userID),
+		)
+		dbOperations.WithLabelValues("revoke_user_refresh_tokens", "failed").Inc()
+		return 0, fmt.Errorf("%w: %v", ErrDatabaseOperation, result.Error)
+	}
+
+	dbOperations.WithLabelValues("revoke_user_refresh_tokens", "success").Inc()
+	return result.RowsAffected, nil
+}
+
+// DeleteExpiredWithContext removes refresh tokens that expired by now,
+// revoked or not, since they can no longer be used either way. It returns
+// how many were removed.
+func (r *RefreshTokenRepository) DeleteExpiredWithContext(ctx context.Context, now time.Time) (int64, error) {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("delete_expired_refresh_tokens").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "RefreshTokenRepository.DeleteExpiredWithContext")
+	defer span.End()
+
+	result := r.db.WithContext(ctx).
+		Where("expires_at <= ?", now).
+		Delete(&models.RefreshToken{})
+	if result.Error != nil {
+		logging.FromContext(ctx, r.logger).Error("failed to delete expired refresh tokens",
+			zap.Error(result.Error),
+		)
+		dbOperations.WithLabelValues("delete_expired_refresh_tokens", "failed").Inc()
+		return 0, fmt.Errorf("%w: %v", ErrDatabaseOperation, result.Error)
+	}
+
+	dbOperations.WithLabelValues("delete_expired_refresh_tokens", "success").Inc()
+	return result.RowsAffected, nil
+}
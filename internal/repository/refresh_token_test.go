@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/JorgeSaicoski/login-go/internal/models"
+	"github.com/JorgeSaicoski/login-go/internal/testutil"
+)
+
+func TestRefreshTokenDeleteExpired(t *testing.T) {
+	db := testutil.NewDB(t)
+	repo := NewRefreshTokenRepository(db, zap.NewNop())
+	user := createTestUser(t, db, "alice")
+	now := time.Now()
+
+	tokens := []models.RefreshToken{
+		{TokenHash: "expired", UserID: user.ID, ExpiresAt: now.Add(-time.Hour)},
+		{TokenHash: "expired-revoked", UserID: user.ID, ExpiresAt: now.Add(-time.Minute), Revoked: true},
+		{TokenHash: "live", UserID: user.ID, ExpiresAt: now.Add(time.Hour)},
+		{TokenHash: "live-revoked", UserID: user.ID, ExpiresAt: now.Add(time.Hour), Revoked: true},
+	}
+	if err := db.Create(&tokens).Error; err != nil {
+		t.Fatalf("create tokens: %v", err)
+	}
+
+	removed, err := repo.DeleteExpiredWithContext(context.Background(), now)
+	if err != nil {
+		t.Fatalf("DeleteExpiredWithContext: %v", err)
+	}
+	if removed != 2 {
+		t.Fatalf("removed %d tokens, want 2", removed)
+	}
+
+	var left []string
+	if err := db.Model(&models.RefreshToken{}).Order("token_hash").Pluck("token_hash", &left).Error; err != nil {
+		t.Fatalf("list tokens: %v", err)
+	}
+	if len(left) != 2 || left[0] != "live" || left[1] != "live-revoked" {
+		t.Fatalf("tokens left = %v, want [live live-revoked]", left)
+	}
+}
@@ -0,0 +1,27 @@
+package repository
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+type primaryKey struct{}
+
+// WithPrimary marks ctx so queries made with it read from the primary even
+// when a read replica is configured. Handlers that read a row back after
+// writing it, or read it in order to write it, use this to avoid replica lag.
+func WithPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+// withContext is db.WithContext(ctx), pinned to the primary when ctx was
+// marked by WithPrimary. Without a replica the clause has no effect.
+func withContext(db *gorm.DB, ctx context.Context) *gorm.DB {
+	db = db.WithContext(ctx)
+	if primary, _ := ctx.Value(primaryKey{}).(bool); primary {
+		return db.Clauses(dbresolver.Write)
+	}
+	return db
+}
@@ -0,0 +1,204 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/JorgeSaicoski/login-go/internal/models"
+)
+
+type SessionRepository struct {
+	db     *gorm.DB
+	logger *zap.Logger
+}
+
+func NewSessionRepository(db *gorm.DB, logger *zap.Logger) *SessionRepository {
+	return &SessionRepository{
+		db:     db,
+		logger: logger,
+	}
+}
+
+func (r *SessionRepository) CreateWithContext(ctx context.Context, session *models.Session) error {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("create_session").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "SessionRepository.CreateWithContext")
+	defer span.End()
+
+	if session == nil || session.UserID == 0 {
+		dbOperations.WithLabelValues("create_session", "failed").Inc()
+		return ErrInvalidInput
+	}
+
+	if err := r.db.WithContext(ctx).Create(session).Error; err != nil {
+		logDBError(ctx, r.logger, err, "failed to create session",
+			zap.Uint("user_id", session.UserID),
+		)
+		dbOperations.WithLabelValues("create_session", dbErrorStatus(ctx, err)).Inc()
+		return dbError(ctx, err)
+	}
+
+	dbOperations.WithLabelValues("create_session", "success").Inc()
+	return nil
+}
+
+func (r *SessionRepository) GetByIDWithContext(ctx context.Context, id uint) (*models.Session, error) {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("get_session").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "SessionRepository.GetByIDWithContext")
+	defer span.End()
+
+	var session models.Session
+	if err := r.db.WithContext(ctx).First(&session, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			dbOperations.WithLabelValues("get_session", "not_found").Inc()
+			return nil, ErrNotFound
+		}
+		logDBError(ctx, r.logger, err, "failed to get session",
+			zap.Uint("id", id),
+		)
+		dbOperations.WithLabelValues("get_session", dbErrorStatus(ctx, err)).Inc()
+		return nil, dbError(ctx, err)
+	}
+
+	dbOperations.WithLabelValues("get_session", "success").Inc()
+	return &session, nil
+}
+
+// ListActiveByUserWithContext returns the user's sessions that are neither
+// revoked nor expired at now, most recently used first.
+func (r *SessionRepository) ListActiveByUserWithContext(ctx context.Context, userID uint, now time.Time) ([]models.Session, error) {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("list_sessions").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "SessionRepository.ListActiveByUserWithContext")
+	defer span.End()
+
+	var sessions []models.Session
+	if err := r.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error; err != nil {
+		logDBError(ctx, r.logger, err, "failed to list sessions",
+			zap.Uint("user_id", userID),
+		)
+		dbOperations.WithLabelValues("list_sessions", dbErrorStatus(ctx, err)).Inc()
+		return nil, dbError(ctx, err)
+	}
+
+	dbOperations.WithLabelValues("list_sessions", "success").Inc()
+	return sessions, nil
+}
+
+// TouchWithContext sets the session's last-seen time to at
+func (r *SessionRepository) TouchWithContext(ctx context.Context, id uint, at time.Time) error {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("touch_session").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "SessionRepository.TouchWithContext")
+	defer span.End()
+
+	if err := r.db.WithContext(ctx).
+		Model(&models.Session{}).
+		Where("id = ?", id).
+		Update("last_seen_at", at).Error; err != nil {
+		logDBError(ctx, r.logger, err, "failed to update session last seen",
+			zap.Uint("id", id),
+		)
+		dbOperations.WithLabelValues("touch_session", dbErrorStatus(ctx, err)).Inc()
+		return dbError(ctx, err)
+	}
+
+	dbOperations.WithLabelValues("touch_session", "success").Inc()
+	return nil
+}
+
+// RevokeWithContext revokes session id of userID. It returns ErrNotFound if
+// the user has no such session or it was already revoked.
+func (r *SessionRepository) RevokeWithContext(ctx context.Context, userID, id uint) error {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("revoke_session").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "SessionRepository.RevokeWithContext")
+	defer span.End()
+
+	result := r.db.WithContext(ctx).
+		Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		logDBError(ctx, r.logger, result.Error, "failed to revoke session",
+			zap.Uint("id", id),
+			zap.Uint("user_id", userID),
+		)
+		dbOperations.WithLabelValues("revoke_session", dbErrorStatus(ctx, result.Error)).Inc()
+		return dbError(ctx, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		dbOperations.WithLabelValues("revoke_session", "not_found").Inc()
+		return ErrNotFound
+	}
+
+	dbOperations.WithLabelValues("revoke_session", "success").Inc()
+	return nil
+}
+
+// RevokeAllForUserWithContext revokes every open session of a user and
+// returns how many were revoked.
+func (r *SessionRepository) RevokeAllForUserWithContext(ctx context.Context, userID uint) (int64, error) {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("revoke_user_sessions").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "SessionRepository.RevokeAllForUserWithContext")
+	defer span.End()
+
+	result := r.db.WithContext(ctx).
+		Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		logDBError(ctx, r.logger, result.Error, "failed to revoke user sessions",
+			zap.Uint("user_id", userID),
+		)
+		dbOperations.WithLabelValues("revoke_user_sessions", dbErrorStatus(ctx, result.Error)).Inc()
+		return 0, dbError(ctx, result.Error)
+	}
+
+	dbOperations.WithLabelValues("revoke_user_sessions", "success").Inc()
+	return result.RowsAffected, nil
+}
+
+// DeleteExpiredWithContext removes sessions that expired by now, revoked or
+// not, and returns how many were removed.
+func (r *SessionRepository) DeleteExpiredWithContext(ctx context.Context, now time.Time) (int64, error) {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("delete_expired_sessions").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "SessionRepository.DeleteExpiredWithContext")
+	defer span.End()
+
+	result := r.db.WithContext(ctx).
+		Where("expires_at <= ?", now).
+		Delete(&models.Session{})
+	if result.Error != nil {
+		logDBError(ctx, r.logger, result.Error, "failed to delete expired sessions")
+		dbOperations.WithLabelValues("delete_expired_sessions", dbErrorStatus(ctx, result.Error)).Inc()
+		return 0, dbError(ctx, result.Error)
+	}
+
+	dbOperations.WithLabelValues("delete_expired_sessions", "success").Inc()
+	return result.RowsAffected, nil
+}
@@ -1,13 +1,43 @@
 package repository
 
 import (
+	"context"
 	"errors"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"gorm.io/gorm"
 
+	"github.com/JorgeSaicoski/login-go/internal/metrics"
 	"github.com/JorgeSaicoski/login-go/internal/models"
 )
 
+var (
+	ErrSubscriptionInUse = errors.New("subscription is assigned to users")
+)
+
+var (
+	planDBOperations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "subscription_plan_db_operations_total",
+			Help: "Total number of subscription plan database operations",
+		},
+		[]string{"operation", "status"},
+	)
+
+	planDBDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "subscription_plan_db_duration_seconds",
+			Help: "Duration of subscription plan database operations in seconds",
+		},
+		[]string{"operation"},
+	)
+)
+
+func init() {
+	metrics.Register(planDBOperations, planDBDuration)
+}
+
 type SubscriptionRepository struct {
 	DB *gorm.DB
 }
@@ -16,33 +46,191 @@ func NewSubscriptionRepository(db *gorm.DB) *SubscriptionRepository {
 	return &SubscriptionRepository{DB: db}
 }
 
+// The methods without a context are kept for existing callers; they use
+// context.Background() and so ignore request deadlines.
+
+func (r *SubscriptionRepository) Create(subscription *models.Subscription) error {
+	return r.CreateWithContext(context.Background(), subscription)
+}
+
 func (r *SubscriptionRepository) GetByID(id uint) (*models.Subscription, error) {
+	return r.GetByIDWithContext(context.Background(), id)
+}
+
+func (r *SubscriptionRepository) GetByName(name string) (*models.Subscription, error) {
+	return r.GetByNameWithContext(context.Background(), name)
+}
+
+func (r *SubscriptionRepository) Update(subscription *models.Subscription) error {
+	return r.UpdateWithContext(context.Background(), subscription)
+}
+
+func (r *SubscriptionRepository) GetDescription(id uint) (string, error) {
+	return r.GetDescriptionWithContext(context.Background(), id)
+}
+
+func (r *SubscriptionRepository) Delete(id uint) error {
+	return r.DeleteWithContext(context.Background(), id)
+}
+
+func (r *SubscriptionRepository) CreateWithContext(ctx context.Context, subscription *models.Subscription) error {
+	start := time.Now()
+	defer func() {
+		planDBDuration.WithLabelValues("create").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "SubscriptionRepository.CreateWithContext")
+	defer span.End()
+
+	if subscription == nil {
+		planDBOperations.WithLabelValues("create", "failed").Inc()
+		return ErrInvalidInput
+	}
+	if err := withContext(r.DB, ctx).Create(subscription).Error; err != nil {
+		planDBOperations.WithLabelValues("create", dbErrorStatus(ctx, err)).Inc()
+		return dbError(ctx, err)
+	}
+
+	planDBOperations.WithLabelValues("create", "success").Inc()
+	return nil
+}
+
+func (r *SubscriptionRepository) GetByIDWithContext(ctx context.Context, id uint) (*models.Subscription, error) {
+	start := time.Now()
+	defer func() {
+		planDBDuration.WithLabelValues("get").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "SubscriptionRepository.GetByIDWithContext")
+	defer span.End()
+
 	var subscription models.Subscription
-	if err := r.DB.First(&subscription, id).Error; err != nil {
-		return nil, errors.New("subscription not found")
+	if err := withContext(r.DB, ctx).First(&subscription, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			planDBOperations.WithLabelValues("get", "not_found").Inc()
+			return nil, ErrNotFound
+		}
+		planDBOperations.WithLabelValues("get", dbErrorStatus(ctx, err)).Inc()
+		return nil, dbError(ctx, err)
 	}
+
+	planDBOperations.WithLabelValues("get", "success").Inc()
 	return &subscription, nil
 }
 
-func (r *SubscriptionRepository) GetByName(name string) (*models.Subscription, error) {
+func (r *SubscriptionRepository) GetByNameWithContext(ctx context.Context, name string) (*models.Subscription, error) {
+	start := time.Now()
+	defer func() {
+		planDBDuration.WithLabelValues("get_by_name").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "SubscriptionRepository.GetByNameWithContext")
+	defer span.End()
+
 	var subscription models.Subscription
-	if err := r.DB.Where("name = ?", name).First(&subscription).Error; err != nil {
-		return nil, errors.New("subscription not found")
+	if err := withContext(r.DB, ctx).Where("name = ?", name).First(&subscription).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			planDBOperations.WithLabelValues("get_by_name", "not_found").Inc()
+			return nil, ErrNotFound
+		}
+		planDBOperations.WithLabelValues("get_by_name", dbErrorStatus(ctx, err)).Inc()
+		return nil, dbError(ctx, err)
 	}
+
+	planDBOperations.WithLabelValues("get_by_name", "success").Inc()
 	return &subscription, nil
 }
 
-func (r *SubscriptionRepository) Update(subscription *models.Subscription) error {
-	if err := r.DB.Save(subscription).Error; err != nil {
-		return errors.New("failed to update subscription")
+func (r *SubscriptionRepository) UpdateWithContext(ctx context.Context, subscription *models.Subscription) error {
+	start := time.Now()
+	defer func() {
+		planDBDuration.WithLabelValues("update").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "SubscriptionRepository.UpdateWithContext")
+	defer span.End()
+
+	if subscription == nil {
+		planDBOperations.WithLabelValues("update", "failed").Inc()
+		return ErrInvalidInput
+	}
+	if err := withContext(r.DB, ctx).Save(subscription).Error; err != nil {
+		planDBOperations.WithLabelValues("update", dbErrorStatus(ctx, err)).Inc()
+		return dbError(ctx, err)
 	}
+
+	planDBOperations.WithLabelValues("update", "success").Inc()
 	return nil
 }
 
-func (r *SubscriptionRepository) GetDescription(id uint) (string, error) {
-	sub, err := r.GetByID(id)
+// ListWithContext returns every subscription plan ordered by ID
+func (r *SubscriptionRepository) ListWithContext(ctx context.Context) ([]models.Subscription, error) {
+	start := time.Now()
+	defer func() {
+		planDBDuration.WithLabelValues("list").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "SubscriptionRepository.ListWithContext")
+	defer span.End()
+
+	var subscriptions []models.Subscription
+	if err := withContext(r.DB, ctx).Order("id").Find(&subscriptions).Error; err != nil {
+		planDBOperations.WithLabelValues("list", dbErrorStatus(ctx, err)).Inc()
+		return nil, dbError(ctx, err)
+	}
+
+	planDBOperations.WithLabelValues("list", "success").Inc()
+	return subscriptions, nil
+}
+
+func (r *SubscriptionRepository) GetDescriptionWithContext(ctx context.Context, id uint) (string, error) {
+	sub, err := r.GetByIDWithContext(ctx, id)
 	if err != nil {
 		return "", err
 	}
 	return sub.Description, nil
 }
+
+// DeleteWithContext removes a subscription plan unless users are still
+// assigned to it. The check and delete share a transaction so a concurrent
+// assignment can't slip in between them.
+func (r *SubscriptionRepository) DeleteWithContext(ctx context.Context, id uint) error {
+	start := time.Now()
+	defer func() {
+		planDBDuration.WithLabelValues("delete").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "SubscriptionRepository.DeleteWithContext")
+	defer span.End()
+
+	err := withContext(r.DB, ctx).Transaction(func(tx *gorm.DB) error {
+		var count int64
+		// Subscriptions of soft-deleted users still reference the plan
+		if err := tx.Unscoped().Model(&models.UserSubscription{}).
+			Where("subscription_id = ?", id).
+			Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return ErrSubscriptionInUse
+		}
+
+		result := tx.Delete(&models.Subscription{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+
+	switch {
+	case err == nil:
+		planDBOperations.WithLabelValues("delete", "success").Inc()
+		return nil
+	case errors.Is(err, ErrNotFound):
+		planDBOperations.WithLabelValues("delete", "not_found").Inc()
+		return err
+	case errors.Is(err, ErrSubscriptionInUse):
+		planDBOperations.WithLabelValues("delete", "in_use").Inc()
+		return err
+	default:
+		planDBOperations.WithLabelValues("delete", dbErrorStatus(ctx, err)).Inc()
+		return dbError(ctx, err)
+	}
+}
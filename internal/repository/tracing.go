@@ -0,0 +1,21 @@
+package repository
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer resolves through the global provider, so spans are no-ops until
+// tracing is configured at startup.
+var tracer = otel.Tracer("github.com/JorgeSaicoski/login-go/internal/repository")
+
+// startSpan starts a client span for a database call as a child of the span in ctx.
+func startSpan(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "postgresql")),
+	)
+}
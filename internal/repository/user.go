@@ -4,12 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"runtime"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 
+	"github.com/JorgeSaicoski/login-go/internal/logging"
+	"github.com/JorgeSaicoski/login-go/internal/metrics"
 	"github.com/JorgeSaicoski/login-go/internal/models"
 )
 
@@ -32,7 +38,7 @@ var (
 )
 
 func init() {
-	prometheus.MustRegister(userDBOperations, userDBDuration)
+	metrics.Register(userDBOperations, userDBDuration)
 }
 
 var (
@@ -42,6 +48,9 @@ var (
 type UserRepository struct {
 	db     *gorm.DB
 	logger *zap.Logger
+	// canonicalEmails makes aliases such as user+tag@gmail.com count as
+	// the same address in uniqueness checks
+	canonicalEmails bool
 }
 
 func NewUserRepository(db *gorm.DB, logger *zap.Logger) *UserRepository {
@@ -51,31 +60,58 @@ func NewUserRepository(db *gorm.DB, logger *zap.Logger) *UserRepository {
 	}
 }
 
+// SetCanonicalEmailUniqueness turns canonical email uniqueness checks on or
+// off. Existing users need BackfillCanonicalEmails before turning it on.
+func (r *UserRepository) SetCanonicalEmailUniqueness(enabled bool) {
+	r.canonicalEmails = enabled
+}
+
+// emailTaken scopes tx to users holding the same address as email
+func (r *UserRepository) emailTaken(tx *gorm.DB, email string) *gorm.DB {
+	if r.canonicalEmails {
+		return tx.Where("canonical_email = ?", models.CanonicalizeEmail(email))
+	}
+	return tx.Where("LOWER(email) = ?", models.NormalizeIdentifier(email))
+}
+
+// emailKey is the form of email compared for uniqueness
+func (r *UserRepository) emailKey(email string) string {
+	if r.canonicalEmails {
+		return models.CanonicalizeEmail(email)
+	}
+	return models.NormalizeIdentifier(email)
+}
+
 func (r *UserRepository) CreateWithContext(ctx context.Context, user *models.User) error {
 	start := time.Now()
 	defer func() {
 		userDBDuration.WithLabelValues("create").Observe(time.Since(start).Seconds())
 	}()
+	ctx, span := startSpan(ctx, "UserRepository.CreateWithContext")
+	defer span.End()
 
 	if user == nil {
 		userDBOperations.WithLabelValues("create", "failed").Inc()
 		return ErrInvalidInput
 	}
 
+	user.Normalize()
+
 	// Hash password before saving
 	if err := user.HashPassword(); err != nil {
-		r.logger.Error("failed to hash password",
+		logging.FromContext(ctx, r.logger).Error("failed to hash password",
 			zap.Error(err),
 		)
 		userDBOperations.WithLabelValues("create", "failed").Inc()
 		return fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// Check for existing username
+	err := withContext(r.db, ctx).Transaction(func(tx *gorm.DB) error {
+		// Uniqueness checks include soft-deleted users so restoring one
+		// can never collide with an account created after it was deleted.
 		var count int64
-		if err := tx.Model(&models.User{}).
-			Where("username_for_login = ?", user.UsernameForLogin).
+		if err := tx.Unscoped().Model(&models.User{}).
+			Where("LOWER(username_for_login) = ?", user.UsernameForLogin).
 			Count(&count).Error; err != nil {
 			return err
 		}
@@ -84,8 +120,7 @@ func (r *UserRepository) CreateWithContext(ctx context.Context, user *models.Use
 		}
 
 		// Check for existing email
-		if err := tx.Model(&models.User{}).
-			Where("email = ?", user.Email).
+		if err := r.emailTaken(tx.Unscoped().Model(&models.User{}), user.Email).
 			Count(&count).Error; err != nil {
 			return err
 		}
@@ -101,13 +136,16 @@ func (r *UserRepository) CreateWithContext(ctx context.Context, user *models.Use
 		return nil
 	})
 
+	if errors.Is(err, ErrDuplicateEntry) {
+		userDBOperations.WithLabelValues("create", "duplicate").Inc()
+		return ErrDuplicateEntry
+	}
 	if err != nil {
-		r.logger.Error("failed to create user",
-			zap.Error(err),
+		logDBError(ctx, r.logger, err, "failed to create user",
 			zap.String("username", user.UsernameForLogin),
 		)
-		userDBOperations.WithLabelValues("create", "failed").Inc()
-		return fmt.Errorf("%w: %v", ErrDatabaseOperation, err)
+		userDBOperations.WithLabelValues("create", dbErrorStatus(ctx, err)).Inc()
+		return dbError(ctx, err)
 	}
 
 	userDBOperations.WithLabelValues("create", "success").Inc()
@@ -120,9 +158,11 @@ func (r *UserRepository) GetByIDWithContext(ctx context.Context, id uint) (*mode
 	defer func() {
 		userDBDuration.WithLabelValues("get_by_id").Observe(time.Since(start).Seconds())
 	}()
+	ctx, span := startSpan(ctx, "UserRepository.GetByIDWithContext")
+	defer span.End()
 
 	var user models.User
-	err := r.db.WithContext(ctx).
+	err := withContext(r.db, ctx).
 		First(&user, id).Error
 
 	if err != nil {
@@ -130,87 +170,251 @@ func (r *UserRepository) GetByIDWithContext(ctx context.Context, id uint) (*mode
 			userDBOperations.WithLabelValues("get_by_id", "not_found").Inc()
 			return nil, ErrNotFound
 		}
-		r.logger.Error("failed to get user by id",
-			zap.Error(err),
+		logDBError(ctx, r.logger, err, "failed to get user by id",
 			zap.Uint("id", id),
 		)
-		userDBOperations.WithLabelValues("get_by_id", "failed").Inc()
-		return nil, fmt.Errorf("%w: %v", ErrDatabaseOperation, err)
+		userDBOperations.WithLabelValues("get_by_id", dbErrorStatus(ctx, err)).Inc()
+		return nil, dbError(ctx, err)
 	}
 
 	userDBOperations.WithLabelValues("get_by_id", "success").Inc()
 	return &user, nil
 }
 
+// GetByUsername is kept for callers without a context; prefer
+// GetByUsernameWithContext.
 func (r *UserRepository) GetByUsername(username string) (*models.User, error) {
+	return r.GetByUsernameWithContext(context.Background(), username)
+}
+
+func (r *UserRepository) GetByUsernameWithContext(ctx context.Context, username string) (*models.User, error) {
 	start := time.Now()
 
 	defer func() {
 		userDBDuration.WithLabelValues("get_by_username").Observe(time.Since(start).Seconds())
 	}()
+	ctx, span := startSpan(ctx, "UserRepository.GetByUsernameWithContext")
+	defer span.End()
 
 	var user models.User
-	err := r.db.Where("username_for_login = ?", username).First(&user).Error
+	err := withContext(r.db, ctx).
+		Where("LOWER(username_for_login) = ?", models.NormalizeIdentifier(username)).
+		First(&user).Error
 
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			userDBOperations.WithLabelValues("get_by_username", "not_found").Inc()
 			return nil, ErrNotFound
 		}
-		r.logger.Error("failed to get user by username",
-			zap.Error(err),
+		logDBError(ctx, r.logger, err, "failed to get user by username",
 			zap.String("username", username),
 		)
-		userDBOperations.WithLabelValues("get_by_username", "failed").Inc()
-		return nil, fmt.Errorf("%w: %v", ErrDatabaseOperation, err)
+		userDBOperations.WithLabelValues("get_by_username", dbErrorStatus(ctx, err)).Inc()
+		return nil, dbError(ctx, err)
 	}
 
 	userDBOperations.WithLabelValues("get_by_username", "success").Inc()
 	return &user, nil
 }
 
+// GetByEmail is kept for callers without a context; prefer
+// GetByEmailWithContext.
 func (r *UserRepository) GetByEmail(email string) (*models.User, error) {
+	return r.GetByEmailWithContext(context.Background(), email)
+}
+
+func (r *UserRepository) GetByEmailWithContext(ctx context.Context, email string) (*models.User, error) {
 	start := time.Now()
 	defer func() {
 		userDBDuration.WithLabelValues("get_by_email").Observe(time.Since(start).Seconds())
 	}()
+	ctx, span := startSpan(ctx, "UserRepository.GetByEmailWithContext")
+	defer span.End()
 
 	var user models.User
-	err := r.db.Where("email = ?", email).First(&user).Error
+	err := withContext(r.db, ctx).
+		Where("LOWER(email) = ?", models.NormalizeIdentifier(email)).
+		First(&user).Error
 
 	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			userDBOperations.WithLabelValues("get_by_email", "not_found").Inc()
 			return nil, ErrNotFound
 		}
-		r.logger.Error("failed to get user by email",
-			zap.Error(err),
+		logDBError(ctx, r.logger, err, "failed to get user by email",
 			zap.String("email", email),
 		)
-		userDBOperations.WithLabelValues("get_by_email", "failed").Inc()
-		return nil, fmt.Errorf("%w: %v", ErrDatabaseOperation, err)
+		userDBOperations.WithLabelValues("get_by_email", dbErrorStatus(ctx, err)).Inc()
+		return nil, dbError(ctx, err)
 	}
 
 	userDBOperations.WithLabelValues("get_by_email", "success").Inc()
 	return &user, nil
 }
 
+// GetByUsernameOrEmailWithContext finds the user whose username or email
+// matches identifier in a single query, so a miss costs the same as a hit.
+// A username match wins over another user's email.
+func (r *UserRepository) GetByUsernameOrEmailWithContext(ctx context.Context, identifier string) (*models.User, error) {
+	start := time.Now()
+	defer func() {
+		userDBDuration.WithLabelValues("get_by_username_or_email").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "UserRepository.GetByUsernameOrEmailWithContext")
+	defer span.End()
+
+	key := models.NormalizeIdentifier(identifier)
+	var user models.User
+	err := withContext(r.db, ctx).
+		Where("LOWER(username_for_login) = ? OR LOWER(email) = ?", key, key).
+		Order(clause.Expr{SQL: "CASE WHEN LOWER(username_for_login) = ? THEN 0 ELSE 1 END", Vars: []interface{}{key}}).
+		First(&user).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			userDBOperations.WithLabelValues("get_by_username_or_email", "not_found").Inc()
+			return nil, ErrNotFound
+		}
+		logDBError(ctx, r.logger, err, "failed to get user by username or email",
+			zap.String("identifier", identifier),
+		)
+		userDBOperations.WithLabelValues("get_by_username_or_email", dbErrorStatus(ctx, err)).Inc()
+		return nil, dbError(ctx, err)
+	}
+
+	userDBOperations.WithLabelValues("get_by_username_or_email", "success").Inc()
+	return &user, nil
+}
+
+func (r *UserRepository) GetByVerificationTokenWithContext(ctx context.Context, tokenHash string) (*models.User, error) {
+	start := time.Now()
+	defer func() {
+		userDBDuration.WithLabelValues("get_by_verification_token").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "UserRepository.GetByVerificationTokenWithContext")
+	defer span.End()
+
+	if tokenHash == "" {
+		userDBOperations.WithLabelValues("get_by_verification_token", "failed").Inc()
+		return nil, ErrInvalidInput
+	}
+
+	var user models.User
+	err := withContext(r.db, ctx).Where("verification_token = ?", tokenHash).First(&user).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			userDBOperations.WithLabelValues("get_by_verification_token", "not_found").Inc()
+			return nil, ErrNotFound
+		}
+		logDBError(ctx, r.logger, err, "failed to get user by verification token")
+		userDBOperations.WithLabelValues("get_by_verification_token", dbErrorStatus(ctx, err)).Inc()
+		return nil, dbError(ctx, err)
+	}
+
+	userDBOperations.WithLabelValues("get_by_verification_token", "success").Inc()
+	return &user, nil
+}
+
+func (r *UserRepository) GetByEmailChangeTokenWithContext(ctx context.Context, tokenHash string) (*models.User, error) {
+	start := time.Now()
+	defer func() {
+		userDBDuration.WithLabelValues("get_by_email_change_token").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "UserRepository.GetByEmailChangeTokenWithContext")
+	defer span.End()
+
+	if tokenHash == "" {
+		userDBOperations.WithLabelValues("get_by_email_change_token", "failed").Inc()
+		return nil, ErrInvalidInput
+	}
+
+	var user models.User
+	err := withContext(r.db, ctx).Where("email_change_token = ?", tokenHash).First(&user).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			userDBOperations.WithLabelValues("get_by_email_change_token", "not_found").Inc()
+			return nil, ErrNotFound
+		}
+		logDBError(ctx, r.logger, err, "failed to get user by email change token")
+		userDBOperations.WithLabelValues("get_by_email_change_token", dbErrorStatus(ctx, err)).Inc()
+		return nil, dbError(ctx, err)
+	}
+
+	userDBOperations.WithLabelValues("get_by_email_change_token", "success").Inc()
+	return &user, nil
+}
+
+// MaxUserListLimit caps the page size of List
+const MaxUserListLimit = 100
+
+// List returns a page of users ordered by newest first. A non-empty search
+// matches case-insensitively against username, email and name. A limit
+// outside 1..MaxUserListLimit is capped at MaxUserListLimit.
+func (r *UserRepository) List(ctx context.Context, limit, offset int, search string) ([]models.User, int64, error) {
+	start := time.Now()
+	defer func() {
+		userDBDuration.WithLabelValues("list").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "UserRepository.List")
+	defer span.End()
+
+	if limit <= 0 || limit > MaxUserListLimit {
+		limit = MaxUserListLimit
+	}
+
+	query := withContext(r.db, ctx).Model(&models.User{})
+	if search = strings.TrimSpace(search); search != "" {
+		// LOWER ... LIKE rather than ILIKE so it runs on every dialect
+		pattern := "%" + escapeLike(search) + "%"
+		query = query.Where(`LOWER(username_for_login) LIKE LOWER(?) ESCAPE '\' OR LOWER(email) LIKE LOWER(?) ESCAPE '\' OR LOWER(name) LIKE LOWER(?) ESCAPE '\'`, pattern, pattern, pattern)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		logDBError(ctx, r.logger, err, "failed to count users")
+		userDBOperations.WithLabelValues("list", dbErrorStatus(ctx, err)).Inc()
+		return nil, 0, dbError(ctx, err)
+	}
+
+	var users []models.User
+	err := query.
+		Order("created_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&users).Error
+
+	if err != nil {
+		logDBError(ctx, r.logger, err, "failed to list users")
+		userDBOperations.WithLabelValues("list", dbErrorStatus(ctx, err)).Inc()
+		return nil, 0, dbError(ctx, err)
+	}
+
+	userDBOperations.WithLabelValues("list", "success").Inc()
+	return users, total, nil
+}
+
 func (r *UserRepository) UpdateWithContext(ctx context.Context, user *models.User) error {
 	start := time.Now()
 	defer func() {
 		userDBDuration.WithLabelValues("update").Observe(time.Since(start).Seconds())
 	}()
+	ctx, span := startSpan(ctx, "UserRepository.UpdateWithContext")
+	defer span.End()
 
 	if user == nil {
 		userDBOperations.WithLabelValues("update", "failed").Inc()
 		return ErrInvalidInput
 	}
 
-	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		// Check if email is already in use by another user
+	user.Normalize()
+
+	err := withContext(r.db, ctx).Transaction(func(tx *gorm.DB) error {
+		// Check if email is already in use by another user, deleted or not
 		var count int64
-		if err := tx.Model(&models.User{}).
-			Where("email = ? AND id != ?", user.Email, user.ID).
+		if err := r.emailTaken(tx.Unscoped().Model(&models.User{}), user.Email).
+			Where("id != ?", user.ID).
 			Count(&count).Error; err != nil {
 			return err
 		}
@@ -226,13 +430,16 @@ func (r *UserRepository) UpdateWithContext(ctx context.Context, user *models.Use
 		return nil
 	})
 
+	if errors.Is(err, ErrDuplicateEntry) {
+		userDBOperations.WithLabelValues("update", "duplicate").Inc()
+		return ErrDuplicateEntry
+	}
 	if err != nil {
-		r.logger.Error("failed to update user",
-			zap.Error(err),
+		logDBError(ctx, r.logger, err, "failed to update user",
 			zap.Uint("id", user.ID),
 		)
-		userDBOperations.WithLabelValues("update", "failed").Inc()
-		return fmt.Errorf("%w: %v", ErrDatabaseOperation, err)
+		userDBOperations.WithLabelValues("update", dbErrorStatus(ctx, err)).Inc()
+		return dbError(ctx, err)
 	}
 
 	userDBOperations.WithLabelValues("update", "success").Inc()
@@ -240,27 +447,351 @@ func (r *UserRepository) UpdateWithContext(ctx context.Context, user *models.Use
 }
 
 func (r *UserRepository) DeleteWithContext(ctx context.Context, id uint) error {
+	_, err := r.DeleteAndReturnWithContext(ctx, id)
+	return err
+}
+
+// DeleteAndReturnWithContext deletes the user like DeleteWithContext and
+// returns it as it was before deletion, including the subscriptions that
+// were soft-deleted with it. The password hash is cleared.
+func (r *UserRepository) DeleteAndReturnWithContext(ctx context.Context, id uint) (*models.User, error) {
 	start := time.Now()
 	defer func() {
 		userDBDuration.WithLabelValues("delete").Observe(time.Since(start).Seconds())
 	}()
+	ctx, span := startSpan(ctx, "UserRepository.DeleteAndReturnWithContext")
+	defer span.End()
+
+	var user models.User
+	// Soft-delete the user and their subscriptions in one transaction with
+	// the same timestamp, so RestoreUser can tell which subscriptions went
+	// with the user. The rows are kept for audit and can be restored.
+	now := time.Now()
+	err := withContext(r.db, ctx).Session(&gorm.Session{
+		NowFunc: func() time.Time { return now },
+	}).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Preload("Subscriptions").First(&user, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if err := tx.Where("user_id = ?", id).Delete(&models.UserSubscription{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Delete(&models.User{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+
+	if errors.Is(err, ErrNotFound) {
+		userDBOperations.WithLabelValues("delete", "not_found").Inc()
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		logDBError(ctx, r.logger, err, "failed to delete user",
+			zap.Uint("id", id),
+		)
+		userDBOperations.WithLabelValues("delete", dbErrorStatus(ctx, err)).Inc()
+		return nil, dbError(ctx, err)
+	}
+
+	user.Password = ""
+	userDBOperations.WithLabelValues("delete", "success").Inc()
+	return &user, nil
+}
+
+const (
+	// MaxBulkCreate caps the users accepted by one BulkCreateWithContext call
+	MaxBulkCreate   = 500
+	bulkInsertBatch = 100
+)
+
+// BulkCreateWithContext inserts users in a single transaction. The returned
+// slice has one entry per user: nil if it was created, ErrDuplicateEntry if
+// its username or email is already taken (in the database or earlier in the
+// same batch). Passwords are hashed before insert.
+func (r *UserRepository) BulkCreateWithContext(ctx context.Context, users []*models.User) ([]error, error) {
+	start := time.Now()
+	defer func() {
+		userDBDuration.WithLabelValues("bulk_create").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "UserRepository.BulkCreateWithContext")
+	defer span.End()
+
+	if len(users) == 0 || len(users) > MaxBulkCreate {
+		userDBOperations.WithLabelValues("bulk_create", "failed").Inc()
+		return nil, ErrInvalidInput
+	}
+
+	results := make([]error, len(users))
+	usernames := make([]string, 0, len(users))
+	emails := make([]string, 0, len(users))
+	for i, user := range users {
+		if user == nil {
+			results[i] = ErrInvalidInput
+			continue
+		}
+		user.Normalize()
+		usernames = append(usernames, user.UsernameForLogin)
+		emails = append(emails, r.emailKey(user.Email))
+	}
+
+	if err := hashPasswords(users, results); err != nil {
+		logging.FromContext(ctx, r.logger).Error("failed to hash passwords for bulk create",
+			zap.Error(err),
+		)
+		userDBOperations.WithLabelValues("bulk_create", "failed").Inc()
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	err := withContext(r.db, ctx).Transaction(func(tx *gorm.DB) error {
+		// Soft-deleted users still hold their identifiers
+		emailColumn := "LOWER(email)"
+		if r.canonicalEmails {
+			emailColumn = "canonical_email"
+		}
+		var existing []models.User
+		if err := tx.Unscoped().
+			Select("username_for_login", "email").
+			Where("LOWER(username_for_login) IN ? OR "+emailColumn+" IN ?", usernames, emails).
+			Find(&existing).Error; err != nil {
+			return err
+		}
+
+		taken := make(map[string]struct{}, 2*len(existing))
+		for _, u := range existing {
+			taken["u:"+models.NormalizeIdentifier(u.UsernameForLogin)] = struct{}{}
+			taken["e:"+r.emailKey(u.Email)] = struct{}{}
+		}
+
+		toInsert := make([]*models.User, 0, len(users))
+		for i, user := range users {
+			if results[i] != nil {
+				continue
+			}
+			_, usernameTaken := taken["u:"+user.UsernameForLogin]
+			_, emailTaken := taken["e:"+r.emailKey(user.Email)]
+			if usernameTaken || emailTaken {
+				results[i] = ErrDuplicateEntry
+				continue
+			}
+			taken["u:"+user.UsernameForLogin] = struct{}{}
+			taken["e:"+r.emailKey(user.Email)] = struct{}{}
+			toInsert = append(toInsert, user)
+		}
+
+		if len(toInsert) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(toInsert, bulkInsertBatch).Error
+	})
+
+	if err != nil {
+		logDBError(ctx, r.logger, err, "failed to bulk create users",
+			zap.Int("count", len(users)),
+		)
+		userDBOperations.WithLabelValues("bulk_create", dbErrorStatus(ctx, err)).Inc()
+		return nil, dbError(ctx, err)
+	}
+
+	userDBOperations.WithLabelValues("bulk_create", "success").Inc()
+	return results, nil
+}
+
+// hashPasswords hashes the passwords of the users not already marked as
+// failed, spreading the bcrypt work across the available CPUs.
+func hashPasswords(users []*models.User, results []error) error {
+	sem := make(chan struct{}, runtime.NumCPU())
+	errs := make(chan error, len(users))
+	var wg sync.WaitGroup
+
+	for i, user := range users {
+		if results[i] != nil {
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(user *models.User) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := user.HashPassword(); err != nil {
+				errs <- err
+			}
+		}(user)
+	}
+
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// RestoreUser undoes a soft delete, including the subscriptions that were
+// deleted with the user. It returns ErrNotFound if there is no deleted user
+// with the given id.
+func (r *UserRepository) RestoreUser(ctx context.Context, id uint) error {
+	start := time.Now()
+	defer func() {
+		userDBDuration.WithLabelValues("restore").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "UserRepository.RestoreUser")
+	defer span.End()
+
+	err := withContext(r.db, ctx).Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		if err := tx.Unscoped().
+			Select("id", "deleted_at").
+			Where("id = ? AND deleted_at IS NOT NULL", id).
+			First(&user).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrNotFound
+			}
+			return err
+		}
+
+		if err := tx.Unscoped().
+			Model(&models.UserSubscription{}).
+			Where("user_id = ? AND deleted_at = ?", id, user.DeletedAt.Time).
+			Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().
+			Model(&models.User{}).
+			Where("id = ? AND deleted_at IS NOT NULL", id).
+			Update("deleted_at", nil)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+
+	if errors.Is(err, ErrNotFound) {
+		userDBOperations.WithLabelValues("restore", "not_found").Inc()
+		return ErrNotFound
+	}
+	if err != nil {
+		logDBError(ctx, r.logger, err, "failed to restore user",
+			zap.Uint("id", id),
+		)
+		userDBOperations.WithLabelValues("restore", dbErrorStatus(ctx, err)).Inc()
+		return dbError(ctx, err)
+	}
+
+	userDBOperations.WithLabelValues("restore", "success").Inc()
+	return nil
+}
+
+// UsernameTakenWithContext reports whether username is held by any user,
+// including soft-deleted ones, using the same rule as CreateWithContext.
+func (r *UserRepository) UsernameTakenWithContext(ctx context.Context, username string) (bool, error) {
+	return r.identifierTaken(ctx, "username_taken", withContext(r.db, ctx).Unscoped().Model(&models.User{}).
+		Where("LOWER(username_for_login) = ?", models.NormalizeIdentifier(username)))
+}
 
-	result := r.db.WithContext(ctx).Delete(&models.User{}, id)
+// EmailTakenWithContext reports whether email, or an alias of it when
+// canonicalization is on, is held by any user including soft-deleted ones.
+func (r *UserRepository) EmailTakenWithContext(ctx context.Context, email string) (bool, error) {
+	return r.identifierTaken(ctx, "email_taken", r.emailTaken(withContext(r.db, ctx).Unscoped().Model(&models.User{}), email))
+}
+
+func (r *UserRepository) identifierTaken(ctx context.Context, operation string, query *gorm.DB) (bool, error) {
+	start := time.Now()
+	defer func() {
+		userDBDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "UserRepository."+operation)
+	defer span.End()
+
+	var count int64
+	if err := query.WithContext(ctx).Count(&count).Error; err != nil {
+		logDBError(ctx, r.logger, err, "failed to check identifier",
+			zap.String("operation", operation),
+		)
+		userDBOperations.WithLabelValues(operation, dbErrorStatus(ctx, err)).Inc()
+		return false, dbError(ctx, err)
+	}
+
+	userDBOperations.WithLabelValues(operation, "success").Inc()
+	return count > 0, nil
+}
+
+// BackfillCanonicalEmails fills in canonical_email for users created before
+// the column existed and returns how many rows were updated.
+func (r *UserRepository) BackfillCanonicalEmails(ctx context.Context) (int64, error) {
+	start := time.Now()
+	defer func() {
+		userDBDuration.WithLabelValues("backfill_canonical_emails").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "UserRepository.BackfillCanonicalEmails")
+	defer span.End()
+	// Users registered just before startup may not have reached a replica
+	ctx = WithPrimary(ctx)
+
+	var updated int64
+	var batch []models.User
+	result := withContext(r.db, ctx).Unscoped().
+		Select("id", "email").
+		Where("canonical_email IS NULL OR canonical_email = ''").
+		FindInBatches(&batch, bulkInsertBatch, func(tx *gorm.DB, _ int) error {
+			for _, u := range batch {
+				if err := tx.Unscoped().Model(&models.User{}).
+					Where("id = ?", u.ID).
+					UpdateColumn("canonical_email", models.CanonicalizeEmail(u.Email)).Error; err != nil {
+					return err
+				}
+				updated++
+			}
+			return nil
+		})
+	if result.Error != nil {
+		logDBError(ctx, r.logger, result.Error, "failed to backfill canonical emails")
+		userDBOperations.WithLabelValues("backfill_canonical_emails", dbErrorStatus(ctx, result.Error)).Inc()
+		return updated, dbError(ctx, result.Error)
+	}
+
+	userDBOperations.WithLabelValues("backfill_canonical_emails", "success").Inc()
+	return updated, nil
+}
+
+// SetActiveWithContext suspends (active=false) or reactivates a user
+func (r *UserRepository) SetActiveWithContext(ctx context.Context, id uint, active bool) error {
+	start := time.Now()
+	defer func() {
+		userDBDuration.WithLabelValues("set_active").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "UserRepository.SetActiveWithContext")
+	defer span.End()
+
+	result := withContext(r.db, ctx).
+		Model(&models.User{}).
+		Where("id = ?", id).
+		Update("active", active)
 	if result.Error != nil {
-		r.logger.Error("failed to delete user",
-			zap.Error(result.Error),
+		logDBError(ctx, r.logger, result.Error, "failed to set user active state",
 			zap.Uint("id", id),
+			zap.Bool("active", active),
 		)
-		userDBOperations.WithLabelValues("delete", "failed").Inc()
-		return fmt.Errorf("%w: %v", ErrDatabaseOperation, result.Error)
+		userDBOperations.WithLabelValues("set_active", dbErrorStatus(ctx, result.Error)).Inc()
+		return dbError(ctx, result.Error)
 	}
 
 	if result.RowsAffected == 0 {
-		userDBOperations.WithLabelValues("delete", "not_found").Inc()
+		userDBOperations.WithLabelValues("set_active", "not_found").Inc()
 		return ErrNotFound
 	}
 
-	userDBOperations.WithLabelValues("delete", "success").Inc()
+	userDBOperations.WithLabelValues("set_active", "success").Inc()
 	return nil
 }
 
@@ -11,6 +11,8 @@ import (
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 
+	"github.com/JorgeSaicoski/login-go/internal/events"
+	"github.com/JorgeSaicoski/login-go/internal/metrics"
 	"github.com/JorgeSaicoski/login-go/internal/models"
 )
 
@@ -33,7 +35,7 @@ var (
 )
 
 func init() {
-	prometheus.MustRegister(dbOperations, dbDuration)
+	metrics.Register(dbOperations, dbDuration)
 }
 
 // Common errors
@@ -41,11 +43,20 @@ var (
 	ErrNotFound          = errors.New("record not found")
 	ErrInvalidInput      = errors.New("invalid input")
 	ErrDatabaseOperation = errors.New("database operation failed")
+	ErrPlanNotFound      = errors.New("subscription plan not found")
+	ErrSeatLimitReached  = errors.New("subscription seat limit reached")
+	// ErrActiveSubscriptionExists means the user already holds the plan
+	// through a subscription that has not ended yet
+	ErrActiveSubscriptionExists = errors.New("active subscription already exists")
+	// ErrRequestCancelled means the caller's context was cancelled or timed
+	// out mid-query; it wraps context.Canceled or context.DeadlineExceeded
+	ErrRequestCancelled = errors.New("request cancelled")
 )
 
 type UserSubscriptionRepository struct {
 	db     *gorm.DB
 	logger *zap.Logger
+	events *events.Broker
 }
 
 func NewUserSubscriptionRepository(db *gorm.DB, logger *zap.Logger) *UserSubscriptionRepository {
@@ -55,11 +66,27 @@ func NewUserSubscriptionRepository(db *gorm.DB, logger *zap.Logger) *UserSubscri
 	}
 }
 
+// SetEventBroker publishes an event to broker after every committed change
+// to a user subscription. Without a broker no events are produced.
+func (r *UserSubscriptionRepository) SetEventBroker(broker *events.Broker) {
+	r.events = broker
+}
+
+func (r *UserSubscriptionRepository) publish(eventType string, userID, id uint) {
+	r.events.Publish(events.SubscriptionEvent{
+		Type:               eventType,
+		UserID:             userID,
+		UserSubscriptionID: id,
+	})
+}
+
 func (r *UserSubscriptionRepository) CreateWithContext(ctx context.Context, us *models.UserSubscription) error {
 	start := time.Now()
 	defer func() {
 		dbDuration.WithLabelValues("create_subscription").Observe(time.Since(start).Seconds())
 	}()
+	ctx, span := startSpan(ctx, "UserSubscriptionRepository.CreateWithContext")
+	defer span.End()
 
 	if us == nil {
 		dbOperations.WithLabelValues("create_subscription", "failed").Inc()
@@ -69,7 +96,7 @@ func (r *UserSubscriptionRepository) CreateWithContext(ctx context.Context, us *
 	us.CreatedAt = time.Now()
 	us.UpdatedAt = time.Now()
 
-	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	err := withContext(r.db, ctx).Transaction(func(tx *gorm.DB) error {
 		// Check if subscription already exists
 		var count int64
 		if err := tx.Model(&models.UserSubscription{}).
@@ -80,7 +107,13 @@ func (r *UserSubscriptionRepository) CreateWithContext(ctx context.Context, us *
 		}
 
 		if count > 0 {
-			return errors.New("active subscription already exists")
+			return ErrActiveSubscriptionExists
+		}
+
+		if us.Type == models.Enterprise {
+			if err := checkSeatAvailable(tx, us.SubscriptionID, us.CompanyName); err != nil {
+				return err
+			}
 		}
 
 		// Create new subscription
@@ -91,17 +124,33 @@ func (r *UserSubscriptionRepository) CreateWithContext(ctx context.Context, us *
 		return nil
 	})
 
+	if errors.Is(err, ErrActiveSubscriptionExists) {
+		dbOperations.WithLabelValues("create_subscription", "conflict").Inc()
+		return ErrActiveSubscriptionExists
+	}
+	if isInvalidValue(err) {
+		dbOperations.WithLabelValues("create_subscription", "invalid").Inc()
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	if errors.Is(err, ErrSeatLimitReached) {
+		dbOperations.WithLabelValues("create_subscription", "seat_limit").Inc()
+		return ErrSeatLimitReached
+	}
+	if errors.Is(err, ErrPlanNotFound) {
+		dbOperations.WithLabelValues("create_subscription", "not_found").Inc()
+		return ErrPlanNotFound
+	}
 	if err != nil {
-		r.logger.Error("failed to create user subscription",
-			zap.Error(err),
+		logDBError(ctx, r.logger, err, "failed to create user subscription",
 			zap.Uint("user_id", us.UserID),
 			zap.Uint("subscription_id", us.SubscriptionID),
 		)
-		dbOperations.WithLabelValues("create_subscription", "failed").Inc()
-		return fmt.Errorf("%w: %v", ErrDatabaseOperation, err)
+		dbOperations.WithLabelValues("create_subscription", dbErrorStatus(ctx, err)).Inc()
+		return dbError(ctx, err)
 	}
 
 	dbOperations.WithLabelValues("create_subscription", "success").Inc()
+	r.publish(events.SubscriptionCreated, us.UserID, us.ID)
 	return nil
 }
 
@@ -110,9 +159,11 @@ func (r *UserSubscriptionRepository) GetByIDWithContext(ctx context.Context, id
 	defer func() {
 		dbDuration.WithLabelValues("get_subscription").Observe(time.Since(start).Seconds())
 	}()
+	ctx, span := startSpan(ctx, "UserSubscriptionRepository.GetByIDWithContext")
+	defer span.End()
 
 	var us models.UserSubscription
-	err := r.db.WithContext(ctx).
+	err := withContext(r.db, ctx).
 		Preload(clause.Associations).
 		First(&us, id).Error
 
@@ -121,12 +172,11 @@ func (r *UserSubscriptionRepository) GetByIDWithContext(ctx context.Context, id
 			dbOperations.WithLabelValues("get_subscription", "not_found").Inc()
 			return nil, ErrNotFound
 		}
-		r.logger.Error("failed to get user subscription",
-			zap.Error(err),
+		logDBError(ctx, r.logger, err, "failed to get user subscription",
 			zap.Uint("id", id),
 		)
-		dbOperations.WithLabelValues("get_subscription", "failed").Inc()
-		return nil, fmt.Errorf("%w: %v", ErrDatabaseOperation, err)
+		dbOperations.WithLabelValues("get_subscription", dbErrorStatus(ctx, err)).Inc()
+		return nil, dbError(ctx, err)
 	}
 
 	dbOperations.WithLabelValues("get_subscription", "success").Inc()
@@ -138,45 +188,110 @@ func (r *UserSubscriptionRepository) GetByUserIDWithContext(ctx context.Context,
 	defer func() {
 		dbDuration.WithLabelValues("get_user_subscriptions").Observe(time.Since(start).Seconds())
 	}()
+	ctx, span := startSpan(ctx, "UserSubscriptionRepository.GetByUserIDWithContext")
+	defer span.End()
 
 	var subscriptions []models.UserSubscription
-	err := r.db.WithContext(ctx).
+	err := withContext(r.db, ctx).
 		Where("user_id = ?", userID).
 		Preload("Subscription").
 		Find(&subscriptions).Error
 
 	if err != nil {
-		r.logger.Error("failed to get user subscriptions",
-			zap.Error(err),
+		logDBError(ctx, r.logger, err, "failed to get user subscriptions",
 			zap.Uint("user_id", userID),
 		)
-		dbOperations.WithLabelValues("get_user_subscriptions", "failed").Inc()
-		return nil, fmt.Errorf("%w: %v", ErrDatabaseOperation, err)
+		dbOperations.WithLabelValues("get_user_subscriptions", dbErrorStatus(ctx, err)).Inc()
+		return nil, dbError(ctx, err)
 	}
 
 	dbOperations.WithLabelValues("get_user_subscriptions", "success").Inc()
 	return subscriptions, nil
 }
 
+func (r *UserSubscriptionRepository) GetByUserIDPaginatedWithContext(ctx context.Context, userID uint, limit, offset int) ([]models.UserSubscription, int64, error) {
+	return r.GetByUserIDFilteredWithContext(ctx, userID, UserSubscriptionFilter{}, limit, offset)
+}
+
+// UserSubscriptionFilter narrows a user's subscriptions. Zero values match everything.
+type UserSubscriptionFilter struct {
+	Type   models.SubscriptionType
+	Active *bool
+}
+
+func (f UserSubscriptionFilter) apply(db *gorm.DB) *gorm.DB {
+	if f.Type != "" {
+		db = db.Where("type = ?", f.Type)
+	}
+	if f.Active != nil {
+		db = db.Where("is_active = ?", *f.Active)
+	}
+	return db
+}
+
+// GetByUserIDFilteredWithContext returns one page of a user's subscriptions
+// matching filter, along with the total number of matches.
+func (r *UserSubscriptionRepository) GetByUserIDFilteredWithContext(ctx context.Context, userID uint, filter UserSubscriptionFilter, limit, offset int) ([]models.UserSubscription, int64, error) {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("get_user_subscriptions_paginated").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "UserSubscriptionRepository.GetByUserIDFilteredWithContext")
+	defer span.End()
+
+	var total int64
+	if err := filter.apply(withContext(r.db, ctx).
+		Model(&models.UserSubscription{}).
+		Where("user_id = ?", userID)).
+		Count(&total).Error; err != nil {
+		logDBError(ctx, r.logger, err, "failed to count user subscriptions",
+			zap.Uint("user_id", userID),
+		)
+		dbOperations.WithLabelValues("get_user_subscriptions_paginated", dbErrorStatus(ctx, err)).Inc()
+		return nil, 0, dbError(ctx, err)
+	}
+
+	var subscriptions []models.UserSubscription
+	err := filter.apply(withContext(r.db, ctx).
+		Where("user_id = ?", userID)).
+		Preload("Subscription").
+		Order("id").
+		Limit(limit).
+		Offset(offset).
+		Find(&subscriptions).Error
+
+	if err != nil {
+		logDBError(ctx, r.logger, err, "failed to get paginated user subscriptions",
+			zap.Uint("user_id", userID),
+		)
+		dbOperations.WithLabelValues("get_user_subscriptions_paginated", dbErrorStatus(ctx, err)).Inc()
+		return nil, 0, dbError(ctx, err)
+	}
+
+	dbOperations.WithLabelValues("get_user_subscriptions_paginated", "success").Inc()
+	return subscriptions, total, nil
+}
+
 func (r *UserSubscriptionRepository) GetActiveByUserIDWithContext(ctx context.Context, userID uint) ([]models.UserSubscription, error) {
 	start := time.Now()
 	defer func() {
 		dbDuration.WithLabelValues("get_active_subscriptions").Observe(time.Since(start).Seconds())
 	}()
+	ctx, span := startSpan(ctx, "UserSubscriptionRepository.GetActiveByUserIDWithContext")
+	defer span.End()
 
 	var subscriptions []models.UserSubscription
-	err := r.db.WithContext(ctx).
+	err := withContext(r.db, ctx).
 		Where("user_id = ? AND is_active = ? AND end_date > ?", userID, true, time.Now()).
 		Preload("Subscription").
 		Find(&subscriptions).Error
 
 	if err != nil {
-		r.logger.Error("failed to get active user subscriptions",
-			zap.Error(err),
+		logDBError(ctx, r.logger, err, "failed to get active user subscriptions",
 			zap.Uint("user_id", userID),
 		)
-		dbOperations.WithLabelValues("get_active_subscriptions", "failed").Inc()
-		return nil, fmt.Errorf("%w: %v", ErrDatabaseOperation, err)
+		dbOperations.WithLabelValues("get_active_subscriptions", dbErrorStatus(ctx, err)).Inc()
+		return nil, dbError(ctx, err)
 	}
 
 	dbOperations.WithLabelValues("get_active_subscriptions", "success").Inc()
@@ -189,6 +304,8 @@ func (r *UserSubscriptionRepository) UpdateWithContext(ctx context.Context, us *
 	defer func() {
 		dbDuration.WithLabelValues("update_subscription").Observe(time.Since(start).Seconds())
 	}()
+	ctx, span := startSpan(ctx, "UserSubscriptionRepository.UpdateWithContext")
+	defer span.End()
 
 	if us == nil {
 		dbOperations.WithLabelValues("update_subscription", "failed").Inc()
@@ -197,7 +314,7 @@ func (r *UserSubscriptionRepository) UpdateWithContext(ctx context.Context, us *
 
 	us.UpdatedAt = time.Now()
 
-	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+	err := withContext(r.db, ctx).Transaction(func(tx *gorm.DB) error {
 		// Verify subscription exists and get current state
 		var current models.UserSubscription
 		if err := tx.First(&current, us.ID).Error; err != nil {
@@ -215,17 +332,354 @@ func (r *UserSubscriptionRepository) UpdateWithContext(ctx context.Context, us *
 		return nil
 	})
 
+	if isInvalidValue(err) {
+		dbOperations.WithLabelValues("update_subscription", "invalid").Inc()
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
 	if err != nil {
-		r.logger.Error("failed to update user subscription",
-			zap.Error(err),
+		logDBError(ctx, r.logger, err, "failed to update user subscription",
 			zap.Uint("id", us.ID),
 			zap.Uint("user_id", us.UserID),
 		)
-		dbOperations.WithLabelValues("update_subscription", "failed").Inc()
-		return fmt.Errorf("%w: %v", ErrDatabaseOperation, err)
+		dbOperations.WithLabelValues("update_subscription", dbErrorStatus(ctx, err)).Inc()
+		return dbError(ctx, err)
 	}
 
 	dbOperations.WithLabelValues("update_subscription", "success").Inc()
+	r.publish(events.SubscriptionUpdated, us.UserID, us.ID)
+	return nil
+}
+
+// RenewExpiring extends active auto-renew subscriptions ending within the
+// given window by one period of their plan, and returns how many were renewed.
+func (r *UserSubscriptionRepository) RenewExpiring(ctx context.Context, within time.Duration) (int, error) {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("renew_expiring").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "UserSubscriptionRepository.RenewExpiring")
+	defer span.End()
+
+	var renewed []models.UserSubscription
+	err := withContext(r.db, ctx).Transaction(func(tx *gorm.DB) error {
+		var expiring []models.UserSubscription
+		if err := tx.
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("is_active = ? AND auto_renew = ? AND end_date <= ?", true, true, time.Now().Add(within)).
+			Preload("Subscription").
+			Find(&expiring).Error; err != nil {
+			return err
+		}
+
+		for _, us := range expiring {
+			months := us.Subscription.PeriodMonths
+			if months <= 0 {
+				months = 12
+			}
+
+			if err := tx.Model(&models.UserSubscription{}).
+				Where("id = ?", us.ID).
+				Updates(map[string]interface{}{
+					"end_date":   us.EndDate.AddDate(0, months, 0),
+					"updated_at": time.Now(),
+				}).Error; err != nil {
+				return err
+			}
+			renewed = append(renewed, us)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		logDBError(ctx, r.logger, err, "failed to renew expiring subscriptions")
+		dbOperations.WithLabelValues("renew_expiring", dbErrorStatus(ctx, err)).Inc()
+		return 0, dbError(ctx, err)
+	}
+
+	dbOperations.WithLabelValues("renew_expiring", "success").Inc()
+	for _, us := range renewed {
+		r.publish(events.SubscriptionRenewed, us.UserID, us.ID)
+	}
+	return len(renewed), nil
+}
+
+// GetExpiringWithin returns active subscriptions ending within d that have
+// not been notified since their current expiry window opened, so a renewed
+// subscription is notified again for its new end date. The user is preloaded.
+func (r *UserSubscriptionRepository) GetExpiringWithin(ctx context.Context, d time.Duration) ([]models.UserSubscription, error) {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("get_expiring").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "UserSubscriptionRepository.GetExpiringWithin")
+	defer span.End()
+
+	now := time.Now()
+	var candidates []models.UserSubscription
+	err := withContext(r.db, ctx).
+		Where("is_active = ? AND end_date > ? AND end_date <= ?", true, now, now.Add(d)).
+		Preload("User").
+		Preload("Subscription").
+		Order("end_date").
+		Find(&candidates).Error
+	if err != nil {
+		logDBError(ctx, r.logger, err, "failed to get expiring subscriptions")
+		dbOperations.WithLabelValues("get_expiring", dbErrorStatus(ctx, err)).Inc()
+		return nil, dbError(ctx, err)
+	}
+
+	expiring := candidates[:0]
+	for _, us := range candidates {
+		if us.LastNotifiedAt == nil || us.LastNotifiedAt.Before(us.EndDate.Add(-d)) {
+			expiring = append(expiring, us)
+		}
+	}
+
+	dbOperations.WithLabelValues("get_expiring", "success").Inc()
+	return expiring, nil
+}
+
+// MarkNotified records that the expiry notice for a subscription was sent.
+func (r *UserSubscriptionRepository) MarkNotified(ctx context.Context, id uint, at time.Time) error {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("mark_notified").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "UserSubscriptionRepository.MarkNotified")
+	defer span.End()
+
+	result := withContext(r.db, ctx).
+		Model(&models.UserSubscription{}).
+		Where("id = ?", id).
+		Update("last_notified_at", at)
+	if result.Error != nil {
+		logDBError(ctx, r.logger, result.Error, "failed to mark subscription notified",
+			zap.Uint("subscription_id", id),
+		)
+		dbOperations.WithLabelValues("mark_notified", dbErrorStatus(ctx, result.Error)).Inc()
+		return dbError(ctx, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		dbOperations.WithLabelValues("mark_notified", "not_found").Inc()
+		return ErrNotFound
+	}
+
+	dbOperations.WithLabelValues("mark_notified", "success").Inc()
+	return nil
+}
+
+// DeactivateExpired marks active subscriptions past their end date as
+// inactive and returns how many rows were changed.
+func (r *UserSubscriptionRepository) DeactivateExpired(ctx context.Context) (int64, error) {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("deactivate_expired").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "UserSubscriptionRepository.DeactivateExpired")
+	defer span.End()
+
+	now := time.Now()
+	// RETURNING gives the rows that changed so their owners can be notified
+	var expired []models.UserSubscription
+	result := withContext(r.db, ctx).
+		Model(&expired).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}, {Name: "user_id"}}}).
+		Where("is_active = ? AND end_date <= ?", true, now).
+		Updates(map[string]interface{}{
+			"is_active":  false,
+			"updated_at": now,
+		})
+
+	if result.Error != nil {
+		logDBError(ctx, r.logger, result.Error, "failed to deactivate expired subscriptions")
+		dbOperations.WithLabelValues("deactivate_expired", dbErrorStatus(ctx, result.Error)).Inc()
+		return 0, dbError(ctx, result.Error)
+	}
+
+	dbOperations.WithLabelValues("deactivate_expired", "success").Inc()
+	for _, us := range expired {
+		r.publish(events.SubscriptionExpired, us.UserID, us.ID)
+	}
+	return result.RowsAffected, nil
+}
+
+// ChangePlanWithContext moves a user subscription onto another plan and
+// returns the updated record with its new plan loaded. Dates are left as-is.
+func (r *UserSubscriptionRepository) ChangePlanWithContext(ctx context.Context, id, planID uint, subType models.SubscriptionType) (*models.UserSubscription, error) {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("change_plan").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "UserSubscriptionRepository.ChangePlanWithContext")
+	defer span.End()
+
+	var us models.UserSubscription
+	err := withContext(r.db, ctx).Transaction(func(tx *gorm.DB) error {
+		var plan models.Subscription
+		if err := tx.First(&plan, planID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrPlanNotFound
+			}
+			return err
+		}
+
+		result := tx.Model(&models.UserSubscription{}).
+			Where("id = ?", id).
+			Updates(map[string]interface{}{
+				"subscription_id": planID,
+				"type":            subType,
+				"updated_at":      time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		return tx.Preload(clause.Associations).First(&us, id).Error
+	})
+
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrPlanNotFound) {
+		dbOperations.WithLabelValues("change_plan", "not_found").Inc()
+		return nil, err
+	}
+	if isInvalidValue(err) {
+		dbOperations.WithLabelValues("change_plan", "invalid").Inc()
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	if err != nil {
+		logDBError(ctx, r.logger, err, "failed to change subscription plan",
+			zap.Uint("id", id),
+			zap.Uint("plan_id", planID),
+		)
+		dbOperations.WithLabelValues("change_plan", dbErrorStatus(ctx, err)).Inc()
+		return nil, dbError(ctx, err)
+	}
+
+	dbOperations.WithLabelValues("change_plan", "success").Inc()
+	r.publish(events.SubscriptionPlanChanged, us.UserID, us.ID)
+	return &us, nil
+}
+
+// SeatUsage is how many seats of a plan a company is using
+type SeatUsage struct {
+	// MaxSeats is 0 when the plan has no seat limit
+	MaxSeats int
+	Used     int64
+}
+
+// Remaining is the number of seats still free, or -1 when unlimited
+func (u SeatUsage) Remaining() int64 {
+	if u.MaxSeats <= 0 {
+		return -1
+	}
+	if remaining := int64(u.MaxSeats) - u.Used; remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// SeatUsageWithContext reports the seats of plan planID used by active
+// enterprise subscriptions of companyName.
+func (r *UserSubscriptionRepository) SeatUsageWithContext(ctx context.Context, planID uint, companyName string) (*SeatUsage, error) {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("seat_usage").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "UserSubscriptionRepository.SeatUsageWithContext")
+	defer span.End()
+
+	var plan models.Subscription
+	if err := withContext(r.db, ctx).First(&plan, planID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			dbOperations.WithLabelValues("seat_usage", "not_found").Inc()
+			return nil, ErrPlanNotFound
+		}
+		dbOperations.WithLabelValues("seat_usage", dbErrorStatus(ctx, err)).Inc()
+		return nil, dbError(ctx, err)
+	}
+
+	used, err := countSeats(withContext(r.db, ctx), planID, companyName)
+	if err != nil {
+		logDBError(ctx, r.logger, err, "failed to count seats",
+			zap.Uint("plan_id", planID),
+		)
+		dbOperations.WithLabelValues("seat_usage", dbErrorStatus(ctx, err)).Inc()
+		return nil, dbError(ctx, err)
+	}
+
+	dbOperations.WithLabelValues("seat_usage", "success").Inc()
+	return &SeatUsage{MaxSeats: plan.MaxSeats, Used: used}, nil
+}
+
+// CountActiveBySubscriptionID counts the active, unexpired subscriptions of
+// each plan in one grouped query. Plans without any are left out.
+func (r *UserSubscriptionRepository) CountActiveBySubscriptionID(ctx context.Context) (map[uint]int64, error) {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("count_active_by_plan").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "UserSubscriptionRepository.CountActiveBySubscriptionID")
+	defer span.End()
+
+	var rows []struct {
+		SubscriptionID uint
+		Count          int64
+	}
+	err := withContext(r.db, ctx).Model(&models.UserSubscription{}).
+		Select("subscription_id, COUNT(*) AS count").
+		Where("is_active = ? AND end_date > ?", true, time.Now()).
+		Group("subscription_id").
+		Scan(&rows).Error
+	if err != nil {
+		logDBError(ctx, r.logger, err, "failed to count active subscriptions by plan")
+		dbOperations.WithLabelValues("count_active_by_plan", dbErrorStatus(ctx, err)).Inc()
+		return nil, dbError(ctx, err)
+	}
+
+	counts := make(map[uint]int64, len(rows))
+	for _, row := range rows {
+		counts[row.SubscriptionID] = row.Count
+	}
+
+	dbOperations.WithLabelValues("count_active_by_plan", "success").Inc()
+	return counts, nil
+}
+
+// countSeats counts the active enterprise subscriptions of companyName on a plan
+func countSeats(tx *gorm.DB, planID uint, companyName string) (int64, error) {
+	var used int64
+	err := tx.Model(&models.UserSubscription{}).
+		Where("subscription_id = ? AND company_name = ? AND type = ? AND is_active = ? AND end_date > ?",
+			planID, companyName, models.Enterprise, true, time.Now()).
+		Count(&used).Error
+	return used, err
+}
+
+// checkSeatAvailable returns ErrSeatLimitReached when companyName has used
+// every seat of the plan. The plan row is locked so concurrent assignments
+// can't both take the last seat.
+func checkSeatAvailable(tx *gorm.DB, planID uint, companyName string) error {
+	var plan models.Subscription
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&plan, planID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrPlanNotFound
+		}
+		return err
+	}
+	if plan.MaxSeats <= 0 {
+		return nil
+	}
+
+	used, err := countSeats(tx, planID, companyName)
+	if err != nil {
+		return err
+	}
+	if used >= int64(plan.MaxSeats) {
+		return ErrSeatLimitReached
+	}
 	return nil
 }
 
@@ -236,9 +690,13 @@ func (r *UserSubscriptionRepository) CancelSubscription(ctx context.Context, id
 	defer func() {
 		dbDuration.WithLabelValues("cancel_subscription").Observe(time.Since(start).Seconds())
 	}()
+	ctx, span := startSpan(ctx, "UserSubscriptionRepository.CancelSubscription")
+	defer span.End()
 
-	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
-		result := tx.Model(&models.UserSubscription{}).
+	var cancelled models.UserSubscription
+	err := withContext(r.db, ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&cancelled).
+			Clauses(clause.Returning{Columns: []clause.Column{{Name: "user_id"}}}).
 			Where("id = ? AND is_active = ?", id, true).
 			Updates(map[string]interface{}{
 				"is_active":  false,
@@ -257,14 +715,55 @@ func (r *UserSubscriptionRepository) CancelSubscription(ctx context.Context, id
 	})
 
 	if err != nil {
-		r.logger.Error("failed to cancel subscription",
-			zap.Error(err),
+		if errors.Is(err, ErrNotFound) {
+			dbOperations.WithLabelValues("cancel_subscription", "not_found").Inc()
+			return ErrNotFound
+		}
+		logDBError(ctx, r.logger, err, "failed to cancel subscription",
 			zap.Uint("id", id),
 		)
-		dbOperations.WithLabelValues("cancel_subscription", "failed").Inc()
-		return fmt.Errorf("%w: %v", ErrDatabaseOperation, err)
+		dbOperations.WithLabelValues("cancel_subscription", dbErrorStatus(ctx, err)).Inc()
+		return dbError(ctx, err)
 	}
 
 	dbOperations.WithLabelValues("cancel_subscription", "success").Inc()
+	r.publish(events.SubscriptionCancelled, cancelled.UserID, id)
 	return nil
 }
+
+// CancelAllForUser deactivates every active subscription of userID in one
+// transaction and returns how many were cancelled. Inactive subscriptions
+// are left as they are.
+func (r *UserSubscriptionRepository) CancelAllForUser(ctx context.Context, userID uint) (int64, error) {
+	start := time.Now()
+	defer func() {
+		dbDuration.WithLabelValues("cancel_all_subscriptions").Observe(time.Since(start).Seconds())
+	}()
+	ctx, span := startSpan(ctx, "UserSubscriptionRepository.CancelAllForUser")
+	defer span.End()
+
+	var cancelled []models.UserSubscription
+	err := withContext(r.db, ctx).Transaction(func(tx *gorm.DB) error {
+		return tx.Model(&cancelled).
+			Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
+			Where("user_id = ? AND is_active = ?", userID, true).
+			Updates(map[string]interface{}{
+				"is_active":  false,
+				"updated_at": time.Now(),
+			}).Error
+	})
+
+	if err != nil {
+		logDBError(ctx, r.logger, err, "failed to cancel user subscriptions",
+			zap.Uint("user_id", userID),
+		)
+		dbOperations.WithLabelValues("cancel_all_subscriptions", dbErrorStatus(ctx, err)).Inc()
+		return 0, dbError(ctx, err)
+	}
+
+	dbOperations.WithLabelValues("cancel_all_subscriptions", "success").Inc()
+	for _, us := range cancelled {
+		r.publish(events.SubscriptionCancelled, userID, us.ID)
+	}
+	return int64(len(cancelled)), nil
+}
@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap"
+
+	"github.com/JorgeSaicoski/login-go/internal/models"
+	"github.com/JorgeSaicoski/login-go/internal/testutil"
+)
+
+func TestCancelAllForUser(t *testing.T) {
+	db := testutil.NewDB(t)
+	repo := NewUserSubscriptionRepository(db, zap.NewNop())
+	ctx := context.Background()
+
+	basic := createTestPlan(t, db, "basic")
+	pro := createTestPlan(t, db, "pro")
+	alice := createTestUser(t, db, "alice")
+	bob := createTestUser(t, db, "bob")
+	createTestSubscription(t, db, alice, basic, time.Now(), true)
+	createTestSubscription(t, db, alice, pro, time.Now(), true)
+	createTestSubscription(t, db, alice, basic, time.Now().AddDate(0, -3, 0), false)
+	createTestSubscription(t, db, bob, basic, time.Now(), true)
+
+	cancelled, err := repo.CancelAllForUser(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("CancelAllForUser: %v", err)
+	}
+	if cancelled != 2 {
+		t.Fatalf("cancelled %d, want 2", cancelled)
+	}
+
+	var active int64
+	db.Model(&models.UserSubscription{}).Where("user_id = ? AND is_active = ?", alice.ID, true).Count(&active)
+	if active != 0 {
+		t.Fatalf("%d subscriptions still active", active)
+	}
+	db.Model(&models.UserSubscription{}).Where("user_id = ? AND is_active = ?", bob.ID, true).Count(&active)
+	if active != 1 {
+		t.Fatal("another user's subscription was cancelled")
+	}
+
+	// Nothing is left to cancel the second time
+	cancelled, err = repo.CancelAllForUser(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("second CancelAllForUser: %v", err)
+	}
+	if cancelled != 0 {
+		t.Fatalf("second call cancelled %d, want 0", cancelled)
+	}
+}
+
+func TestCountActiveBySubscriptionID(t *testing.T) {
+	db := testutil.NewDB(t)
+	repo := NewUserSubscriptionRepository(db, zap.NewNop())
+
+	basic := createTestPlan(t, db, "basic")
+	pro := createTestPlan(t, db, "pro")
+	unused := createTestPlan(t, db, "unused")
+	alice := createTestUser(t, db, "alice")
+	bob := createTestUser(t, db, "bob")
+	carol := createTestUser(t, db, "carol")
+	createTestSubscription(t, db, alice, basic, time.Now(), true)
+	createTestSubscription(t, db, bob, basic, time.Now(), true)
+	createTestSubscription(t, db, carol, pro, time.Now(), true)
+	// Inactive and expired rows are not counted
+	createTestSubscription(t, db, carol, basic, time.Now(), false)
+	createTestSubscription(t, db, alice, pro, time.Now().AddDate(0, -2, 0), true)
+
+	counts, err := repo.CountActiveBySubscriptionID(context.Background())
+	if err != nil {
+		t.Fatalf("CountActiveBySubscriptionID: %v", err)
+	}
+	if counts[basic.ID] != 2 || counts[pro.ID] != 1 {
+		t.Fatalf("counts = %v, want basic 2, pro 1", counts)
+	}
+	if _, ok := counts[unused.ID]; ok || len(counts) != 2 {
+		t.Fatalf("counts = %v, want only plans with active subscriptions", counts)
+	}
+}
+
+func TestInvalidSubscriptionTypeRejected(t *testing.T) {
+	db := testutil.NewDB(t)
+	repo := NewUserSubscriptionRepository(db, zap.NewNop())
+	ctx := context.Background()
+	user := createTestUser(t, db, "alice")
+	plan := createTestPlan(t, db, "basic")
+
+	for _, typ := range []models.SubscriptionType{"premium", "INDIVIDUAL"} {
+		us := &models.UserSubscription{
+			UserID:         user.ID,
+			SubscriptionID: plan.ID,
+			Type:           typ,
+			StartDate:      time.Now(),
+			EndDate:        time.Now().AddDate(0, 1, 0),
+			IsActive:       true,
+		}
+		if err := repo.CreateWithContext(ctx, us); !errors.Is(err, ErrInvalidInput) {
+			t.Fatalf("create with type %q: err = %v, want ErrInvalidInput", typ, err)
+		}
+	}
+
+	existing := createTestSubscription(t, db, user, plan, time.Now(), true)
+	existing.Type = "premium"
+	if err := repo.UpdateWithContext(ctx, existing); !errors.Is(err, ErrInvalidInput) {
+		t.Fatalf("update: err = %v, want ErrInvalidInput", err)
+	}
+
+	var stored models.UserSubscription
+	if err := db.First(&stored, existing.ID).Error; err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if stored.Type != models.Individual {
+		t.Fatalf("type = %q, want %q", stored.Type, models.Individual)
+	}
+}
+
+// The check constraint is Postgres only; its violation must map to
+// ErrInvalidInput like the model hook does
+func TestIsInvalidValue(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{models.ErrInvalidSubscriptionType, true},
+		{fmt.Errorf("insert: %w", &pgconn.PgError{Code: pgCheckViolation}), true},
+		{&pgconn.PgError{Code: "23505"}, false},
+		{errors.New("connection refused"), false},
+	}
+	for _, tt := range tests {
+		if got := isInvalidValue(tt.err); got != tt.want {
+			t.Errorf("isInvalidValue(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
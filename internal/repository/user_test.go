@@ -0,0 +1,296 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/JorgeSaicoski/login-go/internal/models"
+	"github.com/JorgeSaicoski/login-go/internal/testutil"
+)
+
+func TestDeleteUserKeepsSubscriptionsForRestore(t *testing.T) {
+	db := testutil.NewDB(t)
+	repo := NewUserRepository(db, zap.NewNop())
+	ctx := context.Background()
+
+	plan := createTestPlan(t, db, "basic")
+	alice := createTestUser(t, db, "alice")
+	bob := createTestUser(t, db, "bob")
+	createTestSubscription(t, db, alice, plan, time.Now(), true)
+	createTestSubscription(t, db, alice, plan, time.Now().AddDate(0, -2, 0), false)
+	createTestSubscription(t, db, bob, plan, time.Now(), true)
+
+	deleted, err := repo.DeleteAndReturnWithContext(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("DeleteAndReturnWithContext: %v", err)
+	}
+	if len(deleted.Subscriptions) != 2 {
+		t.Fatalf("returned %d subscriptions, want 2", len(deleted.Subscriptions))
+	}
+
+	var visible, kept int64
+	db.Model(&models.UserSubscription{}).Where("user_id = ?", alice.ID).Count(&visible)
+	db.Unscoped().Model(&models.UserSubscription{}).Where("user_id = ?", alice.ID).Count(&kept)
+	if visible != 0 || kept != 2 {
+		t.Fatalf("after delete: %d visible, %d kept; want 0 visible, 2 kept", visible, kept)
+	}
+
+	// A plan with subscriptions of a deleted user is still in use
+	if err := NewSubscriptionRepository(db).DeleteWithContext(ctx, plan.ID); !errors.Is(err, ErrSubscriptionInUse) {
+		t.Fatalf("delete plan: err = %v, want ErrSubscriptionInUse", err)
+	}
+
+	if err := repo.RestoreUser(ctx, alice.ID); err != nil {
+		t.Fatalf("RestoreUser: %v", err)
+	}
+	var restored []models.UserSubscription
+	if err := db.Where("user_id = ?", alice.ID).Find(&restored).Error; err != nil {
+		t.Fatalf("load subscriptions: %v", err)
+	}
+	if len(restored) != 2 {
+		t.Fatalf("restored %d subscriptions, want 2", len(restored))
+	}
+
+	var bobs int64
+	db.Model(&models.UserSubscription{}).Where("user_id = ?", bob.ID).Count(&bobs)
+	if bobs != 1 {
+		t.Fatalf("other user has %d subscriptions, want 1", bobs)
+	}
+}
+
+func TestRestoreUserLeavesSeparatelyDeletedSubscriptions(t *testing.T) {
+	db := testutil.NewDB(t)
+	repo := NewUserRepository(db, zap.NewNop())
+	ctx := context.Background()
+
+	plan := createTestPlan(t, db, "basic")
+	alice := createTestUser(t, db, "alice")
+	createTestSubscription(t, db, alice, plan, time.Now(), true)
+	old := createTestSubscription(t, db, alice, plan, time.Now().AddDate(-1, 0, 0), false)
+	if err := db.Delete(old).Error; err != nil {
+		t.Fatalf("delete old subscription: %v", err)
+	}
+
+	if err := repo.DeleteWithContext(ctx, alice.ID); err != nil {
+		t.Fatalf("DeleteWithContext: %v", err)
+	}
+	if err := repo.RestoreUser(ctx, alice.ID); err != nil {
+		t.Fatalf("RestoreUser: %v", err)
+	}
+
+	var count int64
+	db.Model(&models.UserSubscription{}).Where("user_id = ?", alice.ID).Count(&count)
+	if count != 1 {
+		t.Fatalf("%d subscriptions after restore, want 1", count)
+	}
+}
+
+func TestRestoreUserNotDeleted(t *testing.T) {
+	db := testutil.NewDB(t)
+	repo := NewUserRepository(db, zap.NewNop())
+	alice := createTestUser(t, db, "alice")
+
+	if err := repo.RestoreUser(context.Background(), alice.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestUpdateSetsUpdatedAt(t *testing.T) {
+	db := testutil.NewDB(t)
+	repo := NewUserRepository(db, zap.NewNop())
+	ctx := context.Background()
+
+	alice := createTestUser(t, db, "alice")
+	// Start from a known past value so the change is unambiguous
+	before := time.Now().Add(-time.Hour).UTC().Truncate(time.Second)
+	if err := db.Model(alice).UpdateColumn("updated_at", before).Error; err != nil {
+		t.Fatalf("set updated_at: %v", err)
+	}
+
+	user, err := repo.GetByIDWithContext(ctx, alice.ID)
+	if err != nil {
+		t.Fatalf("GetByIDWithContext: %v", err)
+	}
+	user.Name = "Alice Smith"
+	if err := repo.UpdateWithContext(ctx, user); err != nil {
+		t.Fatalf("UpdateWithContext: %v", err)
+	}
+
+	var got models.User
+	if err := db.First(&got, alice.ID).Error; err != nil {
+		t.Fatalf("reload user: %v", err)
+	}
+	if !got.UpdatedAt.After(before) {
+		t.Fatalf("updated_at = %v, want after %v", got.UpdatedAt, before)
+	}
+	if !got.CreatedAt.Equal(alice.CreatedAt) {
+		t.Fatalf("created_at changed from %v to %v", alice.CreatedAt, got.CreatedAt)
+	}
+}
+
+func TestMixedCaseIdentifiersCollide(t *testing.T) {
+	db := testutil.NewDB(t)
+	repo := NewUserRepository(db, zap.NewNop())
+	ctx := context.Background()
+
+	newUser := func(username, email string) *models.User {
+		return &models.User{Name: username, UsernameForLogin: username, Email: email, Password: "Secret123", Active: true}
+	}
+
+	bob := newUser(" Bob ", "Bob@Example.com")
+	if err := repo.CreateWithContext(ctx, bob); err != nil {
+		t.Fatalf("create Bob: %v", err)
+	}
+	if bob.UsernameForLogin != "bob" || bob.Email != "bob@example.com" {
+		t.Fatalf("stored %q / %q, want normalized identifiers", bob.UsernameForLogin, bob.Email)
+	}
+
+	if err := repo.CreateWithContext(ctx, newUser("BOB", "other@example.com")); !errors.Is(err, ErrDuplicateEntry) {
+		t.Fatalf("create BOB: err = %v, want ErrDuplicateEntry", err)
+	}
+	if err := repo.CreateWithContext(ctx, newUser("robert", "BOB@example.COM")); !errors.Is(err, ErrDuplicateEntry) {
+		t.Fatalf("create with BOB@example.COM: err = %v, want ErrDuplicateEntry", err)
+	}
+
+	carol := newUser("carol", "carol@example.com")
+	if err := repo.CreateWithContext(ctx, carol); err != nil {
+		t.Fatalf("create carol: %v", err)
+	}
+	carol.Email = "bOb@example.com"
+	if err := repo.UpdateWithContext(ctx, carol); !errors.Is(err, ErrDuplicateEntry) {
+		t.Fatalf("update to bOb@example.com: err = %v, want ErrDuplicateEntry", err)
+	}
+
+	// The database enforces it too, whatever path the write takes
+	raw := &models.User{Name: "x", UsernameForLogin: "x", Email: "x@example.com", Password: "hash"}
+	if err := db.Create(raw).Error; err != nil {
+		t.Fatalf("create x: %v", err)
+	}
+	if err := db.Exec("UPDATE users SET username_for_login = ? WHERE id = ?", "BOB", raw.ID).Error; err == nil {
+		t.Fatal("database accepted a username differing only in case")
+	}
+
+	for _, lookup := range []func() (*models.User, error){
+		func() (*models.User, error) { return repo.GetByUsernameWithContext(ctx, "BoB") },
+		func() (*models.User, error) { return repo.GetByEmailWithContext(ctx, "BOB@EXAMPLE.COM") },
+	} {
+		user, err := lookup()
+		if err != nil {
+			t.Fatalf("lookup: %v", err)
+		}
+		if user.ID != bob.ID {
+			t.Fatalf("lookup found user %d, want %d", user.ID, bob.ID)
+		}
+	}
+}
+
+func TestUserList(t *testing.T) {
+	db := testutil.NewDB(t)
+	repo := NewUserRepository(db, zap.NewNop())
+	ctx := context.Background()
+
+	base := time.Now().Add(-time.Hour)
+	for i, name := range []string{"alice", "bob", "malia", "carol"} {
+		user := createTestUser(t, db, name)
+		if err := db.Model(user).UpdateColumn("created_at", base.Add(time.Duration(i)*time.Minute)).Error; err != nil {
+			t.Fatalf("set created_at: %v", err)
+		}
+	}
+	// A literal underscore must not act as a wildcard
+	if err := db.Model(&models.User{}).Where("username_for_login = ?", "carol").UpdateColumn("name", "Carol_Smith").Error; err != nil {
+		t.Fatalf("rename: %v", err)
+	}
+
+	names := func(users []models.User) string {
+		out := make([]string, 0, len(users))
+		for _, u := range users {
+			out = append(out, u.UsernameForLogin)
+		}
+		return fmt.Sprint(out)
+	}
+
+	tests := []struct {
+		search    string
+		limit     int
+		offset    int
+		want      string
+		wantTotal int64
+	}{
+		{search: "", limit: 10, want: "[carol malia bob alice]", wantTotal: 4},
+		{search: "", limit: 2, offset: 1, want: "[malia bob]", wantTotal: 4},
+		{search: "ALI", limit: 10, want: "[malia alice]", wantTotal: 2},
+		{search: "bob@EXAMPLE", limit: 10, want: "[bob]", wantTotal: 1},
+		{search: "l_s", limit: 10, want: "[carol]", wantTotal: 1},
+		{search: "l_", limit: 10, want: "[carol]", wantTotal: 1},
+		{search: "%", limit: 10, want: "[]", wantTotal: 0},
+	}
+	for _, tt := range tests {
+		users, total, err := repo.List(ctx, tt.limit, tt.offset, tt.search)
+		if err != nil {
+			t.Fatalf("List(%q): %v", tt.search, err)
+		}
+		if got := names(users); got != tt.want || total != tt.wantTotal {
+			t.Errorf("List(%q, %d, %d) = %s total %d, want %s total %d", tt.search, tt.limit, tt.offset, got, total, tt.want, tt.wantTotal)
+		}
+	}
+}
+
+func TestUserListCapsLimit(t *testing.T) {
+	db := testutil.NewDB(t)
+	repo := NewUserRepository(db, zap.NewNop())
+
+	for i := 0; i < MaxUserListLimit+5; i++ {
+		createTestUser(t, db, fmt.Sprintf("user%03d", i))
+	}
+
+	for _, limit := range []int{0, MaxUserListLimit + 1, 1000} {
+		users, total, err := repo.List(context.Background(), limit, 0, "")
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if len(users) != MaxUserListLimit || total != MaxUserListLimit+5 {
+			t.Errorf("limit %d: got %d users, total %d", limit, len(users), total)
+		}
+	}
+}
+
+func TestGetByUsernameOrEmail(t *testing.T) {
+	db := testutil.NewDB(t)
+	repo := NewUserRepository(db, zap.NewNop())
+	ctx := context.Background()
+
+	alice := createTestUser(t, db, "alice")
+	// A username that equals another user's email takes precedence
+	squatter := &models.User{Name: "squatter", UsernameForLogin: "bob@example.com", Email: "squatter@example.com", Password: "hash", Active: true}
+	if err := db.Create(squatter).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	createTestUser(t, db, "bob")
+
+	tests := []struct {
+		identifier string
+		want       uint
+	}{
+		{"ALICE", alice.ID},
+		{"Alice@Example.com", alice.ID},
+		{"bob@example.com", squatter.ID},
+	}
+	for _, tt := range tests {
+		user, err := repo.GetByUsernameOrEmailWithContext(ctx, tt.identifier)
+		if err != nil {
+			t.Fatalf("lookup %q: %v", tt.identifier, err)
+		}
+		if user.ID != tt.want {
+			t.Errorf("lookup %q = user %d, want %d", tt.identifier, user.ID, tt.want)
+		}
+	}
+
+	if _, err := repo.GetByUsernameOrEmailWithContext(ctx, "nobody"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("unknown identifier: err = %v, want ErrNotFound", err)
+	}
+}
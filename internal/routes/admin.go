@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/JorgeSaicoski/login-go/internal/handlers"
+)
+
+func SetupAdminRoutes(r *gin.Engine, userHandler *handlers.UserHandler, auth Auth) {
+	admin := r.Group("/admin", auth.Required, auth.Admin)
+	{
+		admin.GET("/users", userHandler.List)
+		admin.POST("/users/bulk", userHandler.BulkCreate)
+		admin.POST("/users/:id/restore", userHandler.Restore)
+		admin.POST("/users/:id/suspend", userHandler.Suspend)
+		admin.POST("/users/:id/reactivate", userHandler.Reactivate)
+		admin.GET("/users/:id/audit", userHandler.ListAuditEvents)
+	}
+}
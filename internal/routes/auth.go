@@ -10,6 +10,18 @@ func SetupAuthRoutes(r *gin.Engine, authHandler *handlers.AuthHandler) {
 	auth := r.Group("/auth")
 	{
 		auth.POST("/login", authHandler.Login)
+		auth.POST("/password/expired", authHandler.ChangeExpiredPassword)
 		auth.POST("/validate", authHandler.ValidateToken)
+		auth.POST("/introspect", authHandler.Introspect)
+		auth.POST("/refresh", authHandler.Refresh)
+		auth.POST("/logout", authHandler.Logout)
+		auth.POST("/logout-all", authHandler.LogoutAll)
+		auth.GET("/me", authHandler.AuthMiddleware(), authHandler.Me)
+		auth.POST("/renew", authHandler.AuthMiddleware(), authHandler.Renew)
+		auth.GET("/sessions", authHandler.AuthMiddleware(), authHandler.Sessions)
+		auth.DELETE("/sessions/:id", authHandler.AuthMiddleware(), authHandler.RevokeSession)
+		auth.GET("/verify", authHandler.VerifyEmail)
+		auth.POST("/verify/resend", authHandler.ResendVerification)
+		auth.GET("/confirm-email", authHandler.ConfirmEmail)
 	}
 }
@@ -0,0 +1,34 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JorgeSaicoski/login-go/internal/handlers"
+	"github.com/JorgeSaicoski/login-go/internal/metrics"
+)
+
+// SetupMetricsRoutes exposes the Prometheus metrics. When token is set,
+// scrapers must send it as a bearer token.
+func SetupMetricsRoutes(r *gin.Engine, token string) {
+	handler := gin.WrapH(metrics.Handler())
+	if token == "" {
+		r.GET("/metrics", handler)
+		return
+	}
+	r.GET("/metrics", metricsTokenMiddleware(token), handler)
+}
+
+func metricsTokenMiddleware(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			handlers.AbortWithError(c, &handlers.AppError{Status: http.StatusUnauthorized, Code: handlers.CodeInvalidToken, Message: "invalid metrics token"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,331 @@
+package routes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	"github.com/JorgeSaicoski/login-go/internal/handlers"
+	"github.com/JorgeSaicoski/login-go/internal/logging"
+	"github.com/JorgeSaicoski/login-go/internal/models"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+	// RequestIDKey is the gin context key holding the request ID
+	RequestIDKey = "request_id"
+
+	maxRequestIDLength = 128
+)
+
+// Auth holds the middlewares for protected route groups, so setup
+// functions don't need the AuthHandler itself.
+type Auth struct {
+	// Required rejects requests without a valid access token
+	Required gin.HandlerFunc
+	// Admin rejects non-admin users; it must run after Required
+	Admin gin.HandlerFunc
+	// SelfOrAdmin rejects users other than the one in the :id path
+	// parameter, unless they are admins; it must run after Required
+	SelfOrAdmin gin.HandlerFunc
+}
+
+func NewAuth(authHandler *handlers.AuthHandler) Auth {
+	return Auth{
+		Required:    authHandler.AuthMiddleware(),
+		Admin:       authHandler.RequireRole(models.RoleAdmin),
+		SelfOrAdmin: authHandler.RequireSelfOrAdmin("id"),
+	}
+}
+
+const (
+	corsAllowMethods = "GET, POST, PUT, PATCH, DELETE, OPTIONS"
+	corsAllowHeaders = "Authorization, Content-Type, X-Request-ID"
+	corsMaxAge       = "600"
+)
+
+// CORSMiddleware echoes back allowed origins and answers preflight requests.
+// Requests from other origins get no CORS headers at all, never a wildcard,
+// since credentials are allowed.
+func CORSMiddleware(allowedOrigins []string) gin.HandlerFunc {
+	allowed := make(map[string]struct{}, len(allowedOrigins))
+	for _, origin := range allowedOrigins {
+		allowed[strings.TrimRight(origin, "/")] = struct{}{}
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		_, ok := allowed[origin]
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+
+		if !ok {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		c.Header("Access-Control-Allow-Origin", origin)
+		c.Header("Access-Control-Allow-Credentials", "true")
+		c.Writer.Header().Add("Vary", "Origin")
+
+		if preflight {
+			c.Header("Access-Control-Allow-Methods", corsAllowMethods)
+			c.Header("Access-Control-Allow-Headers", corsAllowHeaders)
+			c.Header("Access-Control-Max-Age", corsMaxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequestIDMiddleware reuses a sane incoming X-Request-ID or generates a
+// new one, and exposes it on the gin context, the request context (for
+// loggers further down) and the response headers.
+func RequestIDMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		requestID := c.GetHeader(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = logging.NewRequestID()
+		}
+
+		c.Set(RequestIDKey, requestID)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), requestID))
+		c.Header(RequestIDHeader, requestID)
+
+		c.Next()
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Paths too noisy to be worth an access log line
+var accessLogSkipPaths = map[string]struct{}{
+	"/health":  {},
+	"/metrics": {},
+}
+
+// ZapLoggerMiddleware writes one structured access log line per request
+func ZapLoggerMiddleware(logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		path := c.Request.URL.Path
+
+		c.Next()
+
+		if _, skip := accessLogSkipPaths[path]; skip {
+			return
+		}
+
+		status := c.Writer.Status()
+		fields := []zap.Field{
+			zap.String("method", c.Request.Method),
+			zap.String("path", path),
+			zap.Int("status", status),
+			zap.Duration("latency", time.Since(start)),
+			zap.String("client_ip", c.ClientIP()),
+			zap.String("request_id", c.GetString(RequestIDKey)),
+		}
+		if len(c.Errors) > 0 {
+			fields = append(fields, zap.String("errors", c.Errors.String()))
+		}
+
+		switch {
+		case status >= http.StatusInternalServerError:
+			logger.Error("request", fields...)
+		case status >= http.StatusBadRequest:
+			logger.Warn("request", fields...)
+		default:
+			logger.Info("request", fields...)
+		}
+	}
+}
+
+// ZapRecoveryMiddleware recovers from panics in handlers, logs them with a
+// stack trace and responds with a 500
+func ZapRecoveryMiddleware(logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if rec := recover(); rec != nil {
+				logger.Error("panic recovered",
+					zap.Any("error", rec),
+					zap.String("path", c.Request.URL.Path),
+					zap.String("request_id", c.GetString(RequestIDKey)),
+					zap.Stack("stack"),
+				)
+				handlers.AbortWithError(c, &handlers.AppError{Status: http.StatusInternalServerError, Message: "internal server error"})
+			}
+		}()
+		c.Next()
+	}
+}
+
+type SecureHeadersOptions struct {
+	// HSTS sends Strict-Transport-Security; leave off when serving plain HTTP
+	HSTS       bool
+	HSTSMaxAge time.Duration
+	// FrameOptions is the X-Frame-Options value, DENY when empty
+	FrameOptions   string
+	ReferrerPolicy string
+}
+
+const (
+	defaultHSTSMaxAge     = 365 * 24 * time.Hour
+	defaultReferrerPolicy = "strict-origin-when-cross-origin"
+)
+
+// SecureHeadersMiddleware adds the standard hardening headers to every
+// response. A header that is already set is left alone.
+func SecureHeadersMiddleware(opts SecureHeadersOptions) gin.HandlerFunc {
+	if opts.FrameOptions == "" {
+		opts.FrameOptions = "DENY"
+	}
+	if opts.ReferrerPolicy == "" {
+		opts.ReferrerPolicy = defaultReferrerPolicy
+	}
+	if opts.HSTSMaxAge <= 0 {
+		opts.HSTSMaxAge = defaultHSTSMaxAge
+	}
+
+	headers := map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"X-Frame-Options":        opts.FrameOptions,
+		"Referrer-Policy":        opts.ReferrerPolicy,
+	}
+	if opts.HSTS {
+		headers["Strict-Transport-Security"] = fmt.Sprintf("max-age=%d; includeSubDomains", int(opts.HSTSMaxAge.Seconds()))
+	}
+
+	return func(c *gin.Context) {
+		h := c.Writer.Header()
+		for name, value := range headers {
+			if h.Get(name) == "" {
+				h.Set(name, value)
+			}
+		}
+		c.Next()
+	}
+}
+
+// OTelMiddleware starts a server span per request, continuing the trace
+// from the incoming traceparent header when there is one. It is a no-op
+// until a tracer provider is installed.
+func OTelMiddleware() gin.HandlerFunc {
+	tracer := otel.Tracer("github.com/JorgeSaicoski/login-go/internal/routes")
+
+	return func(c *gin.Context) {
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+
+		ctx, span := tracer.Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", route),
+				attribute.String("url.path", c.Request.URL.Path),
+			),
+		)
+		defer span.End()
+
+		if requestID, ok := c.Get(RequestIDKey); ok {
+			span.SetAttributes(attribute.String("request.id", fmt.Sprint(requestID)))
+		}
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
+// DefaultMaxBodyBytes is the request body cap used when none is configured
+const DefaultMaxBodyBytes int64 = 1 << 20
+
+// MaxBodyBytes rejects request bodies larger than n bytes with a 413.
+// overrides maps a route as registered (e.g. "/admin/users/bulk") to its
+// own limit. Bodies within the limit are buffered so handlers never read
+// past it, whether or not the client sent a Content-Length.
+func MaxBodyBytes(n int64, overrides map[string]int64) gin.HandlerFunc {
+	if n <= 0 {
+		n = DefaultMaxBodyBytes
+	}
+
+	return func(c *gin.Context) {
+		if c.Request.Body == nil || c.Request.Body == http.NoBody {
+			c.Next()
+			return
+		}
+
+		limit := n
+		if override, ok := overrides[c.FullPath()]; ok && override > 0 {
+			limit = override
+		}
+
+		if c.Request.ContentLength > limit {
+			abortBodyTooLarge(c, limit)
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, limit))
+		if err != nil {
+			var maxErr *http.MaxBytesError
+			if errors.As(err, &maxErr) {
+				abortBodyTooLarge(c, limit)
+				return
+			}
+			handlers.AbortWithError(c, &handlers.AppError{Status: http.StatusBadRequest, Code: handlers.CodeInvalidRequest, Message: "failed to read request body", Err: err})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		c.Next()
+	}
+}
+
+func abortBodyTooLarge(c *gin.Context, limit int64) {
+	handlers.AbortWithError(c, &handlers.AppError{
+		Status:  http.StatusRequestEntityTooLarge,
+		Code:    handlers.CodeBodyTooLarge,
+		Message: "request body too large",
+		Details: gin.H{"max_bytes": limit},
+	})
+}
@@ -0,0 +1,152 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JorgeSaicoski/login-go/internal/handlers"
+	"github.com/JorgeSaicoski/login-go/internal/models"
+)
+
+func TestAdminRequiresRole(t *testing.T) {
+	s := newTestServer(t)
+	s.router.GET("/admin-only", s.auth.Required, s.auth.Admin, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	user := s.createUser(t, "alice", models.RoleUser)
+	admin := s.createUser(t, "root", models.RoleAdmin)
+
+	if w := s.do(http.MethodGet, "/admin-only", s.token(t, user), ""); w.Code != http.StatusForbidden {
+		t.Fatalf("user without the role: status = %d, want 403", w.Code)
+	}
+	if w := s.do(http.MethodGet, "/admin-only", s.token(t, admin), ""); w.Code != http.StatusOK {
+		t.Fatalf("admin: status = %d, want 200 (body %s)", w.Code, w.Body.String())
+	}
+}
+
+func TestSecureHeadersMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	newRouter := func(opts SecureHeadersOptions) *gin.Engine {
+		router := gin.New()
+		router.Use(SecureHeadersMiddleware(opts))
+		router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+		return router
+	}
+	get := func(router *gin.Engine, path string, preset map[string]string) http.Header {
+		w := httptest.NewRecorder()
+		for name, value := range preset {
+			w.Header().Set(name, value)
+		}
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Header()
+	}
+
+	h := get(newRouter(SecureHeadersOptions{}), "/", nil)
+	for name, want := range map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"X-Frame-Options":        "DENY",
+		"Referrer-Policy":        "strict-origin-when-cross-origin",
+	} {
+		if got := h.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if got := h.Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("HSTS sent with HSTS off: %q", got)
+	}
+
+	h = get(newRouter(SecureHeadersOptions{HSTS: true, HSTSMaxAge: time.Hour, FrameOptions: "SAMEORIGIN"}), "/", nil)
+	if got := h.Get("Strict-Transport-Security"); got != "max-age=3600; includeSubDomains" {
+		t.Errorf("Strict-Transport-Security = %q", got)
+	}
+	if got := h.Get("X-Frame-Options"); got != "SAMEORIGIN" {
+		t.Errorf("X-Frame-Options = %q, want SAMEORIGIN", got)
+	}
+
+	// A header already set, e.g. by a wrapping proxy handler, is kept
+	h = get(newRouter(SecureHeadersOptions{}), "/", map[string]string{"X-Frame-Options": "ALLOW-FROM https://partner.example.com"})
+	if got := h.Get("X-Frame-Options"); got != "ALLOW-FROM https://partner.example.com" {
+		t.Errorf("existing X-Frame-Options overwritten: %q", got)
+	}
+}
+
+// Tokens outlive a suspension, so the middleware has to check the account
+func TestAuthRequiredRejectsSuspendedUser(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.createUser(t, "alice", models.RoleUser)
+	token := s.token(t, alice)
+	path := fmt.Sprintf("/user/%d", alice.ID)
+
+	if w := s.do(http.MethodGet, path, token, ""); w.Code != http.StatusOK {
+		t.Fatalf("before suspension: status = %d, want 200", w.Code)
+	}
+
+	if err := s.db.Model(alice).Update("active", false).Error; err != nil {
+		t.Fatalf("suspend user: %v", err)
+	}
+	w := s.do(http.MethodGet, path, token, "")
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("after suspension: status = %d, want 403", w.Code)
+	}
+	var resp handlers.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if resp.Error.Code != handlers.CodeAccountSuspended {
+		t.Fatalf("code = %q, want %q", resp.Error.Code, handlers.CodeAccountSuspended)
+	}
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(MaxBodyBytes(16, map[string]int64{"/bulk": 64}))
+	echo := func(c *gin.Context) {
+		var body map[string]string
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.JSON(http.StatusOK, body)
+	}
+	router.POST("/", echo)
+	router.POST("/bulk", echo)
+
+	post := func(path, body string, chunked bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if chunked {
+			// No Content-Length, so only reading the body can catch it
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	small := `{"a":"b"}`
+	large := `{"a":"` + strings.Repeat("x", 40) + `"}`
+
+	if w := post("/", small, false); w.Code != http.StatusOK {
+		t.Fatalf("small body: status = %d, want 200", w.Code)
+	}
+	for _, chunked := range []bool{false, true} {
+		w := post("/", large, chunked)
+		if w.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("oversized body (chunked %v): status = %d, want 413", chunked, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), handlers.CodeBodyTooLarge) {
+			t.Fatalf("oversized body (chunked %v): body %s lacks %s", chunked, w.Body.String(), handlers.CodeBodyTooLarge)
+		}
+	}
+	if w := post("/bulk", large, false); w.Code != http.StatusOK {
+		t.Fatalf("body within route override: status = %d, want 200", w.Code)
+	}
+}
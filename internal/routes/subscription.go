@@ -6,10 +6,20 @@ import (
 	"github.com/JorgeSaicoski/login-go/internal/handlers"
 )
 
-func SetupSubscriptionRoutes(r *gin.Engine, subscriptionHandler *handlers.SubscriptionHandler) {
-	subscription := r.Group("/subscription")
+func SetupSubscriptionRoutes(r *gin.Engine, subscriptionHandler *handlers.SubscriptionHandler, auth Auth) {
+	// Any signed-in user can read plans
+	subscription := r.Group("/subscription", auth.Required)
 	{
 		subscription.GET("/:id", subscriptionHandler.GetByID)
-		subscription.PATCH("/:id", subscriptionHandler.UpdateByID)
+	}
+
+	// Plan management is restricted to admins
+	admin := r.Group("/subscription", auth.Required, auth.Admin)
+	{
+		admin.POST("", subscriptionHandler.Create)
+		// Active subscribers and estimated revenue per plan
+		admin.GET("/stats", subscriptionHandler.Stats)
+		admin.PATCH("/:id", subscriptionHandler.UpdateByID)
+		admin.DELETE("/:id", subscriptionHandler.DeleteByID)
 	}
 }
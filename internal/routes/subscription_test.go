@@ -0,0 +1,67 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/JorgeSaicoski/login-go/internal/handlers"
+	"github.com/JorgeSaicoski/login-go/internal/models"
+)
+
+func TestSubscriptionStats(t *testing.T) {
+	s := newTestServer(t)
+	admin := s.createUser(t, "admin", models.RoleAdmin)
+	alice := s.createUser(t, "alice", models.RoleUser)
+	bob := s.createUser(t, "bob", models.RoleUser)
+	basic := s.createPlan(t, "basic", 10)
+	pro := s.createPlan(t, "pro", 25)
+	s.createPlan(t, "unused", 50)
+
+	s.subscribe(t, alice, basic)
+	s.subscribe(t, bob, basic)
+	s.subscribe(t, alice, pro)
+	cancelled := s.subscribe(t, bob, pro)
+	if err := s.db.Model(cancelled).Update("is_active", false).Error; err != nil {
+		t.Fatalf("cancel subscription: %v", err)
+	}
+	expired := s.subscribe(t, admin, pro)
+	if err := s.db.Model(expired).Update("end_date", time.Now().Add(-time.Hour)).Error; err != nil {
+		t.Fatalf("expire subscription: %v", err)
+	}
+
+	if w := s.do(http.MethodGet, "/subscription/stats", s.token(t, alice), ""); w.Code != http.StatusForbidden {
+		t.Fatalf("non-admin: status = %d, want 403", w.Code)
+	}
+
+	w := s.do(http.MethodGet, "/subscription/stats", s.token(t, admin), "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200 (body %s)", w.Code, w.Body.String())
+	}
+	var stats handlers.SubscriptionStatsResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	want := map[string]struct {
+		count   int64
+		revenue float64
+	}{
+		"basic":  {2, 20},
+		"pro":    {1, 25},
+		"unused": {0, 0},
+	}
+	if len(stats.Plans) != len(want) {
+		t.Fatalf("got %d plans, want %d", len(stats.Plans), len(want))
+	}
+	for _, plan := range stats.Plans {
+		w := want[plan.Name]
+		if plan.ActiveSubscriptions != w.count || plan.EstimatedRevenue != w.revenue {
+			t.Errorf("%s: %d active, revenue %v; want %d, %v", plan.Name, plan.ActiveSubscriptions, plan.EstimatedRevenue, w.count, w.revenue)
+		}
+	}
+	if stats.ActiveSubscriptions != 3 || stats.EstimatedRevenue != 45 {
+		t.Fatalf("totals: %d active, revenue %v; want 3, 45", stats.ActiveSubscriptions, stats.EstimatedRevenue)
+	}
+}
@@ -6,11 +6,19 @@ import (
 	"github.com/JorgeSaicoski/login-go/internal/handlers"
 )
 
-func SetupUserRoutes(r *gin.Engine, userHandler *handlers.UserHandler) {
+func SetupUserRoutes(r *gin.Engine, userHandler *handlers.UserHandler, auth Auth) {
 	user := r.Group("/user")
 	{
-		user.GET("/:id", userHandler.GetByID)
-		user.PATCH("/:id", userHandler.UpdateByID)
 		user.POST("/register", userHandler.Create)
+		user.GET("/availability", userHandler.Availability)
+	}
+
+	// Handlers below compare the path ID with the authenticated user
+	protected := r.Group("/user", auth.Required)
+	{
+		protected.GET("/:id", userHandler.GetByID)
+		protected.PATCH("/:id", userHandler.UpdateByID)
+		protected.DELETE("/:id", userHandler.DeleteByID)
+		protected.POST("/:id/password", userHandler.ChangePassword)
 	}
 }
@@ -6,15 +6,31 @@ import (
 	"github.com/JorgeSaicoski/login-go/internal/handlers"
 )
 
-func SetupUserSubscriptionRoutes(r *gin.Engine, handler *handlers.UserSubscriptionHandler) {
-	// Nested under user routes for better resource hierarchy
-	user := r.Group("/user")
+func SetupUserSubscriptionRoutes(r *gin.Engine, handler *handlers.UserSubscriptionHandler, auth Auth) {
+	// Nested under user routes for better resource hierarchy. The user
+	// segment is :id to match the wildcard name used by the user routes;
+	// gin panics on conflicting names for the same path segment. Every
+	// route acts on the :id user's subscriptions, so only that user or an
+	// admin may use them.
+	subscriptions := r.Group("/user/:id/subscription", auth.Required, auth.SelfOrAdmin)
 	{
 		// Get all subscriptions for a user
-		user.GET("/:userId/subscription", handler.GetUserSubscriptions)
+		subscriptions.GET("", handler.GetUserSubscriptions)
+		// Live subscription changes for a user as Server-Sent Events
+		subscriptions.GET("/events", handler.Events)
+		// Get only active, non-expired subscriptions for a user
+		subscriptions.GET("/active", handler.GetActiveUserSubscriptions)
 		// Create/Assign a specific subscription to a user
-		user.POST("/:userId/subscription/:subscriptionId", handler.Create)
+		subscriptions.POST("/:subscriptionId", handler.Create)
 		// Update a specific user's subscription
-		user.PATCH("/:userId/subscription/:subscriptionId", handler.UpdateUserSubscription)
+		subscriptions.PATCH("/:subscriptionId", handler.UpdateUserSubscription)
+		// Switch a user's subscription to another plan, with proration
+		subscriptions.POST("/:subscriptionId/change", handler.ChangePlan)
+		// Seat usage of the company on an enterprise subscription's plan
+		subscriptions.GET("/:subscriptionId/seats", handler.GetSeats)
+		// Cancel all of a user's active subscriptions
+		subscriptions.POST("/cancel-all", handler.CancelAll)
+		// Cancel a specific user's subscription
+		subscriptions.DELETE("/:subscriptionId", handler.Cancel)
 	}
 }
@@ -0,0 +1,349 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"gorm.io/gorm"
+
+	"github.com/JorgeSaicoski/login-go/internal/handlers"
+	"github.com/JorgeSaicoski/login-go/internal/models"
+	"github.com/JorgeSaicoski/login-go/internal/repository"
+	"github.com/JorgeSaicoski/login-go/internal/services"
+	"github.com/JorgeSaicoski/login-go/internal/testutil"
+)
+
+// testServer is the router with the real auth middleware, user, plan and
+// user subscription handlers over a test database
+type testServer struct {
+	router      *gin.Engine
+	db          *gorm.DB
+	authService *services.AuthService
+	auth        Auth
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db := testutil.NewDB(t)
+	logger := zap.NewNop()
+	userRepo := repository.NewUserRepository(db, logger)
+	userSubscriptionRepo := repository.NewUserSubscriptionRepository(db, logger)
+
+	authService, err := services.NewAuthService(userRepo, repository.NewRefreshTokenRepository(db, logger), nil, nil, nil, logger, services.AuthConfig{
+		Algorithm:   services.AlgorithmHS256,
+		HMACSecret:  "test-secret",
+		TokenExpiry: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("NewAuthService: %v", err)
+	}
+
+	authHandler := handlers.NewAuthHandler(authService, nil, userRepo, userSubscriptionRepo, nil, logger, nil, rate.Inf, 1, handlers.Timeouts{})
+	passwordHistory := services.NewPasswordHistoryService(repository.NewPasswordHistoryRepository(db, logger), 3, logger)
+	userHandler := handlers.NewUserHandler(userRepo, nil, nil, passwordHistory, logger, handlers.NewValidator(), rate.Inf, 1, handlers.Timeouts{})
+	subscriptionHandler := handlers.NewUserSubscriptionHandler(userSubscriptionRepo, logger, nil, rate.Inf, 1, handlers.Timeouts{})
+
+	router := gin.New()
+	auth := NewAuth(authHandler)
+	SetupUserRoutes(router, userHandler, auth)
+	SetupUserSubscriptionRoutes(router, subscriptionHandler, auth)
+	SetupSubscriptionRoutes(router, handlers.NewSubscriptionHandler(repository.NewSubscriptionRepository(db), userSubscriptionRepo, handlers.Timeouts{}), auth)
+	return &testServer{router: router, db: db, authService: authService, auth: auth}
+}
+
+func (s *testServer) createUser(t *testing.T, username, role string) *models.User {
+	t.Helper()
+	user := &models.User{
+		Name:             username,
+		UsernameForLogin: username,
+		Email:            username + "@example.com",
+		Password:         "Secret123",
+		Role:             role,
+		Active:           true,
+	}
+	if err := user.HashPassword(); err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	if err := s.db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func (s *testServer) token(t *testing.T, user *models.User) string {
+	t.Helper()
+	token, err := s.authService.GenerateToken(context.Background(), user)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	return token
+}
+
+func (s *testServer) do(method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+	return w
+}
+
+func (s *testServer) createPlan(t *testing.T, name string, price float64) *models.Subscription {
+	t.Helper()
+	plan := &models.Subscription{Name: name, Price: price, PeriodMonths: 1}
+	if err := s.db.Create(plan).Error; err != nil {
+		t.Fatalf("create plan: %v", err)
+	}
+	return plan
+}
+
+func (s *testServer) subscribe(t *testing.T, user *models.User, plan *models.Subscription) *models.UserSubscription {
+	t.Helper()
+	us := &models.UserSubscription{
+		UserID:         user.ID,
+		SubscriptionID: plan.ID,
+		Type:           models.Individual,
+		StartDate:      time.Now(),
+		EndDate:        time.Now().AddDate(0, 1, 0),
+		IsActive:       true,
+	}
+	if err := s.db.Create(us).Error; err != nil {
+		t.Fatalf("create user subscription: %v", err)
+	}
+	return us
+}
+
+func TestUserSubscriptionRoutesRequireSelfOrAdmin(t *testing.T) {
+	type fixture struct {
+		owner, other, admin *models.User
+		plan, otherPlan     *models.Subscription
+		subscription        *models.UserSubscription
+	}
+
+	routes := []struct {
+		name       string
+		method     string
+		path       func(f fixture) string
+		body       func(f fixture) string
+		wantStatus int
+	}{
+		{
+			name:       "list",
+			method:     http.MethodGet,
+			path:       func(f fixture) string { return fmt.Sprintf("/user/%d/subscription", f.owner.ID) },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "create",
+			method:     http.MethodPost,
+			path:       func(f fixture) string { return fmt.Sprintf("/user/%d/subscription/%d", f.owner.ID, f.otherPlan.ID) },
+			body:       func(f fixture) string { return `{"type":"individual"}` },
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "update",
+			method:     http.MethodPatch,
+			path:       func(f fixture) string { return fmt.Sprintf("/user/%d/subscription/%d", f.owner.ID, f.subscription.ID) },
+			body:       func(f fixture) string { return `{"role":"billing"}` },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:   "change plan",
+			method: http.MethodPost,
+			path: func(f fixture) string {
+				return fmt.Sprintf("/user/%d/subscription/%d/change", f.owner.ID, f.subscription.ID)
+			},
+			body:       func(f fixture) string { return fmt.Sprintf(`{"subscription_id":%d}`, f.otherPlan.ID) },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "cancel",
+			method:     http.MethodDelete,
+			path:       func(f fixture) string { return fmt.Sprintf("/user/%d/subscription/%d", f.owner.ID, f.subscription.ID) },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "cancel all",
+			method:     http.MethodPost,
+			path:       func(f fixture) string { return fmt.Sprintf("/user/%d/subscription/cancel-all", f.owner.ID) },
+			wantStatus: http.StatusOK,
+		},
+	}
+
+	callers := []struct {
+		name   string
+		caller func(f fixture) *models.User
+		allow  bool
+	}{
+		{name: "owner", caller: func(f fixture) *models.User { return f.owner }, allow: true},
+		{name: "other user", caller: func(f fixture) *models.User { return f.other }, allow: false},
+		{name: "admin", caller: func(f fixture) *models.User { return f.admin }, allow: true},
+	}
+
+	for _, route := range routes {
+		for _, caller := range callers {
+			t.Run(route.name+"/"+caller.name, func(t *testing.T) {
+				s := newTestServer(t)
+				f := fixture{
+					owner: s.createUser(t, "owner", models.RoleUser),
+					other: s.createUser(t, "other", models.RoleUser),
+					admin: s.createUser(t, "admin", models.RoleAdmin),
+				}
+				f.plan = s.createPlan(t, "basic", 10)
+				f.otherPlan = s.createPlan(t, "pro", 20)
+				f.subscription = s.subscribe(t, f.owner, f.plan)
+
+				var body string
+				if route.body != nil {
+					body = route.body(f)
+				}
+				w := s.do(route.method, route.path(f), s.token(t, caller.caller(f)), body)
+
+				want := http.StatusForbidden
+				if caller.allow {
+					want = route.wantStatus
+				}
+				if w.Code != want {
+					t.Fatalf("status = %d, want %d (body %s)", w.Code, want, w.Body.String())
+				}
+
+				if !caller.allow {
+					// The rejected call must not have changed anything
+					var rows []models.UserSubscription
+					if err := s.db.Find(&rows).Error; err != nil {
+						t.Fatalf("load subscriptions: %v", err)
+					}
+					if len(rows) != 1 {
+						t.Fatalf("got %d user subscriptions, want 1", len(rows))
+					}
+					got := rows[0]
+					if got.SubscriptionID != f.plan.ID || !got.IsActive || got.Role != "" {
+						t.Fatalf("subscription changed by rejected call: %+v", got)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestUpdateSubscriptionStartedLastMonth(t *testing.T) {
+	s := newTestServer(t)
+	owner := s.createUser(t, "owner", models.RoleUser)
+	us := s.subscribe(t, owner, s.createPlan(t, "basic", 10))
+	startDate := time.Now().AddDate(0, -1, 0).UTC().Truncate(time.Second)
+	if err := s.db.Model(us).Updates(map[string]interface{}{
+		"start_date": startDate,
+		"end_date":   startDate.AddDate(0, 1, 0),
+	}).Error; err != nil {
+		t.Fatalf("backdate subscription: %v", err)
+	}
+	path := fmt.Sprintf("/user/%d/subscription/%d", owner.ID, us.ID)
+	token := s.token(t, owner)
+
+	newEnd := startDate.AddDate(0, 3, 0)
+	w := s.do(http.MethodPatch, path, token, fmt.Sprintf(`{"end_date":%q}`, newEnd.Format(time.RFC3339)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("extend end date: status = %d, want 200 (body %s)", w.Code, w.Body.String())
+	}
+	var got models.UserSubscription
+	if err := s.db.First(&got, us.ID).Error; err != nil {
+		t.Fatalf("reload subscription: %v", err)
+	}
+	if !got.EndDate.Equal(newEnd) || !got.StartDate.Equal(startDate) {
+		t.Fatalf("dates = %v - %v, want %v - %v", got.StartDate, got.EndDate, startDate, newEnd)
+	}
+
+	// Ordering is still checked on update
+	w = s.do(http.MethodPatch, path, token, fmt.Sprintf(`{"end_date":%q}`, startDate.AddDate(0, 0, -1).Format(time.RFC3339)))
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("end before start: status = %d, want 400 (body %s)", w.Code, w.Body.String())
+	}
+}
+
+func TestGetUserSubscriptionsExpand(t *testing.T) {
+	s := newTestServer(t)
+	owner := s.createUser(t, "owner", models.RoleUser)
+	plan := s.createPlan(t, "basic", 10)
+	s.subscribe(t, owner, plan)
+	token := s.token(t, owner)
+	path := fmt.Sprintf("/user/%d/subscription", owner.ID)
+
+	list := func(query string) []map[string]interface{} {
+		t.Helper()
+		w := s.do(http.MethodGet, path+query, token, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s: status = %d, want 200 (body %s)", query, w.Code, w.Body.String())
+		}
+		var resp struct {
+			Data []map[string]interface{} `json:"data"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if len(resp.Data) != 1 {
+			t.Fatalf("got %d rows, want 1", len(resp.Data))
+		}
+		if resp.Data[0]["subscription_id"] != float64(plan.ID) {
+			t.Fatalf("subscription_id = %v, want %d", resp.Data[0]["subscription_id"], plan.ID)
+		}
+		return resp.Data
+	}
+
+	if row := list("")[0]; row["subscription"] != nil {
+		t.Fatalf("plan embedded without expand: %v", row["subscription"])
+	}
+
+	embedded, ok := list("?expand=subscription")[0]["subscription"].(map[string]interface{})
+	if !ok || embedded["name"] != plan.Name {
+		t.Fatalf("expanded plan = %v, want %q", embedded, plan.Name)
+	}
+
+	if w := s.do(http.MethodGet, path+"?expand=plan", token, ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("unknown expand: status = %d, want 400", w.Code)
+	}
+}
+
+func TestCreateDuplicateActiveSubscription(t *testing.T) {
+	s := newTestServer(t)
+	owner := s.createUser(t, "owner", models.RoleUser)
+	plan := s.createPlan(t, "basic", 10)
+	token := s.token(t, owner)
+	path := fmt.Sprintf("/user/%d/subscription/%d", owner.ID, plan.ID)
+
+	if w := s.do(http.MethodPost, path, token, `{"type":"individual"}`); w.Code != http.StatusCreated {
+		t.Fatalf("first subscribe: status = %d, want 201 (body %s)", w.Code, w.Body.String())
+	}
+
+	w := s.do(http.MethodPost, path, token, `{"type":"individual"}`)
+	if w.Code != http.StatusConflict {
+		t.Fatalf("second subscribe: status = %d, want 409 (body %s)", w.Code, w.Body.String())
+	}
+	var resp handlers.ErrorResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Error.Code != handlers.CodeSubscriptionExists {
+		t.Fatalf("code = %q, want %q", resp.Error.Code, handlers.CodeSubscriptionExists)
+	}
+
+	var count int64
+	if err := s.db.Model(&models.UserSubscription{}).Where("user_id = ?", owner.ID).Count(&count).Error; err != nil {
+		t.Fatalf("count subscriptions: %v", err)
+	}
+	if count != 1 {
+		t.Fatalf("%d subscriptions stored, want 1", count)
+	}
+}
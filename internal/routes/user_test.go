@@ -0,0 +1,155 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/JorgeSaicoski/login-go/internal/handlers"
+	"github.com/JorgeSaicoski/login-go/internal/models"
+)
+
+// A request without a token must be turned away by the auth middleware with
+// token_missing, not reach the handler and fail its own identity check.
+func TestUserRoutesRejectMissingTokenInMiddleware(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.createUser(t, "alice", models.RoleUser)
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{http.MethodGet, "/user/%d", ""},
+		{http.MethodPatch, "/user/%d", `{"name":"Mallory"}`},
+		{http.MethodDelete, "/user/%d", ""},
+		{http.MethodPost, "/user/%d/password", `{"old_password":"Secret123","new_password":"Rotated456"}`},
+		{http.MethodGet, "/user/%d/subscription", ""},
+	}
+	for _, tt := range tests {
+		path := fmt.Sprintf(tt.path, alice.ID)
+		t.Run(tt.method+" "+path, func(t *testing.T) {
+			w := s.do(tt.method, path, "", tt.body)
+			if w.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, want 401: %s", w.Code, w.Body)
+			}
+			var resp handlers.ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode response: %v", err)
+			}
+			if resp.Error.Code != handlers.CodeTokenMissing {
+				t.Fatalf("code = %q, want %q", resp.Error.Code, handlers.CodeTokenMissing)
+			}
+		})
+	}
+
+	var user models.User
+	if err := s.db.First(&user, alice.ID).Error; err != nil {
+		t.Fatalf("user was deleted: %v", err)
+	}
+	if user.Name != alice.Name || user.CheckPassword("Secret123") != nil {
+		t.Fatal("user was modified by an unauthenticated request")
+	}
+}
+
+func TestAuthRequiredStopsBeforeHandler(t *testing.T) {
+	s := newTestServer(t)
+	reached := false
+	s.router.GET("/probe", s.auth.Required, func(c *gin.Context) {
+		reached = true
+		c.Status(http.StatusOK)
+	})
+
+	w := s.do(http.MethodGet, "/probe", "", "")
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", w.Code)
+	}
+	if reached {
+		t.Fatal("handler ran for a request without a token")
+	}
+}
+
+func TestChangePassword(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.createUser(t, "alice", models.RoleUser)
+	path := fmt.Sprintf("/user/%d/password", alice.ID)
+	token := s.token(t, alice)
+
+	change := func(oldPassword, newPassword string) *httptest.ResponseRecorder {
+		return s.do(http.MethodPost, path, token, fmt.Sprintf(`{"old_password":%q,"new_password":%q}`, oldPassword, newPassword))
+	}
+	reload := func() models.User {
+		var user models.User
+		if err := s.db.First(&user, alice.ID).Error; err != nil {
+			t.Fatalf("reload user: %v", err)
+		}
+		return user
+	}
+
+	if w := change("Wrong123", "Rotated456"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong old password: status = %d, want 401", w.Code)
+	}
+
+	if w := change("Secret123", "Rotated456"); w.Code != http.StatusOK {
+		t.Fatalf("change: status = %d, want 200 (body %s)", w.Code, w.Body.String())
+	}
+	user := reload()
+	if user.CheckPassword("Rotated456") != nil {
+		t.Fatal("new password was not saved")
+	}
+	if user.Name != alice.Name || user.Email != alice.Email {
+		t.Fatalf("profile changed by password change: %+v", user)
+	}
+
+	// The previous password is in the history now
+	w := change("Rotated456", "Secret123")
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), handlers.CodePasswordReused) {
+		t.Fatalf("reuse: status = %d, want 400 password_reused (body %s)", w.Code, w.Body.String())
+	}
+	if user := reload(); user.CheckPassword("Rotated456") != nil {
+		t.Fatal("rejected change replaced the password")
+	}
+}
+
+// An authenticated request gets through the middleware and the handler sees
+// the user it set on the context.
+func TestUserRoutesAuthenticatedRequestReachesHandler(t *testing.T) {
+	s := newTestServer(t)
+	alice := s.createUser(t, "alice", models.RoleUser)
+	token := s.token(t, alice)
+
+	w := s.do(http.MethodGet, fmt.Sprintf("/user/%d", alice.ID), token, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("get own user: status = %d, want 200 (body %s)", w.Code, w.Body.String())
+	}
+	var user handlers.UserResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &user); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if user.ID != alice.ID || user.Username != "alice" {
+		t.Fatalf("got user %d %q, want %d alice", user.ID, user.Username, alice.ID)
+	}
+
+	w = s.do(http.MethodPatch, fmt.Sprintf("/user/%d", alice.ID), token, `{"name":"Alice Smith"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("update own user: status = %d, want 200 (body %s)", w.Code, w.Body.String())
+	}
+	var stored models.User
+	if err := s.db.First(&stored, alice.ID).Error; err != nil {
+		t.Fatalf("reload user: %v", err)
+	}
+	if stored.Name != "Alice Smith" {
+		t.Fatalf("name = %q, want Alice Smith", stored.Name)
+	}
+
+	// The handler's own identity check still applies past the middleware
+	bob := s.createUser(t, "bob", models.RoleUser)
+	if w := s.do(http.MethodGet, fmt.Sprintf("/user/%d", bob.ID), token, ""); w.Code != http.StatusForbidden {
+		t.Fatalf("get other user: status = %d, want 403", w.Code)
+	}
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/JorgeSaicoski/login-go/internal/logging"
+	"github.com/JorgeSaicoski/login-go/internal/models"
+	"github.com/JorgeSaicoski/login-go/internal/repository"
+)
+
+const auditWriteTimeout = 5 * time.Second
+
+type clientInfoKey struct{}
+
+type clientInfo struct {
+	ip        string
+	userAgent string
+}
+
+// WithClientInfo attaches the caller's IP and user agent to ctx so audit
+// events recorded further down can include them.
+func WithClientInfo(ctx context.Context, ip, userAgent string) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, clientInfo{ip: ip, userAgent: userAgent})
+}
+
+func clientInfoFromContext(ctx context.Context) clientInfo {
+	info, _ := ctx.Value(clientInfoKey{}).(clientInfo)
+	return info
+}
+
+// AuditService records authentication events. Writes are best-effort and
+// happen in the background so they never slow down or fail the caller.
+type AuditService struct {
+	repo   *repository.AuditRepository
+	logger *zap.Logger
+}
+
+func NewAuditService(repo *repository.AuditRepository, logger *zap.Logger) *AuditService {
+	return &AuditService{
+		repo:   repo,
+		logger: logger,
+	}
+}
+
+// Record queues an event for userID. A nil AuditService records nothing.
+func (s *AuditService) Record(ctx context.Context, userID uint, eventType models.AuthEventType) {
+	if s == nil {
+		return
+	}
+
+	info := clientInfoFromContext(ctx)
+	event := &models.AuthEvent{
+		UserID:    userID,
+		Event:     eventType,
+		IP:        info.ip,
+		UserAgent: info.userAgent,
+	}
+
+	// Keep the request ID for logging but not the request's deadline
+	bg := context.WithoutCancel(ctx)
+	go func() {
+		writeCtx, cancel := context.WithTimeout(bg, auditWriteTimeout)
+		defer cancel()
+
+		if err := s.repo.Record(writeCtx, event); err != nil {
+			logging.FromContext(writeCtx, s.logger).Warn("dropped auth event",
+				zap.Uint("user_id", userID),
+				zap.String("event", string(eventType)),
+				zap.Error(err),
+			)
+		}
+	}()
+}
+
+func (s *AuditService) ListByUserID(ctx context.Context, userID uint, limit, offset int) ([]models.AuthEvent, int64, error) {
+	return s.repo.ListByUserID(ctx, userID, limit, offset)
+}
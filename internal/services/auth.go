@@ -2,17 +2,24 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
 	"crypto/rsa"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/bcrypt"
 
+	"github.com/JorgeSaicoski/login-go/internal/logging"
+	"github.com/JorgeSaicoski/login-go/internal/metrics"
 	"github.com/JorgeSaicoski/login-go/internal/models"
 	"github.com/JorgeSaicoski/login-go/internal/repository"
 )
@@ -36,165 +43,1063 @@ var (
 )
 
 func init() {
-	prometheus.MustRegister(authOperations, authDuration)
+	metrics.Register(authOperations, authDuration)
 }
 
+const (
+	defaultTokenExpiry        = 15 * time.Minute
+	defaultRefreshTokenExpiry = 7 * 24 * time.Hour
+	defaultRenewalWindow      = 24 * time.Hour
+	defaultKeyID              = "default"
+	defaultIssuer             = "login-go"
+	defaultClockSkewLeeway    = 30 * time.Second
+)
+
+// Supported token signing algorithms
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmHS256 = "HS256"
+)
+
+// LoginIdentifier is what users may log in with
+type LoginIdentifier string
+
+const (
+	LoginIdentifierUsername LoginIdentifier = "username"
+	LoginIdentifierEmail    LoginIdentifier = "email"
+	// LoginIdentifierEither tries the identifier as a username, then as an
+	// email address
+	LoginIdentifierEither LoginIdentifier = "either"
+)
+
+var (
+	ErrInvalidToken     = errors.New("invalid token")
+	ErrTokenExpired     = errors.New("token expired")
+	ErrTokenNotYetValid = errors.New("token not yet valid")
+	ErrTokenMalformed   = errors.New("malformed token")
+	ErrInvalidTokenType = errors.New("invalid token type")
+	ErrTokenRevoked     = errors.New("token revoked")
+	ErrUnknownKeyID     = errors.New("no verification key for kid")
+	ErrInvalidIssuer    = errors.New("token issuer not accepted")
+	ErrInvalidAudience  = errors.New("token audience not accepted")
+
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrAccountLocked      = errors.New("account temporarily locked")
+	ErrAccountSuspended   = errors.New("account suspended")
+	ErrPasswordExpired    = errors.New("password expired")
+	ErrRenewalExpired     = errors.New("token too old to renew")
+	// ErrIdentifierNotAllowed is a login with an email address when only
+	// usernames are accepted, or the other way round
+	ErrIdentifierNotAllowed = errors.New("login identifier not allowed")
+)
+
 type AuthService struct {
-	userRepo    *repository.UserRepository
-	logger      *zap.Logger
-	privateKey  *rsa.PrivateKey
-	publicKey   *rsa.PublicKey
-	tokenExpiry time.Duration
+	userRepo            *repository.UserRepository
+	refreshTokens       *repository.RefreshTokenRepository
+	revoker             TokenRevoker
+	loginAttempts       LoginAttemptTracker
+	audit               *AuditService
+	logger              *zap.Logger
+	signingMethod       jwt.SigningMethod
+	keysMu              sync.RWMutex
+	signingKID          string
+	legacyKID           string
+	privateKey          *rsa.PrivateKey
+	publicKeys          map[string]*rsa.PublicKey
+	hmacSecret          []byte
+	tokenExpiry         time.Duration
+	extendedTokenExpiry time.Duration
+	refreshTokenExpiry  time.Duration
+	renewalWindow       time.Duration
+	requireVerified     bool
+	passwordMaxAge      time.Duration
+	passwordExpiryBlock bool
+	loginIdentifier     LoginIdentifier
+	issuer              string
+	audience            string
+	leeway              time.Duration
+	extraClaims         ExtraClaimsFunc
+	sessions            *repository.SessionRepository
+	passwordHistory     *PasswordHistoryService
+}
+
+// TokenOption customizes a single issued token
+type TokenOption func(*models.Claims)
+
+// withAuthTime keeps the original login time on a renewed token
+func withAuthTime(authTime time.Time) TokenOption {
+	return func(claims *models.Claims) {
+		claims.AuthTime = jwt.NewNumericDate(authTime)
+	}
 }
 
+// WithExtraClaims adds claims to the token's "ext" object. Later options
+// overwrite earlier keys.
+func WithExtraClaims(extra map[string]interface{}) TokenOption {
+	return func(claims *models.Claims) {
+		if len(extra) == 0 {
+			return
+		}
+		if claims.Extra == nil {
+			claims.Extra = make(map[string]interface{}, len(extra))
+		}
+		for k, v := range extra {
+			claims.Extra[k] = v
+		}
+	}
+}
+
+// ExtraClaimsFunc returns the extra claims to embed in access tokens issued
+// to user at login and refresh.
+type ExtraClaimsFunc func(ctx context.Context, user *models.User) (map[string]interface{}, error)
+
 type AuthConfig struct {
+	// Algorithm is either AlgorithmRS256 (default) or AlgorithmHS256
+	Algorithm string
+	// Inline PEM keys take precedence over the key paths when set
+	PrivateKeyPEM  string
+	PublicKeyPEM   string
 	PrivateKeyPath string
 	PublicKeyPath  string
-	TokenExpiry    time.Duration
+	// KeyID identifies the configured RSA key pair in the token "kid" header
+	KeyID      string
+	HMACSecret string
+	// TokenExpiry is the access token lifetime; defaults to 15m
+	TokenExpiry time.Duration
+	// ExtendedTokenExpiry is used for "remember me" logins; when zero those
+	// logins get TokenExpiry like any other
+	ExtendedTokenExpiry time.Duration
+	RefreshTokenExpiry  time.Duration
+	// RenewalWindow is how long after login an access token may still be
+	// exchanged for a fresh one with RenewAccessToken; defaults to 24h
+	RenewalWindow    time.Duration
+	MaxLoginAttempts int
+	LockoutDuration  time.Duration
+	// RequireVerifiedEmail blocks login until the user verifies their email
+	RequireVerifiedEmail bool
+	// Issuer is set as "iss" and required on validation; defaults to login-go
+	Issuer string
+	// Audience, when set, is added as "aud" and required on validation so
+	// tokens minted for one service are not accepted by another
+	Audience string
+	// ClockSkewLeeway is how far exp and nbf may be off to allow for clock
+	// drift between services; defaults to 30s, negative disables it
+	ClockSkewLeeway time.Duration
+	// PasswordMaxAge is how long a password stays valid before it must be
+	// rotated; zero disables the policy. Expired logins are only flagged in
+	// the LoginResult unless PasswordExpiryStrict rejects them.
+	PasswordMaxAge       time.Duration
+	PasswordExpiryStrict bool
+	// LoginIdentifier restricts logins to usernames or email addresses;
+	// defaults to LoginIdentifierUsername
+	LoginIdentifier LoginIdentifier
 }
 
-func NewAuthService(userRepo *repository.UserRepository, logger *zap.Logger, config AuthConfig) (*AuthService, error) {
-	privateKey, err := loadPrivateKey(config.PrivateKeyPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load private key: %w", err)
+func NewAuthService(userRepo *repository.UserRepository, refreshTokens *repository.RefreshTokenRepository, revoker TokenRevoker, loginAttempts LoginAttemptTracker, audit *AuditService, logger *zap.Logger, config AuthConfig) (*AuthService, error) {
+	s := &AuthService{
+		userRepo:      userRepo,
+		refreshTokens: refreshTokens,
+		logger:        logger,
+	}
+
+	switch config.Algorithm {
+	case "", AlgorithmRS256:
+		privateKey, err := loadPrivateKey(config.PrivateKeyPEM, config.PrivateKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load private key: %w", err)
+		}
+
+		publicKey, err := loadPublicKey(config.PublicKeyPEM, config.PublicKeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load public key: %w", err)
+		}
+
+		keyID := config.KeyID
+		if keyID == "" {
+			keyID = defaultKeyID
+		}
+
+		s.signingMethod = jwt.SigningMethodRS256
+		s.signingKID = keyID
+		s.legacyKID = keyID
+		s.privateKey = privateKey
+		s.publicKeys = map[string]*rsa.PublicKey{keyID: publicKey}
+	case AlgorithmHS256:
+		if config.HMACSecret == "" {
+			return nil, errors.New("HMAC secret is required for HS256")
+		}
+		s.signingMethod = jwt.SigningMethodHS256
+		s.hmacSecret = []byte(config.HMACSecret)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", config.Algorithm)
+	}
+
+	refreshTokenExpiry := config.RefreshTokenExpiry
+	if refreshTokenExpiry == 0 {
+		refreshTokenExpiry = defaultRefreshTokenExpiry
+	}
+
+	if revoker == nil {
+		revoker = NewMemoryTokenRevoker()
+	}
+
+	if loginAttempts == nil {
+		loginAttempts = NewMemoryLoginAttemptTracker(config.MaxLoginAttempts, config.LockoutDuration)
+	}
+
+	s.revoker = revoker
+	s.loginAttempts = loginAttempts
+	s.audit = audit
+	s.tokenExpiry = config.TokenExpiry
+	if s.tokenExpiry <= 0 {
+		s.tokenExpiry = defaultTokenExpiry
+	}
+	s.extendedTokenExpiry = config.ExtendedTokenExpiry
+	if s.extendedTokenExpiry == 0 {
+		s.extendedTokenExpiry = s.tokenExpiry
+	}
+	s.refreshTokenExpiry = refreshTokenExpiry
+	s.renewalWindow = config.RenewalWindow
+	if s.renewalWindow <= 0 {
+		s.renewalWindow = defaultRenewalWindow
+	}
+	s.requireVerified = config.RequireVerifiedEmail
+	s.passwordMaxAge = config.PasswordMaxAge
+	s.passwordExpiryBlock = config.PasswordExpiryStrict
+	switch config.LoginIdentifier {
+	case "":
+		s.loginIdentifier = LoginIdentifierUsername
+	case LoginIdentifierUsername, LoginIdentifierEmail, LoginIdentifierEither:
+		s.loginIdentifier = config.LoginIdentifier
+	default:
+		return nil, fmt.Errorf("unsupported login identifier: %s", config.LoginIdentifier)
+	}
+	s.issuer = config.Issuer
+	if s.issuer == "" {
+		s.issuer = defaultIssuer
+	}
+	s.audience = config.Audience
+	s.leeway = config.ClockSkewLeeway
+	if s.leeway == 0 {
+		s.leeway = defaultClockSkewLeeway
+	} else if s.leeway < 0 {
+		s.leeway = 0
 	}
 
-	publicKey, err := loadPublicKey(config.PublicKeyPath)
+	// Generate the dummy hash up front so the first unknown-user login
+	// isn't slower than the rest
+	dummyPasswordHash()
+
+	return s, nil
+}
+
+// SetExtraClaimsFunc sets the hook used to add extra claims, such as tenant
+// and plan, to access tokens issued at login and refresh. Nil disables it.
+func (s *AuthService) SetExtraClaimsFunc(fn ExtraClaimsFunc) {
+	s.extraClaims = fn
+}
+
+func (s *AuthService) GenerateToken(ctx context.Context, user *models.User, opts ...TokenOption) (string, error) {
+	return s.GenerateTokenWithExpiry(ctx, user, s.tokenExpiry, opts...)
+}
+
+// GenerateTokenWithExpiry issues an access token that expires after the
+// given duration instead of the configured TokenExpiry.
+func (s *AuthService) GenerateTokenWithExpiry(ctx context.Context, user *models.User, expiry time.Duration, opts ...TokenOption) (string, error) {
+	token, _, err := s.generateToken(ctx, user, models.TokenTypeAccess, expiry, "generate_token", opts...)
+	return token, err
+}
+
+// AccessTokenExpiry is how long access tokens issued by Login live
+func (s *AuthService) AccessTokenExpiry(rememberMe bool) time.Duration {
+	if rememberMe {
+		return s.extendedTokenExpiry
+	}
+	return s.tokenExpiry
+}
+
+// userTokenOptions runs the extra claims hook for user. A failing hook is
+// logged and the token is issued without extra claims.
+func (s *AuthService) userTokenOptions(ctx context.Context, user *models.User) []TokenOption {
+	if s.extraClaims == nil {
+		return nil
+	}
+	extra, err := s.extraClaims(ctx, user)
 	if err != nil {
-		return nil, fmt.Errorf("failed to load public key: %w", err)
+		logging.FromContext(ctx, s.logger).Warn("failed to load extra token claims",
+			zap.Uint("user_id", user.ID),
+			zap.Error(err),
+		)
+		return nil
 	}
+	return []TokenOption{WithExtraClaims(extra)}
+}
 
-	return &AuthService{
-		userRepo:    userRepo,
-		logger:      logger,
-		privateKey:  privateKey,
-		publicKey:   publicKey,
-		tokenExpiry: config.TokenExpiry,
-	}, nil
+// GenerateRefreshToken issues a refresh token and stores its hash so it can
+// be revoked server-side. The token is not returned if it cannot be stored.
+func (s *AuthService) GenerateRefreshToken(ctx context.Context, user *models.User, opts ...TokenOption) (string, error) {
+	token, _, err := s.generateToken(ctx, user, models.TokenTypeRefresh, s.refreshTokenExpiry, "generate_refresh_token", opts...)
+	if err != nil || s.refreshTokens == nil {
+		return token, err
+	}
+
+	record := &models.RefreshToken{
+		TokenHash: hashToken(token),
+		UserID:    user.ID,
+		ExpiresAt: time.Now().Add(s.refreshTokenExpiry),
+	}
+	if err := s.refreshTokens.CreateWithContext(ctx, record); err != nil {
+		authOperations.WithLabelValues("generate_refresh_token", "failed").Inc()
+		return "", fmt.Errorf("failed to store refresh token: %w", err)
+	}
+	return token, nil
 }
 
-func (s *AuthService) GenerateToken(ctx context.Context, user *models.User) (string, error) {
+// generateToken signs a token and returns it with its "exp" time, as
+// encoded in the token.
+func (s *AuthService) generateToken(ctx context.Context, user *models.User, tokenType models.TokenType, expiry time.Duration, operation string, opts ...TokenOption) (string, time.Time, error) {
 	start := time.Now()
 	defer func() {
-		authDuration.WithLabelValues("generate_token").Observe(time.Since(start).Seconds())
+		authDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
 	}()
 
 	if user == nil || user.ID == 0 {
-		authOperations.WithLabelValues("generate_token", "failed").Inc()
-		return "", errors.New("invalid user")
+		authOperations.WithLabelValues(operation, "failed").Inc()
+		return "", time.Time{}, errors.New("invalid user")
+	}
+
+	jti, err := newTokenID()
+	if err != nil {
+		authOperations.WithLabelValues(operation, "failed").Inc()
+		return "", time.Time{}, fmt.Errorf("failed to generate token id: %w", err)
 	}
 
 	now := time.Now()
 	claims := &models.Claims{
-		UserID:   user.ID,
-		Username: user.UsernameForLogin,
+		UserID:    user.ID,
+		Username:  user.UsernameForLogin,
+		TokenType: tokenType,
+		Roles:     user.Roles(),
+		AuthTime:  jwt.NewNumericDate(now),
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(now.Add(s.tokenExpiry)),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expiry)),
 			IssuedAt:  jwt.NewNumericDate(now),
 			NotBefore: jwt.NewNumericDate(now),
-			Issuer:    "login-go",
+			Issuer:    s.issuer,
 			Subject:   fmt.Sprintf("%d", user.ID),
+			ID:        jti,
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	if s.audience != "" {
+		claims.Audience = jwt.ClaimStrings{s.audience}
+	}
+
+	for _, opt := range opts {
+		opt(claims)
+	}
+
+	token := jwt.NewWithClaims(s.signingMethod, claims)
 
-	signedToken, err := token.SignedString(s.privateKey)
+	kid, key := s.signingKey()
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signedToken, err := token.SignedString(key)
 	if err != nil {
-		s.logger.Error("failed to sign token",
+		logging.FromContext(ctx, s.logger).Error("failed to sign token",
 			zap.Error(err),
 			zap.Uint("user_id", user.ID),
+			zap.String("token_type", string(tokenType)),
 		)
-		authOperations.WithLabelValues("generate_token", "failed").Inc()
-		return "", fmt.Errorf("failed to sign token: %w", err)
+		authOperations.WithLabelValues(operation, "failed").Inc()
+		return "", time.Time{}, fmt.Errorf("failed to sign token: %w", err)
 	}
 
-	authOperations.WithLabelValues("generate_token", "success").Inc()
-	return signedToken, nil
+	authOperations.WithLabelValues(operation, "success").Inc()
+	return signedToken, claims.ExpiresAt.Time, nil
 }
 
+// ValidateToken verifies an access token. Refresh tokens are rejected so
+// they cannot be used to reach protected routes.
 func (s *AuthService) ValidateToken(ctx context.Context, tokenStr string) (*models.Claims, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.ValidateToken")
+	claims, err := s.validateToken(ctx, tokenStr, models.TokenTypeAccess, "validate_token")
+	if err == nil {
+		span.SetAttributes(attribute.Int64("user.id", int64(claims.UserID)))
+	}
+	endSpan(span, err)
+	return claims, err
+}
+
+// RefreshAccessToken exchanges a valid refresh token for a new access token.
+func (s *AuthService) RefreshAccessToken(ctx context.Context, refreshToken string) (string, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.RefreshAccessToken")
+	token, err := s.refreshAccessToken(ctx, refreshToken)
+	endSpan(span, err)
+	return token, err
+}
+
+func (s *AuthService) refreshAccessToken(ctx context.Context, refreshToken string) (string, error) {
+	start := time.Now()
+	defer func() {
+		authDuration.WithLabelValues("refresh_token").Observe(time.Since(start).Seconds())
+	}()
+
+	claims, err := s.validateToken(ctx, refreshToken, models.TokenTypeRefresh, "validate_refresh_token")
+	if err != nil {
+		authOperations.WithLabelValues("refresh_token", "failed").Inc()
+		return "", err
+	}
+
+	if err := s.checkStoredRefreshToken(ctx, refreshToken); err != nil {
+		authOperations.WithLabelValues("refresh_token", "revoked").Inc()
+		return "", err
+	}
+
+	// Make sure the user still exists before issuing a new access token
+	user, err := s.userRepo.GetByIDWithContext(repository.WithPrimary(ctx), claims.UserID)
+	if err != nil {
+		logging.FromContext(ctx, s.logger).Warn("refresh failed: user not found",
+			zap.Uint("user_id", claims.UserID),
+			zap.Error(err),
+		)
+		authOperations.WithLabelValues("refresh_token", "failed").Inc()
+		return "", ErrInvalidToken
+	}
+
+	if !user.Active {
+		authOperations.WithLabelValues("refresh_token", "suspended").Inc()
+		return "", ErrAccountSuspended
+	}
+
+	opts := append(s.userTokenOptions(ctx, user), WithSessionID(claims.SessionID))
+	token, err := s.GenerateToken(ctx, user, opts...)
+	if err != nil {
+		authOperations.WithLabelValues("refresh_token", "failed").Inc()
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	authOperations.WithLabelValues("refresh_token", "success").Inc()
+	return token, nil
+}
+
+// RenewAccessToken exchanges a valid access token for a new one with a fresh
+// expiry, without credentials, and revokes the old token. Only tokens whose
+// login (auth_time, or iat for older tokens) is within the renewal window
+// qualify; older ones get ErrRenewalExpired and the user has to log in again.
+func (s *AuthService) RenewAccessToken(ctx context.Context, accessToken string) (string, time.Time, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.RenewAccessToken")
+	token, expiresAt, err := s.renewAccessToken(ctx, accessToken)
+	endSpan(span, err)
+	return token, expiresAt, err
+}
+
+func (s *AuthService) renewAccessToken(ctx context.Context, accessToken string) (string, time.Time, error) {
+	start := time.Now()
+	defer func() {
+		authDuration.WithLabelValues("renew_token").Observe(time.Since(start).Seconds())
+	}()
+
+	claims, err := s.validateToken(ctx, accessToken, models.TokenTypeAccess, "validate_token")
+	if err != nil {
+		authOperations.WithLabelValues("renew_token", "failed").Inc()
+		return "", time.Time{}, err
+	}
+
+	authTime := claims.AuthTime
+	if authTime == nil {
+		authTime = claims.IssuedAt
+	}
+	if authTime == nil || time.Since(authTime.Time) > s.renewalWindow {
+		authOperations.WithLabelValues("renew_token", "too_old").Inc()
+		return "", time.Time{}, ErrRenewalExpired
+	}
+
+	user, err := s.userRepo.GetByIDWithContext(repository.WithPrimary(ctx), claims.UserID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			authOperations.WithLabelValues("renew_token", "failed").Inc()
+			return "", time.Time{}, ErrInvalidToken
+		}
+		authOperations.WithLabelValues("renew_token", "failed").Inc()
+		return "", time.Time{}, err
+	}
+
+	if !user.Active {
+		authOperations.WithLabelValues("renew_token", "suspended").Inc()
+		return "", time.Time{}, ErrAccountSuspended
+	}
+
+	opts := append(s.userTokenOptions(ctx, user), withAuthTime(authTime.Time), WithSessionID(claims.SessionID))
+	token, expiresAt, err := s.generateToken(ctx, user, models.TokenTypeAccess, s.tokenExpiry, "generate_token", opts...)
+	if err != nil {
+		authOperations.WithLabelValues("renew_token", "failed").Inc()
+		return "", time.Time{}, fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	// The old token is superseded; leaving it valid would double the
+	// number of live tokens with every renewal
+	s.revoke(ctx, claims)
+
+	logging.FromContext(ctx, s.logger).Info("access token renewed",
+		zap.Uint("user_id", user.ID),
+	)
+
+	authOperations.WithLabelValues("renew_token", "success").Inc()
+	return token, expiresAt, nil
+}
+
+// checkStoredRefreshToken rejects refresh tokens whose hash is unknown,
+// revoked or past its stored expiry.
+func (s *AuthService) checkStoredRefreshToken(ctx context.Context, refreshToken string) error {
+	if s.refreshTokens == nil {
+		return nil
+	}
+
+	stored, err := s.refreshTokens.GetByHashWithContext(ctx, hashToken(refreshToken))
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			logging.FromContext(ctx, s.logger).Warn("refresh failed: unknown refresh token")
+			return ErrTokenRevoked
+		}
+		return fmt.Errorf("failed to look up refresh token: %w", err)
+	}
+	if stored.Revoked {
+		logging.FromContext(ctx, s.logger).Warn("refresh failed: refresh token revoked",
+			zap.Uint("user_id", stored.UserID),
+		)
+		return ErrTokenRevoked
+	}
+	if !time.Now().Before(stored.ExpiresAt) {
+		return ErrTokenExpired
+	}
+	return nil
+}
+
+func (s *AuthService) validateToken(ctx context.Context, tokenStr string, expectedType models.TokenType, operation string) (*models.Claims, error) {
 	start := time.Now()
 	defer func() {
-		authDuration.WithLabelValues("validate_token").Observe(time.Since(start).Seconds())
+		authDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
 	}()
 
 	if tokenStr == "" {
-		authOperations.WithLabelValues("validate_token", "failed").Inc()
-		return nil, errors.New("empty token")
+		authOperations.WithLabelValues(operation, "failed").Inc()
+		return nil, fmt.Errorf("%w: empty token", ErrInvalidToken)
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{s.signingMethod.Alg()}),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(s.leeway),
+	}
+	if s.audience != "" {
+		options = append(options, jwt.WithAudience(s.audience))
 	}
 
 	claims := &models.Claims{}
 	token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		// Only accept the configured algorithm; this also rules out "none"
+		if token.Method.Alg() != s.signingMethod.Alg() {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return s.publicKey, nil
-	})
+		return s.verificationKey(token)
+	}, options...)
 
 	if err != nil {
-		s.logger.Warn("token validation failed",
+		logging.FromContext(ctx, s.logger).Warn("token validation failed",
 			zap.Error(err),
 		)
-		authOperations.WithLabelValues("validate_token", "failed").Inc()
-		return nil, fmt.Errorf("invalid token: %w", err)
+		authOperations.WithLabelValues(operation, "failed").Inc()
+		// The categories below still match ErrInvalidToken for callers that
+		// don't care why; expiry is kept separate so clients know to refresh
+		switch {
+		case errors.Is(err, jwt.ErrTokenExpired):
+			return nil, fmt.Errorf("%w: %v", ErrTokenExpired, err)
+		case errors.Is(err, jwt.ErrTokenNotValidYet):
+			return nil, fmt.Errorf("%w: %w", ErrTokenNotYetValid, ErrInvalidToken)
+		case errors.Is(err, jwt.ErrTokenMalformed):
+			return nil, fmt.Errorf("%w: %w", ErrTokenMalformed, ErrInvalidToken)
+		case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+			return nil, fmt.Errorf("%w: %w", ErrInvalidIssuer, ErrInvalidToken)
+		case errors.Is(err, jwt.ErrTokenInvalidAudience):
+			return nil, fmt.Errorf("%w: %w", ErrInvalidAudience, ErrInvalidToken)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
 	}
 
 	if !token.Valid {
-		authOperations.WithLabelValues("validate_token", "failed").Inc()
-		return nil, errors.New("invalid token")
+		authOperations.WithLabelValues(operation, "failed").Inc()
+		return nil, ErrInvalidToken
+	}
+
+	// Tokens issued before token types existed carry no type and are treated as access tokens
+	tokenType := claims.TokenType
+	if tokenType == "" {
+		tokenType = models.TokenTypeAccess
+	}
+	if tokenType != expectedType {
+		logging.FromContext(ctx, s.logger).Warn("token validation failed: unexpected token type",
+			zap.String("expected", string(expectedType)),
+			zap.String("actual", string(tokenType)),
+		)
+		authOperations.WithLabelValues(operation, "failed").Inc()
+		return nil, ErrInvalidTokenType
+	}
+
+	if claims.ID != "" && s.revoker.IsRevoked(claims.ID) {
+		authOperations.WithLabelValues(operation, "revoked").Inc()
+		return nil, ErrTokenRevoked
 	}
 
-	authOperations.WithLabelValues("validate_token", "success").Inc()
+	if err := s.checkSession(ctx, claims); err != nil {
+		if errors.Is(err, ErrTokenRevoked) {
+			authOperations.WithLabelValues(operation, "revoked").Inc()
+		} else {
+			authOperations.WithLabelValues(operation, "failed").Inc()
+		}
+		return nil, err
+	}
+
+	authOperations.WithLabelValues(operation, "success").Inc()
 	return claims, nil
 }
 
-func (s *AuthService) Login(ctx context.Context, username, password string) (*models.User, string, error) {
+// EnsureActive checks that the user a token was issued to still exists and
+// is not suspended. Tokens outlive suspension, so protected routes must
+// check this on every request. It reads the primary so a suspension takes
+// effect immediately.
+func (s *AuthService) EnsureActive(ctx context.Context, userID uint) error {
+	user, err := s.userRepo.GetByIDWithContext(repository.WithPrimary(ctx), userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			authOperations.WithLabelValues("ensure_active", "not_found").Inc()
+			return ErrInvalidToken
+		}
+		authOperations.WithLabelValues("ensure_active", "failed").Inc()
+		return err
+	}
+	if !user.Active {
+		authOperations.WithLabelValues("ensure_active", "suspended").Inc()
+		return ErrAccountSuspended
+	}
+	authOperations.WithLabelValues("ensure_active", "success").Inc()
+	return nil
+}
+
+// Logout revokes the given access token and, when provided, the refresh
+// token issued alongside it.
+func (s *AuthService) Logout(ctx context.Context, accessToken, refreshToken string) error {
 	start := time.Now()
 	defer func() {
-		authDuration.WithLabelValues("login").Observe(time.Since(start).Seconds())
+		authDuration.WithLabelValues("logout").Observe(time.Since(start).Seconds())
 	}()
 
-	if username == "" || password == "" {
-		authOperations.WithLabelValues("login", "failed").Inc()
-		return nil, "", errors.New("username and password are required")
+	claims, err := s.ValidateToken(ctx, accessToken)
+	if err != nil {
+		authOperations.WithLabelValues("logout", "failed").Inc()
+		return err
 	}
+	s.revoke(ctx, claims)
 
-	user, err := s.userRepo.GetByUsername(username)
+	if refreshToken != "" {
+		refreshClaims, err := s.validateToken(ctx, refreshToken, models.TokenTypeRefresh, "validate_refresh_token")
+		if err != nil {
+			authOperations.WithLabelValues("logout", "failed").Inc()
+			return err
+		}
+		if refreshClaims.UserID != claims.UserID {
+			authOperations.WithLabelValues("logout", "failed").Inc()
+			return ErrInvalidToken
+		}
+		s.revoke(ctx, refreshClaims)
+		if s.refreshTokens != nil {
+			if err := s.refreshTokens.RevokeWithContext(ctx, hashToken(refreshToken)); err != nil {
+				authOperations.WithLabelValues("logout", "failed").Inc()
+				return err
+			}
+		}
+	}
+
+	if err := s.endSession(ctx, claims); err != nil {
+		authOperations.WithLabelValues("logout", "failed").Inc()
+		return err
+	}
+
+	s.audit.Record(ctx, claims.UserID, models.AuthEventLogout)
+
+	logging.FromContext(ctx, s.logger).Info("user logged out",
+		zap.Uint("user_id", claims.UserID),
+	)
+
+	authOperations.WithLabelValues("logout", "success").Inc()
+	return nil
+}
+
+// LogoutAll revokes every refresh token of the user owning accessToken, along
+// with accessToken itself. Access tokens held by other sessions remain valid
+// until they expire, unless sessions are tracked, in which case every
+// session is revoked and takes its tokens with it.
+func (s *AuthService) LogoutAll(ctx context.Context, accessToken string) (int64, error) {
+	start := time.Now()
+	defer func() {
+		authDuration.WithLabelValues("logout_all").Observe(time.Since(start).Seconds())
+	}()
+
+	claims, err := s.ValidateToken(ctx, accessToken)
 	if err != nil {
-		s.logger.Warn("login failed: user not found",
-			zap.String("username", username),
+		authOperations.WithLabelValues("logout_all", "failed").Inc()
+		return 0, err
+	}
+
+	var revoked int64
+	if s.refreshTokens != nil {
+		revoked, err = s.refreshTokens.RevokeAllForUserWithContext(ctx, claims.UserID)
+		if err != nil {
+			authOperations.WithLabelValues("logout_all", "failed").Inc()
+			return 0, err
+		}
+	}
+	if s.sessions != nil {
+		if _, err := s.sessions.RevokeAllForUserWithContext(ctx, claims.UserID); err != nil {
+			authOperations.WithLabelValues("logout_all", "failed").Inc()
+			return 0, err
+		}
+	}
+	s.revoke(ctx, claims)
+
+	s.audit.Record(ctx, claims.UserID, models.AuthEventLogout)
+
+	logging.FromContext(ctx, s.logger).Info("user logged out of all sessions",
+		zap.Uint("user_id", claims.UserID),
+		zap.Int64("refresh_tokens_revoked", revoked),
+	)
+
+	authOperations.WithLabelValues("logout_all", "success").Inc()
+	return revoked, nil
+}
+
+func (s *AuthService) revoke(ctx context.Context, claims *models.Claims) {
+	if claims.ID == "" {
+		// Tokens issued before jti was added cannot be tracked individually
+		logging.FromContext(ctx, s.logger).Warn("cannot revoke token without jti",
+			zap.Uint("user_id", claims.UserID),
 		)
-		authOperations.WithLabelValues("login", "failed").Inc()
-		return nil, "", errors.New("invalid credentials")
+		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		s.logger.Warn("login failed: invalid password",
-			zap.String("username", username),
+	var exp time.Time
+	if claims.ExpiresAt != nil {
+		exp = claims.ExpiresAt.Time
+	}
+	s.revoker.Revoke(claims.ID, exp)
+}
+
+// SetSigningKey makes key the RSA key used to sign new tokens. Its public
+// half is also registered for verification under the same kid.
+func (s *AuthService) SetSigningKey(kid string, key *rsa.PrivateKey) error {
+	if s.signingMethod != jwt.SigningMethodRS256 {
+		return errors.New("signing keys can only be rotated for RS256")
+	}
+	if kid == "" || key == nil {
+		return errors.New("kid and key are required")
+	}
+
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+
+	s.signingKID = kid
+	s.privateKey = key
+	s.publicKeys[kid] = &key.PublicKey
+
+	s.logger.Info("signing key rotated",
+		zap.String("kid", kid),
+	)
+	return nil
+}
+
+// AddVerificationKey registers a public key so tokens signed with the
+// matching kid, such as those from a previous signing key, still validate.
+func (s *AuthService) AddVerificationKey(kid string, key *rsa.PublicKey) error {
+	if s.signingMethod != jwt.SigningMethodRS256 {
+		return errors.New("verification keys can only be added for RS256")
+	}
+	if kid == "" || key == nil {
+		return errors.New("kid and key are required")
+	}
+
+	s.keysMu.Lock()
+	defer s.keysMu.Unlock()
+
+	s.publicKeys[kid] = key
+	return nil
+}
+
+func (s *AuthService) signingKey() (string, interface{}) {
+	if s.signingMethod == jwt.SigningMethodHS256 {
+		return "", s.hmacSecret
+	}
+
+	s.keysMu.RLock()
+	defer s.keysMu.RUnlock()
+	return s.signingKID, s.privateKey
+}
+
+func (s *AuthService) verificationKey(token *jwt.Token) (interface{}, error) {
+	if s.signingMethod == jwt.SigningMethodHS256 {
+		return s.hmacSecret, nil
+	}
+
+	// Tokens issued before kid was set were signed with the configured key
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = s.legacyKID
+	}
+
+	s.keysMu.RLock()
+	defer s.keysMu.RUnlock()
+
+	key, ok := s.publicKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownKeyID, kid)
+	}
+	return key, nil
+}
+
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// LoginResult is a successful login. ExpiresAt is the access token's "exp"
+// claim, so clients can schedule a refresh without decoding the token.
+// PasswordExpiresAt is only set when a password max age is configured, and
+// PasswordExpired tells the client to send the user to change it. SessionID
+// is 0 unless sessions are tracked; refresh tokens for the login should be
+// issued with WithSessionID(SessionID).
+type LoginResult struct {
+	User              *models.User
+	Token             string
+	ExpiresAt         time.Time
+	PasswordExpired   bool
+	PasswordExpiresAt *time.Time
+	SessionID         uint
+}
+
+// Login checks the credentials and issues an access token. With rememberMe
+// the token lives for ExtendedTokenExpiry instead of TokenExpiry.
+func (s *AuthService) Login(ctx context.Context, identifier, password string, rememberMe bool) (*LoginResult, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Login")
+	result, err := s.login(ctx, identifier, password, rememberMe)
+	if err == nil {
+		span.SetAttributes(attribute.Int64("user.id", int64(result.User.ID)))
+	}
+	endSpan(span, err)
+	return result, err
+}
+
+func (s *AuthService) login(ctx context.Context, identifier, password string, rememberMe bool) (*LoginResult, error) {
+	start := time.Now()
+	defer func() {
+		authDuration.WithLabelValues("login").Observe(time.Since(start).Seconds())
+	}()
+
+	user, err := s.authenticate(ctx, "login", identifier, password)
+	if err != nil {
+		return nil, err
+	}
+	identifier = models.NormalizeIdentifier(identifier)
+
+	var passwordExpiresAt *time.Time
+	passwordExpired := false
+	if s.passwordMaxAge > 0 {
+		expiresAt := user.PasswordExpiresAt(s.passwordMaxAge)
+		passwordExpiresAt = &expiresAt
+		passwordExpired = !time.Now().Before(expiresAt)
+	}
+
+	if passwordExpired && s.passwordExpiryBlock {
+		logging.FromContext(ctx, s.logger).Warn("login failed: password expired",
+			zap.String("identifier", identifier),
+			zap.Uint("user_id", user.ID),
 		)
+		authOperations.WithLabelValues("login", "password_expired").Inc()
+		return nil, ErrPasswordExpired
+	}
+
+	sessionID, err := s.startSession(ctx, user)
+	if err != nil {
 		authOperations.WithLabelValues("login", "failed").Inc()
-		return nil, "", errors.New("invalid credentials")
+		return nil, fmt.Errorf("failed to start session: %w", err)
 	}
 
-	token, err := s.GenerateToken(ctx, user)
+	opts := append(s.userTokenOptions(ctx, user), WithSessionID(sessionID))
+	token, expiresAt, err := s.generateToken(ctx, user, models.TokenTypeAccess, s.AccessTokenExpiry(rememberMe), "generate_token", opts...)
 	if err != nil {
 		authOperations.WithLabelValues("login", "failed").Inc()
-		return nil, "", fmt.Errorf("failed to generate token: %w", err)
+		return nil, fmt.Errorf("failed to generate token: %w", err)
 	}
 
-	s.logger.Info("successful login",
-		zap.String("username", username),
+	s.audit.Record(ctx, user.ID, models.AuthEventLoginSuccess)
+
+	logging.FromContext(ctx, s.logger).Info("successful login",
+		zap.String("username", user.UsernameForLogin),
 		zap.Uint("user_id", user.ID),
+		zap.Bool("password_expired", passwordExpired),
 	)
 
 	authOperations.WithLabelValues("login", "success").Inc()
-	return user, token, nil
+	return &LoginResult{
+		User:              user,
+		Token:             token,
+		ExpiresAt:         expiresAt,
+		PasswordExpired:   passwordExpired,
+		PasswordExpiresAt: passwordExpiresAt,
+		SessionID:         sessionID,
+	}, nil
+}
+
+// authenticate checks identifier and password the way every login does:
+// lockout, constant-time handling of unknown users, failure counting, and
+// the suspended and unverified account checks. op labels the metrics.
+func (s *AuthService) authenticate(ctx context.Context, op, identifier, password string) (*models.User, error) {
+	if identifier == "" || password == "" {
+		authOperations.WithLabelValues(op, "failed").Inc()
+		return nil, errors.New("identifier and password are required")
+	}
+
+	if err := s.CheckLoginIdentifier(identifier); err != nil {
+		authOperations.WithLabelValues(op, "failed").Inc()
+		return nil, err
+	}
+
+	// Normalize so lockout counts "Bob" and "bob" as the same account
+	identifier = models.NormalizeIdentifier(identifier)
+
+	if locked, remaining := s.loginAttempts.IsLocked(identifier); locked {
+		logging.FromContext(ctx, s.logger).Warn("login failed: account locked",
+			zap.String("identifier", identifier),
+			zap.Duration("remaining", remaining),
+		)
+		authOperations.WithLabelValues(op, "locked").Inc()
+		return nil, ErrAccountLocked
+	}
+
+	user, err := s.findLoginUser(ctx, identifier)
+	if err != nil {
+		// Burn the same bcrypt work as a real password check so response
+		// time doesn't reveal whether the account exists.
+		_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+		logging.FromContext(ctx, s.logger).Warn("login failed: user not found",
+			zap.String("identifier", identifier),
+		)
+		s.recordLoginFailure(ctx, identifier)
+		authOperations.WithLabelValues(op, "failed").Inc()
+		return nil, ErrInvalidCredentials
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		logging.FromContext(ctx, s.logger).Warn("login failed: invalid password",
+			zap.String("identifier", identifier),
+		)
+		s.recordLoginFailure(ctx, identifier)
+		s.audit.Record(ctx, user.ID, models.AuthEventLoginFailure)
+		authOperations.WithLabelValues(op, "failed").Inc()
+		return nil, ErrInvalidCredentials
+	}
+
+	s.loginAttempts.Reset(identifier)
+
+	if !user.Active {
+		logging.FromContext(ctx, s.logger).Warn("login failed: account suspended",
+			zap.String("identifier", identifier),
+			zap.Uint("user_id", user.ID),
+		)
+		authOperations.WithLabelValues(op, "suspended").Inc()
+		return nil, ErrAccountSuspended
+	}
+
+	if s.requireVerified && !user.EmailVerified {
+		logging.FromContext(ctx, s.logger).Warn("login failed: email not verified",
+			zap.String("identifier", identifier),
+		)
+		authOperations.WithLabelValues(op, "unverified").Inc()
+		return nil, ErrEmailNotVerified
+	}
+
+	return user, nil
 }
 
-// Helper functions for loading keys
-func loadPrivateKey(path string) (*rsa.PrivateKey, error) {
-	keyBytes, err := os.ReadFile(path)
+// dummyPasswordHash is a bcrypt hash at the cost used for real passwords,
+// generated once on first use.
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("dummy-password-for-timing"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(fmt.Sprintf("failed to generate dummy password hash: %v", err))
+	}
+	return hash
+})
+
+// LoginIdentifier reports what users may log in with
+func (s *AuthService) LoginIdentifier() LoginIdentifier {
+	return s.loginIdentifier
+}
+
+// CheckLoginIdentifier returns ErrIdentifierNotAllowed when identifier is of
+// a kind the login policy doesn't accept. Usernames are alphanumeric, so an
+// "@" is what tells an email address apart.
+func (s *AuthService) CheckLoginIdentifier(identifier string) error {
+	isEmail := strings.Contains(identifier, "@")
+	switch s.loginIdentifier {
+	case LoginIdentifierUsername:
+		if isEmail {
+			return ErrIdentifierNotAllowed
+		}
+	case LoginIdentifierEmail:
+		if !isEmail {
+			return ErrIdentifierNotAllowed
+		}
+	}
+	return nil
+}
+
+// findLoginUser resolves a login identifier according to the login policy.
+// With LoginIdentifierEither it is tried as a username first and then as an
+// email address.
+func (s *AuthService) findLoginUser(ctx context.Context, identifier string) (*models.User, error) {
+	// A replica may lag behind a password change or suspension
+	ctx = repository.WithPrimary(ctx)
+	switch s.loginIdentifier {
+	case LoginIdentifierUsername:
+		return s.userRepo.GetByUsernameWithContext(ctx, identifier)
+	case LoginIdentifierEmail:
+		return s.userRepo.GetByEmailWithContext(ctx, identifier)
+	}
+
+	// One query either way, so an unknown identifier takes no longer than a
+	// known username
+	return s.userRepo.GetByUsernameOrEmailWithContext(ctx, identifier)
+}
+
+// recordLoginFailure counts a failed attempt, including for unknown
+// usernames so lockout behavior doesn't reveal which accounts exist.
+func (s *AuthService) recordLoginFailure(ctx context.Context, username string) {
+	if s.loginAttempts.RecordFailure(username) {
+		logging.FromContext(ctx, s.logger).Warn("account locked after repeated failed logins",
+			zap.String("username", username),
+		)
+	}
+}
+
+// Helper functions for loading keys. Inline PEM is preferred and the file
+// path is used as a fallback.
+func loadPrivateKey(pemStr, path string) (*rsa.PrivateKey, error) {
+	keyBytes, err := readKey(pemStr, path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read private key: %w", err)
 	}
@@ -207,8 +1112,8 @@ func loadPrivateKey(path string) (*rsa.PrivateKey, error) {
 	return key, nil
 }
 
-func loadPublicKey(path string) (*rsa.PublicKey, error) {
-	keyBytes, err := os.ReadFile(path)
+func loadPublicKey(pemStr, path string) (*rsa.PublicKey, error) {
+	keyBytes, err := readKey(pemStr, path)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read public key: %w", err)
 	}
@@ -220,3 +1125,13 @@ func loadPublicKey(path string) (*rsa.PublicKey, error) {
 
 	return key, nil
 }
+
+func readKey(pemStr, path string) ([]byte, error) {
+	if pemStr != "" {
+		return []byte(pemStr), nil
+	}
+	if path == "" {
+		return nil, errors.New("neither PEM nor key path provided")
+	}
+	return os.ReadFile(path)
+}
@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JorgeSaicoski/login-go/internal/models"
+)
+
+// loginTimingConfig keeps lockout out of the way of repeated failures
+var loginTimingConfig = AuthConfig{MaxLoginAttempts: 1 << 20}
+
+func timeFailedLogin(t testing.TB, s *AuthService, identifier string) time.Duration {
+	t.Helper()
+	start := time.Now()
+	_, err := s.Login(context.Background(), identifier, "Wrong123", false)
+	elapsed := time.Since(start)
+	if !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("login %q: err = %v, want ErrInvalidCredentials", identifier, err)
+	}
+	return elapsed
+}
+
+// TestLoginTimingDoesNotRevealUnknownUsers checks that a login for an
+// unknown user costs about as much as one with a wrong password, so timing
+// can't be used to enumerate accounts. Without the dummy bcrypt comparison
+// the unknown user path is orders of magnitude faster. The "either" policy
+// is covered too, since a miss there must not cost an extra lookup.
+func TestLoginTimingDoesNotRevealUnknownUsers(t *testing.T) {
+	if testing.Short() {
+		t.Skip("timing test runs bcrypt repeatedly")
+	}
+	for _, policy := range []LoginIdentifier{LoginIdentifierUsername, LoginIdentifierEither} {
+		t.Run(string(policy), func(t *testing.T) {
+			config := loginTimingConfig
+			config.LoginIdentifier = policy
+			s, db := newTestAuthService(t, config)
+			createTestUser(t, db, "alice")
+
+			const rounds = 5
+			var unknown, wrongPassword time.Duration
+			for i := 0; i < rounds; i++ {
+				unknown += timeFailedLogin(t, s, "nobody")
+				wrongPassword += timeFailedLogin(t, s, "alice")
+			}
+
+			ratio := float64(unknown) / float64(wrongPassword)
+			t.Logf("unknown user %v, wrong password %v per login (ratio %.2f)",
+				unknown/rounds, wrongPassword/rounds, ratio)
+			if ratio < 0.5 || ratio > 2 {
+				t.Fatalf("unknown user took %v, wrong password %v; want comparable times", unknown/rounds, wrongPassword/rounds)
+			}
+		})
+	}
+}
+
+func BenchmarkLoginUnknownUser(b *testing.B) {
+	s, _ := newTestAuthService(b, loginTimingConfig)
+	for i := 0; i < b.N; i++ {
+		timeFailedLogin(b, s, "nobody")
+	}
+}
+
+func BenchmarkLoginWrongPassword(b *testing.B) {
+	s, db := newTestAuthService(b, loginTimingConfig)
+	createTestUser(b, db, "alice")
+	for i := 0; i < b.N; i++ {
+		timeFailedLogin(b, s, "alice")
+	}
+}
+
+func TestLoginIdentifierPolicy(t *testing.T) {
+	tests := []struct {
+		policy     LoginIdentifier
+		identifier string
+		wantErr    error
+	}{
+		{"", "alice", nil},
+		{"", "alice@example.com", ErrIdentifierNotAllowed},
+		{LoginIdentifierUsername, "alice", nil},
+		{LoginIdentifierUsername, "alice@example.com", ErrIdentifierNotAllowed},
+		{LoginIdentifierEmail, "alice@example.com", nil},
+		{LoginIdentifierEmail, "alice", ErrIdentifierNotAllowed},
+		{LoginIdentifierEither, "alice", nil},
+		{LoginIdentifierEither, "alice@example.com", nil},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.policy)+"/"+tt.identifier, func(t *testing.T) {
+			s, db := newTestAuthService(t, AuthConfig{LoginIdentifier: tt.policy})
+			createTestUser(t, db, "alice")
+
+			_, err := s.Login(context.Background(), tt.identifier, testPassword, false)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUnknownLoginIdentifierPolicy(t *testing.T) {
+	_, err := NewAuthService(nil, nil, nil, nil, nil, nil, AuthConfig{
+		Algorithm:       AlgorithmHS256,
+		HMACSecret:      "test-secret",
+		LoginIdentifier: "phone",
+	})
+	if err == nil {
+		t.Fatal("NewAuthService accepted an unknown login identifier")
+	}
+}
+
+func TestRS256WithoutKeysFailsClearly(t *testing.T) {
+	_, err := NewAuthService(nil, nil, nil, nil, nil, nil, AuthConfig{Algorithm: AlgorithmRS256})
+	if err == nil || !strings.Contains(err.Error(), "neither PEM nor key path provided") {
+		t.Fatalf("err = %v, want the missing key error", err)
+	}
+}
+
+func TestTokenCarriesUserRoles(t *testing.T) {
+	s, db := newTestAuthService(t, AuthConfig{})
+	ctx := context.Background()
+
+	tests := []struct {
+		role string
+		want string
+	}{
+		{"", models.RoleUser},
+		{models.RoleAdmin, models.RoleAdmin},
+	}
+	for _, tt := range tests {
+		user := createTestUser(t, db, "user"+tt.role)
+		if tt.role != "" {
+			if err := db.Model(user).Update("role", tt.role).Error; err != nil {
+				t.Fatalf("set role: %v", err)
+			}
+			user.Role = tt.role
+		}
+
+		token, err := s.GenerateToken(ctx, user)
+		if err != nil {
+			t.Fatalf("GenerateToken: %v", err)
+		}
+		claims, err := s.ValidateToken(ctx, token)
+		if err != nil {
+			t.Fatalf("ValidateToken: %v", err)
+		}
+		if len(claims.Roles) != 1 || claims.Roles[0] != tt.want {
+			t.Errorf("role %q: claims.Roles = %v, want [%s]", tt.role, claims.Roles, tt.want)
+		}
+	}
+}
+
+func TestLoginWithUsernameOrEmail(t *testing.T) {
+	s, db := newTestAuthService(t, AuthConfig{LoginIdentifier: LoginIdentifierEither})
+	alice := createTestUser(t, db, "alice")
+	createTestUser(t, db, "bob")
+	ctx := context.Background()
+
+	for _, identifier := range []string{"alice", "alice@example.com", "Alice@Example.com"} {
+		result, err := s.Login(ctx, identifier, testPassword, false)
+		if err != nil {
+			t.Fatalf("login as %q: %v", identifier, err)
+		}
+		if result.User.ID != alice.ID {
+			t.Fatalf("login as %q returned user %d, want %d", identifier, result.User.ID, alice.ID)
+		}
+		if result.Token == "" {
+			t.Fatalf("login as %q returned no token", identifier)
+		}
+	}
+
+	for _, identifier := range []string{"carol@example.com", "carol"} {
+		if _, err := s.Login(ctx, identifier, testPassword, false); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("login as unknown %q: err = %v, want ErrInvalidCredentials", identifier, err)
+		}
+	}
+	if _, err := s.Login(ctx, "alice@example.com", "Wrong123", false); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("wrong password by email: err = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestSuspendedUserCannotLogIn(t *testing.T) {
+	s, db := newTestAuthService(t, AuthConfig{})
+	alice := createTestUser(t, db, "alice")
+	ctx := context.Background()
+
+	if err := db.Model(alice).Update("active", false).Error; err != nil {
+		t.Fatalf("suspend user: %v", err)
+	}
+	if _, err := s.Login(ctx, "alice", testPassword, false); !errors.Is(err, ErrAccountSuspended) {
+		t.Fatalf("login: err = %v, want ErrAccountSuspended", err)
+	}
+	// A wrong password must not reveal that the account is suspended
+	if _, err := s.Login(ctx, "alice", "Wrong123", false); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("login with wrong password: err = %v, want ErrInvalidCredentials", err)
+	}
+	if err := s.EnsureActive(ctx, alice.ID); !errors.Is(err, ErrAccountSuspended) {
+		t.Fatalf("EnsureActive: err = %v, want ErrAccountSuspended", err)
+	}
+
+	if err := db.Model(alice).Update("active", true).Error; err != nil {
+		t.Fatalf("reactivate user: %v", err)
+	}
+	if _, err := s.Login(ctx, "alice", testPassword, false); err != nil {
+		t.Fatalf("login after reactivation: %v", err)
+	}
+}
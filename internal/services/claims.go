@@ -0,0 +1,48 @@
+package services
+
+import (
+	"context"
+
+	"github.com/JorgeSaicoski/login-go/internal/models"
+	"github.com/JorgeSaicoski/login-go/internal/repository"
+)
+
+// Keys of the extra claims set by SubscriptionClaims
+const (
+	ClaimTenant           = "tenant"
+	ClaimSubscriptionType = "subscription_type"
+	ClaimPlan             = "plan"
+)
+
+// SubscriptionClaims embeds the user's active subscription in the token so
+// downstream services don't need to look it up. Enterprise subscriptions
+// win over individual ones and provide the tenant. Users without an active
+// subscription get no extra claims.
+func SubscriptionClaims(subs *repository.UserSubscriptionRepository) ExtraClaimsFunc {
+	return func(ctx context.Context, user *models.User) (map[string]interface{}, error) {
+		active, err := subs.GetActiveByUserIDWithContext(ctx, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(active) == 0 {
+			return nil, nil
+		}
+
+		current := active[0]
+		for _, us := range active {
+			if us.Type == models.Enterprise {
+				current = us
+				break
+			}
+		}
+
+		extra := map[string]interface{}{
+			ClaimSubscriptionType: string(current.Type),
+			ClaimPlan:             current.Subscription.Name,
+		}
+		if current.Type == models.Enterprise && current.CompanyName != "" {
+			extra[ClaimTenant] = current.CompanyName
+		}
+		return extra, nil
+	}
+}
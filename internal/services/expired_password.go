@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/JorgeSaicoski/login-go/internal/logging"
+	"github.com/JorgeSaicoski/login-go/internal/models"
+)
+
+var ErrPasswordNotExpired = errors.New("password has not expired")
+
+// SetPasswordHistory makes ChangeExpiredPassword reject recently used
+// passwords. Without it only the current password is refused.
+func (s *AuthService) SetPasswordHistory(history *PasswordHistoryService) {
+	s.passwordHistory = history
+}
+
+// ChangeExpiredPassword replaces an expired password using the account's
+// credentials instead of a token. Strict expiry refuses to issue tokens to
+// these users, so without it they could never change their password. It
+// goes through the same checks as Login and returns ErrPasswordNotExpired
+// for passwords that still work, which should be changed while logged in.
+func (s *AuthService) ChangeExpiredPassword(ctx context.Context, identifier, password, newPassword string) error {
+	start := time.Now()
+	defer func() {
+		authDuration.WithLabelValues("change_expired_password").Observe(time.Since(start).Seconds())
+	}()
+
+	user, err := s.authenticate(ctx, "change_expired_password", identifier, password)
+	if err != nil {
+		return err
+	}
+
+	if s.passwordMaxAge <= 0 || time.Now().Before(user.PasswordExpiresAt(s.passwordMaxAge)) {
+		authOperations.WithLabelValues("change_expired_password", "not_expired").Inc()
+		return ErrPasswordNotExpired
+	}
+
+	if s.passwordHistory != nil {
+		err = s.passwordHistory.CheckReuse(ctx, user, newPassword)
+	} else if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(newPassword)) == nil {
+		err = ErrPasswordReused
+	}
+	if err != nil {
+		authOperations.WithLabelValues("change_expired_password", "failed").Inc()
+		return err
+	}
+
+	oldHash := user.Password
+	user.Password = newPassword
+	if err := user.HashPassword(); err != nil {
+		authOperations.WithLabelValues("change_expired_password", "failed").Inc()
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+	if err := s.userRepo.UpdateWithContext(ctx, user); err != nil {
+		authOperations.WithLabelValues("change_expired_password", "failed").Inc()
+		return fmt.Errorf("failed to save new password: %w", err)
+	}
+
+	// The new password is already saved, so a failure here only weakens
+	// the reuse check for this one hash
+	if s.passwordHistory != nil {
+		if err := s.passwordHistory.Remember(ctx, user.ID, oldHash); err != nil {
+			logging.FromContext(ctx, s.logger).Error("failed to record password history",
+				zap.Error(err),
+				zap.Uint("user_id", user.ID),
+			)
+		}
+	}
+
+	s.audit.Record(ctx, user.ID, models.AuthEventPasswordChange)
+
+	logging.FromContext(ctx, s.logger).Info("expired password changed",
+		zap.Uint("user_id", user.ID),
+	)
+
+	authOperations.WithLabelValues("change_expired_password", "success").Inc()
+	return nil
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/JorgeSaicoski/login-go/internal/models"
+)
+
+func expirePassword(t *testing.T, db *gorm.DB, user *models.User) {
+	t.Helper()
+	changedAt := time.Now().AddDate(0, 0, -100)
+	if err := db.Model(user).UpdateColumn("password_changed_at", changedAt).Error; err != nil {
+		t.Fatalf("expire password: %v", err)
+	}
+}
+
+func TestStrictExpiryCanChangePasswordWithCredentials(t *testing.T) {
+	s, db := newTestAuthService(t, AuthConfig{PasswordMaxAge: 90 * 24 * time.Hour, PasswordExpiryStrict: true})
+	user := createTestUser(t, db, "alice")
+	expirePassword(t, db, user)
+	ctx := context.Background()
+
+	if _, err := s.Login(ctx, "alice", testPassword, false); !errors.Is(err, ErrPasswordExpired) {
+		t.Fatalf("login with expired password: err = %v, want ErrPasswordExpired", err)
+	}
+
+	if err := s.ChangeExpiredPassword(ctx, "alice", testPassword, "Rotated456"); err != nil {
+		t.Fatalf("ChangeExpiredPassword: %v", err)
+	}
+
+	result, err := s.Login(ctx, "alice", "Rotated456", false)
+	if err != nil {
+		t.Fatalf("login with new password: %v", err)
+	}
+	if result.PasswordExpired {
+		t.Fatal("new password reported as expired")
+	}
+	if _, err := s.Login(ctx, "alice", testPassword, false); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("login with old password: err = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestChangeExpiredPasswordRejections(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("wrong password", func(t *testing.T) {
+		s, db := newTestAuthService(t, AuthConfig{PasswordMaxAge: 90 * 24 * time.Hour, PasswordExpiryStrict: true})
+		user := createTestUser(t, db, "alice")
+		expirePassword(t, db, user)
+
+		err := s.ChangeExpiredPassword(ctx, "alice", "Wrong123", "Rotated456")
+		if !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("err = %v, want ErrInvalidCredentials", err)
+		}
+		if reloadUser(t, db, user.ID).CheckPassword(testPassword) != nil {
+			t.Fatal("password changed despite wrong credentials")
+		}
+	})
+
+	t.Run("not expired", func(t *testing.T) {
+		s, db := newTestAuthService(t, AuthConfig{PasswordMaxAge: 90 * 24 * time.Hour, PasswordExpiryStrict: true})
+		createTestUser(t, db, "alice")
+
+		err := s.ChangeExpiredPassword(ctx, "alice", testPassword, "Rotated456")
+		if !errors.Is(err, ErrPasswordNotExpired) {
+			t.Fatalf("err = %v, want ErrPasswordNotExpired", err)
+		}
+	})
+
+	t.Run("same password", func(t *testing.T) {
+		s, db := newTestAuthService(t, AuthConfig{PasswordMaxAge: 90 * 24 * time.Hour, PasswordExpiryStrict: true})
+		user := createTestUser(t, db, "alice")
+		expirePassword(t, db, user)
+
+		err := s.ChangeExpiredPassword(ctx, "alice", testPassword, testPassword)
+		if !errors.Is(err, ErrPasswordReused) {
+			t.Fatalf("err = %v, want ErrPasswordReused", err)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+
+	"github.com/JorgeSaicoski/login-go/internal/models"
+	"github.com/JorgeSaicoski/login-go/internal/repository"
+	"github.com/JorgeSaicoski/login-go/internal/testutil"
+)
+
+const testPassword = "Secret123"
+
+// newTestAuthService returns an HS256 AuthService over a fresh test
+// database. Zero durations in config get test defaults.
+func newTestAuthService(t testing.TB, config AuthConfig) (*AuthService, *gorm.DB) {
+	t.Helper()
+
+	db := testutil.NewDB(t)
+	logger := zap.NewNop()
+	config.Algorithm = AlgorithmHS256
+	config.HMACSecret = "test-secret"
+	if config.TokenExpiry == 0 {
+		config.TokenExpiry = time.Hour
+	}
+
+	s, err := NewAuthService(repository.NewUserRepository(db, logger), repository.NewRefreshTokenRepository(db, logger), nil, nil, nil, logger, config)
+	if err != nil {
+		t.Fatalf("NewAuthService: %v", err)
+	}
+	return s, db
+}
+
+// createTestUser stores an active user with testPassword
+func createTestUser(t testing.TB, db *gorm.DB, username string) *models.User {
+	t.Helper()
+	user := &models.User{
+		Name:             username,
+		UsernameForLogin: username,
+		Email:            username + "@example.com",
+		Password:         testPassword,
+		Active:           true,
+	}
+	if err := user.HashPassword(); err != nil {
+		t.Fatalf("hash password: %v", err)
+	}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	return user
+}
+
+func reloadUser(t *testing.T, db *gorm.DB, id uint) *models.User {
+	t.Helper()
+	var user models.User
+	if err := db.First(&user, id).Error; err != nil {
+		t.Fatalf("reload user: %v", err)
+	}
+	return &user
+}
@@ -0,0 +1,46 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+const (
+	DefaultKeyBits = 2048
+	minKeyBits     = 2048
+)
+
+// GenerateKeyPair creates a new RSA key pair PEM-encoded in the formats
+// AuthConfig expects. A bits value of 0 uses DefaultKeyBits.
+func GenerateKeyPair(bits int) ([]byte, []byte, error) {
+	if bits == 0 {
+		bits = DefaultKeyBits
+	}
+	if bits < minKeyBits {
+		return nil, nil, fmt.Errorf("key size must be at least %d bits", minKeyBits)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	privatePEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+
+	publicDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to encode public key: %w", err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: publicDER,
+	})
+
+	return privatePEM, publicPEM, nil
+}
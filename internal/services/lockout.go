@@ -0,0 +1,95 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// LoginAttemptTracker counts consecutive failed logins per key (username)
+// and reports when the key is locked out.
+type LoginAttemptTracker interface {
+	// RecordFailure registers a failed attempt and reports whether the key
+	// is now locked.
+	RecordFailure(key string) bool
+	// IsLocked reports whether the key is locked and for how much longer.
+	IsLocked(key string) (bool, time.Duration)
+	// Reset clears the failure count after a successful login.
+	Reset(key string)
+}
+
+const (
+	defaultMaxLoginAttempts = 5
+	defaultLockoutDuration  = 15 * time.Minute
+)
+
+type loginAttempts struct {
+	failures    int
+	lockedUntil time.Time
+}
+
+// MemoryLoginAttemptTracker is an in-process LoginAttemptTracker. Lockouts
+// expire on their own once the lockout duration has passed.
+type MemoryLoginAttemptTracker struct {
+	mu              sync.Mutex
+	attempts        map[string]*loginAttempts
+	maxAttempts     int
+	lockoutDuration time.Duration
+}
+
+func NewMemoryLoginAttemptTracker(maxAttempts int, lockoutDuration time.Duration) *MemoryLoginAttemptTracker {
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxLoginAttempts
+	}
+	if lockoutDuration <= 0 {
+		lockoutDuration = defaultLockoutDuration
+	}
+	return &MemoryLoginAttemptTracker{
+		attempts:        make(map[string]*loginAttempts),
+		maxAttempts:     maxAttempts,
+		lockoutDuration: lockoutDuration,
+	}
+}
+
+func (t *MemoryLoginAttemptTracker) RecordFailure(key string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := t.attempts[key]
+	if !ok || (!entry.lockedUntil.IsZero() && !now.Before(entry.lockedUntil)) {
+		// First failure, or the previous lockout has expired
+		entry = &loginAttempts{}
+		t.attempts[key] = entry
+	}
+
+	entry.failures++
+	if entry.failures >= t.maxAttempts {
+		entry.lockedUntil = now.Add(t.lockoutDuration)
+		return true
+	}
+	return false
+}
+
+func (t *MemoryLoginAttemptTracker) IsLocked(key string) (bool, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.attempts[key]
+	if !ok || entry.lockedUntil.IsZero() {
+		return false, 0
+	}
+
+	remaining := time.Until(entry.lockedUntil)
+	if remaining <= 0 {
+		delete(t.attempts, key)
+		return false, 0
+	}
+	return true, remaining
+}
+
+func (t *MemoryLoginAttemptTracker) Reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.attempts, key)
+}
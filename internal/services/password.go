@@ -0,0 +1,90 @@
+package services
+
+import (
+	_ "embed"
+	"errors"
+	"strings"
+	"unicode"
+)
+
+//go:embed common_passwords.txt
+var commonPasswordList string
+
+var commonPasswords = func() map[string]struct{} {
+	passwords := make(map[string]struct{})
+	for _, line := range strings.Split(commonPasswordList, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			passwords[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	return passwords
+}()
+
+var (
+	ErrPasswordTooShort  = errors.New("password must be at least 8 characters")
+	ErrPasswordNoUpper   = errors.New("password must contain an uppercase letter")
+	ErrPasswordNoLower   = errors.New("password must contain a lowercase letter")
+	ErrPasswordNoDigit   = errors.New("password must contain a digit")
+	ErrPasswordNoSymbol  = errors.New("password must contain a symbol")
+	ErrPasswordTooCommon = errors.New("password is too common")
+)
+
+// PasswordPolicy selects which character classes a password must contain
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+}
+
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:     8,
+	RequireUpper:  true,
+	RequireLower:  true,
+	RequireDigit:  true,
+	RequireSymbol: false,
+}
+
+// ValidatePasswordStrength checks pw against DefaultPasswordPolicy
+func ValidatePasswordStrength(pw string) error {
+	return DefaultPasswordPolicy.Validate(pw)
+}
+
+// Validate returns the first rule pw breaks, or nil if it satisfies the policy
+func (p PasswordPolicy) Validate(pw string) error {
+	if len([]rune(pw)) < p.MinLength {
+		return ErrPasswordTooShort
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range pw {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			hasSymbol = true
+		}
+	}
+
+	switch {
+	case p.RequireUpper && !hasUpper:
+		return ErrPasswordNoUpper
+	case p.RequireLower && !hasLower:
+		return ErrPasswordNoLower
+	case p.RequireDigit && !hasDigit:
+		return ErrPasswordNoDigit
+	case p.RequireSymbol && !hasSymbol:
+		return ErrPasswordNoSymbol
+	}
+
+	if _, ok := commonPasswords[strings.ToLower(pw)]; ok {
+		return ErrPasswordTooCommon
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/JorgeSaicoski/login-go/internal/logging"
+	"github.com/JorgeSaicoski/login-go/internal/models"
+	"github.com/JorgeSaicoski/login-go/internal/repository"
+)
+
+const defaultPasswordHistorySize = 5
+
+var ErrPasswordReused = errors.New("password was used recently")
+
+// PasswordHistoryService stops users from going back to one of their last
+// few passwords. Every password change or reset must call CheckReuse before
+// saving the new hash and Remember after.
+type PasswordHistoryService struct {
+	repo   *repository.PasswordHistoryRepository
+	size   int
+	logger *zap.Logger
+}
+
+// NewPasswordHistoryService keeps the last size passwords, including the
+// current one; size defaults to 5.
+func NewPasswordHistoryService(repo *repository.PasswordHistoryRepository, size int, logger *zap.Logger) *PasswordHistoryService {
+	if size <= 0 {
+		size = defaultPasswordHistorySize
+	}
+	return &PasswordHistoryService{
+		repo:   repo,
+		size:   size,
+		logger: logger,
+	}
+}
+
+// CheckReuse returns ErrPasswordReused when newPassword matches the user's
+// current password or one of the previous ones still kept.
+func (s *PasswordHistoryService) CheckReuse(ctx context.Context, user *models.User, newPassword string) error {
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(newPassword)) == nil {
+		return ErrPasswordReused
+	}
+
+	// The current password already takes one slot of the history
+	if s.size <= 1 {
+		return nil
+	}
+	history, err := s.repo.RecentWithContext(ctx, user.ID, s.size-1)
+	if err != nil {
+		return err
+	}
+	for _, entry := range history {
+		if bcrypt.CompareHashAndPassword([]byte(entry.PasswordHash), []byte(newPassword)) == nil {
+			logging.FromContext(ctx, s.logger).Warn("password change rejected: password reused",
+				zap.Uint("user_id", user.ID),
+			)
+			return ErrPasswordReused
+		}
+	}
+	return nil
+}
+
+// Remember adds the hash being replaced to the user's history
+func (s *PasswordHistoryService) Remember(ctx context.Context, userID uint, oldHash string) error {
+	if s.size <= 1 {
+		return nil
+	}
+	return s.repo.AddWithContext(ctx, userID, oldHash, s.size-1)
+}
@@ -0,0 +1,83 @@
+package services
+
+import (
+	"sync"
+	"time"
+)
+
+// TokenRevoker tracks tokens that were invalidated before their expiry.
+type TokenRevoker interface {
+	Revoke(jti string, exp time.Time)
+	IsRevoked(jti string) bool
+	// Cleanup removes the entries of tokens that expired by now and
+	// returns how many were removed
+	Cleanup(now time.Time) (int, error)
+}
+
+const defaultRevocationSweepInterval = time.Minute
+
+// MemoryTokenRevoker keeps revoked token IDs in memory until the tokens
+// themselves expire. Expired entries are swept lazily on Revoke and by
+// Cleanup, so an idle store doesn't hold on to them.
+type MemoryTokenRevoker struct {
+	mu            sync.RWMutex
+	revoked       map[string]time.Time
+	sweepInterval time.Duration
+	lastSweep     time.Time
+}
+
+func NewMemoryTokenRevoker() *MemoryTokenRevoker {
+	return &MemoryTokenRevoker{
+		revoked:       make(map[string]time.Time),
+		sweepInterval: defaultRevocationSweepInterval,
+		lastSweep:     time.Now(),
+	}
+}
+
+func (r *MemoryTokenRevoker) Revoke(jti string, exp time.Time) {
+	if jti == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.lastSweep) >= r.sweepInterval {
+		r.sweep(now)
+	}
+
+	// Nothing to track once the token has expired on its own
+	if !exp.After(now) {
+		return
+	}
+	r.revoked[jti] = exp
+}
+
+func (r *MemoryTokenRevoker) IsRevoked(jti string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	exp, ok := r.revoked[jti]
+	return ok && exp.After(time.Now())
+}
+
+func (r *MemoryTokenRevoker) Cleanup(now time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sweep(now), nil
+}
+
+// sweep drops entries whose tokens have expired and returns how many it
+// dropped. Callers must hold the lock.
+func (r *MemoryTokenRevoker) sweep(now time.Time) int {
+	removed := 0
+	for jti, exp := range r.revoked {
+		if !exp.After(now) {
+			delete(r.revoked, jti)
+			removed++
+		}
+	}
+	r.lastSweep = now
+	return removed
+}
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryTokenRevokerCleanup(t *testing.T) {
+	r := NewMemoryTokenRevoker()
+	now := time.Now()
+	r.Revoke("soon", now.Add(time.Hour))
+	r.Revoke("later", now.Add(2*time.Hour))
+
+	removed, err := r.Cleanup(now.Add(90 * time.Minute))
+	if err != nil {
+		t.Fatalf("Cleanup: %v", err)
+	}
+	if removed != 1 {
+		t.Fatalf("removed %d entries, want 1", removed)
+	}
+	if len(r.revoked) != 1 {
+		t.Fatalf("%d entries left, want 1", len(r.revoked))
+	}
+	if !r.IsRevoked("later") {
+		t.Fatal("unexpired revocation was dropped")
+	}
+
+	// Nothing left to purge before the remaining token expires
+	if removed, _ := r.Cleanup(now.Add(90 * time.Minute)); removed != 0 {
+		t.Fatalf("second cleanup removed %d entries, want 0", removed)
+	}
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/JorgeSaicoski/login-go/internal/logging"
+	"github.com/JorgeSaicoski/login-go/internal/models"
+	"github.com/JorgeSaicoski/login-go/internal/repository"
+)
+
+// sessionTouchInterval limits how often a session's last-seen time is
+// written, so busy clients don't cause a write per request
+const sessionTouchInterval = time.Minute
+
+var ErrSessionsDisabled = errors.New("sessions are disabled")
+
+// SetSessionRepository turns on session tracking: every login records a
+// Session with the client's IP and user agent, and tokens tied to a session
+// are only accepted while it is active. Tokens issued before it was turned
+// on carry no session and keep working. Nil turns it off.
+func (s *AuthService) SetSessionRepository(repo *repository.SessionRepository) {
+	s.sessions = repo
+}
+
+// SessionsEnabled reports whether logins are tracked as sessions
+func (s *AuthService) SessionsEnabled() bool {
+	return s.sessions != nil
+}
+
+// WithSessionID ties a token to a session through the "sid" claim
+func WithSessionID(id uint) TokenOption {
+	return func(claims *models.Claims) {
+		if id != 0 {
+			claims.SessionID = id
+		}
+	}
+}
+
+// startSession records a login by user from the client in ctx and returns
+// the session ID, or 0 when sessions are disabled. The session lasts as long
+// as a refresh token, the longest-lived token it can issue.
+func (s *AuthService) startSession(ctx context.Context, user *models.User) (uint, error) {
+	if s.sessions == nil {
+		return 0, nil
+	}
+
+	info := clientInfoFromContext(ctx)
+	now := time.Now()
+	session := &models.Session{
+		UserID:     user.ID,
+		UserAgent:  info.userAgent,
+		IP:         info.ip,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.refreshTokenExpiry),
+	}
+	if err := s.sessions.CreateWithContext(ctx, session); err != nil {
+		return 0, err
+	}
+	return session.ID, nil
+}
+
+// checkSession rejects tokens whose session was revoked or has expired, and
+// records that the session was seen.
+func (s *AuthService) checkSession(ctx context.Context, claims *models.Claims) error {
+	if s.sessions == nil || claims.SessionID == 0 {
+		return nil
+	}
+
+	session, err := s.sessions.GetByIDWithContext(ctx, claims.SessionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrTokenRevoked
+		}
+		return fmt.Errorf("failed to check session: %w", err)
+	}
+
+	now := time.Now()
+	if session.UserID != claims.UserID || !session.Active(now) {
+		return ErrTokenRevoked
+	}
+
+	if now.Sub(session.LastSeenAt) >= sessionTouchInterval {
+		// Last seen is informational, so a failed write doesn't fail the request
+		if err := s.sessions.TouchWithContext(ctx, session.ID, now); err != nil {
+			logging.FromContext(ctx, s.logger).Warn("failed to update session last seen",
+				zap.Uint("session_id", session.ID),
+				zap.Error(err),
+			)
+		}
+	}
+	return nil
+}
+
+// ListSessions returns the user's active sessions, most recently used first
+func (s *AuthService) ListSessions(ctx context.Context, userID uint) ([]models.Session, error) {
+	if s.sessions == nil {
+		return nil, ErrSessionsDisabled
+	}
+	return s.sessions.ListActiveByUserWithContext(ctx, userID, time.Now())
+}
+
+// RevokeSession ends session id of userID, so every token issued for it is
+// rejected from then on. It returns repository.ErrNotFound if the user has
+// no such active session.
+func (s *AuthService) RevokeSession(ctx context.Context, userID, id uint) error {
+	start := time.Now()
+	defer func() {
+		authDuration.WithLabelValues("revoke_session").Observe(time.Since(start).Seconds())
+	}()
+
+	if s.sessions == nil {
+		return ErrSessionsDisabled
+	}
+
+	if err := s.sessions.RevokeWithContext(ctx, userID, id); err != nil {
+		authOperations.WithLabelValues("revoke_session", "failed").Inc()
+		return err
+	}
+
+	s.audit.Record(ctx, userID, models.AuthEventSessionRevoked)
+
+	logging.FromContext(ctx, s.logger).Info("session revoked",
+		zap.Uint("user_id", userID),
+		zap.Uint("session_id", id),
+	)
+
+	authOperations.WithLabelValues("revoke_session", "success").Inc()
+	return nil
+}
+
+// endSession revokes the session of a token being logged out, if any
+func (s *AuthService) endSession(ctx context.Context, claims *models.Claims) error {
+	if s.sessions == nil || claims.SessionID == 0 {
+		return nil
+	}
+	err := s.sessions.RevokeWithContext(ctx, claims.UserID, claims.SessionID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/JorgeSaicoski/login-go/internal/models"
+)
+
+// signTestToken signs an access token for user 1 with the test secret,
+// letting each case shift the time claims
+func signTestToken(t *testing.T, secret string, edit func(*models.Claims)) string {
+	t.Helper()
+	now := time.Now()
+	claims := &models.Claims{
+		UserID:    1,
+		Username:  "alice",
+		TokenType: models.TokenTypeAccess,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			Issuer:    defaultIssuer,
+		},
+	}
+	if edit != nil {
+		edit(claims)
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+func TestValidateTokenErrorCategories(t *testing.T) {
+	s, _ := newTestAuthService(t, AuthConfig{ClockSkewLeeway: 30 * time.Second})
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+		// invalid reports whether the error also matches ErrInvalidToken;
+		// expiry is kept apart so clients know to refresh instead
+		invalid bool
+	}{
+		{
+			name:  "valid",
+			token: signTestToken(t, "test-secret", nil),
+		},
+		{
+			name: "expired within leeway",
+			token: signTestToken(t, "test-secret", func(c *models.Claims) {
+				c.ExpiresAt = jwt.NewNumericDate(now.Add(-10 * time.Second))
+			}),
+		},
+		{
+			name: "expired",
+			token: signTestToken(t, "test-secret", func(c *models.Claims) {
+				c.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Hour))
+			}),
+			wantErr: ErrTokenExpired,
+		},
+		{
+			name: "not yet valid",
+			token: signTestToken(t, "test-secret", func(c *models.Claims) {
+				c.NotBefore = jwt.NewNumericDate(now.Add(time.Hour))
+			}),
+			wantErr: ErrTokenNotYetValid,
+			invalid: true,
+		},
+		{
+			name:    "malformed",
+			token:   "not-a-jwt",
+			wantErr: ErrTokenMalformed,
+			invalid: true,
+		},
+		{
+			name:    "bad signature",
+			token:   signTestToken(t, "other-secret", nil),
+			wantErr: ErrInvalidToken,
+			invalid: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.ValidateToken(context.Background(), tt.token)
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("err = %v, want nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrInvalidToken) != tt.invalid {
+				t.Fatalf("errors.Is(err, ErrInvalidToken) = %v, want %v", !tt.invalid, tt.invalid)
+			}
+			for _, other := range []error{ErrTokenExpired, ErrTokenNotYetValid, ErrTokenMalformed} {
+				if other != tt.wantErr && errors.Is(err, other) {
+					t.Fatalf("err = %v also matches %v", err, other)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,300 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/JorgeSaicoski/login-go/internal/logging"
+	"github.com/JorgeSaicoski/login-go/internal/models"
+	"github.com/JorgeSaicoski/login-go/internal/repository"
+)
+
+const defaultVerificationTokenTTL = 24 * time.Hour
+
+var (
+	ErrVerificationTokenInvalid = errors.New("invalid verification token")
+	ErrVerificationTokenExpired = errors.New("verification token expired")
+	ErrEmailAlreadyVerified     = errors.New("email already verified")
+	ErrEmailNotVerified         = errors.New("email not verified")
+	ErrEmailTaken               = errors.New("email already in use")
+)
+
+// VerificationSender delivers verification tokens to users, e.g. by email
+type VerificationSender interface {
+	SendVerification(ctx context.Context, user *models.User, token string) error
+	// SendEmailChange delivers the confirmation token for an email change
+	// to user.PendingEmail, the address being confirmed
+	SendEmailChange(ctx context.Context, user *models.User, token string) error
+}
+
+// LogVerificationSender only logs that a verification message would be
+// sent, until a real mailer is plugged in. Tokens are left out of the logs,
+// since anyone reading them could verify any address, unless devTokens is
+// set for local development; they are then logged at debug level.
+type LogVerificationSender struct {
+	logger    *zap.Logger
+	devTokens bool
+}
+
+func NewLogVerificationSender(logger *zap.Logger, devTokens bool) *LogVerificationSender {
+	return &LogVerificationSender{logger: logger, devTokens: devTokens}
+}
+
+func (s *LogVerificationSender) SendVerification(ctx context.Context, user *models.User, token string) error {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("verification email",
+		zap.Uint("user_id", user.ID),
+		zap.String("email", user.Email),
+	)
+	if s.devTokens {
+		logger.Debug("verification token",
+			zap.Uint("user_id", user.ID),
+			zap.String("token", token),
+		)
+	}
+	return nil
+}
+
+// SendEmailChange never logs the token, not even with devTokens: it would
+// let anyone reading the logs move the account to their own address.
+func (s *LogVerificationSender) SendEmailChange(ctx context.Context, user *models.User, token string) error {
+	logging.FromContext(ctx, s.logger).Info("email change confirmation",
+		zap.Uint("user_id", user.ID),
+		zap.String("email", user.PendingEmail),
+	)
+	return nil
+}
+
+// EmailVerificationService issues and redeems single-use email
+// verification tokens. Only a hash of each token is stored.
+type EmailVerificationService struct {
+	userRepo *repository.UserRepository
+	sender   VerificationSender
+	logger   *zap.Logger
+	tokenTTL time.Duration
+}
+
+func NewEmailVerificationService(userRepo *repository.UserRepository, sender VerificationSender, logger *zap.Logger, tokenTTL time.Duration) *EmailVerificationService {
+	if tokenTTL <= 0 {
+		tokenTTL = defaultVerificationTokenTTL
+	}
+	return &EmailVerificationService{
+		userRepo: userRepo,
+		sender:   sender,
+		logger:   logger,
+		tokenTTL: tokenTTL,
+	}
+}
+
+// Issue creates a new verification token for user, replacing any pending
+// one, and hands it to the sender.
+func (s *EmailVerificationService) Issue(ctx context.Context, user *models.User) error {
+	start := time.Now()
+	defer func() {
+		authDuration.WithLabelValues("issue_verification").Observe(time.Since(start).Seconds())
+	}()
+
+	if user.EmailVerified {
+		authOperations.WithLabelValues("issue_verification", "failed").Inc()
+		return ErrEmailAlreadyVerified
+	}
+
+	token, err := newVerificationToken()
+	if err != nil {
+		authOperations.WithLabelValues("issue_verification", "failed").Inc()
+		return fmt.Errorf("failed to generate verification token: %w", err)
+	}
+
+	expiresAt := time.Now().Add(s.tokenTTL)
+	user.VerificationToken = hashToken(token)
+	user.VerificationTokenExpiresAt = &expiresAt
+
+	if err := s.userRepo.UpdateWithContext(ctx, user); err != nil {
+		authOperations.WithLabelValues("issue_verification", "failed").Inc()
+		return fmt.Errorf("failed to store verification token: %w", err)
+	}
+
+	if err := s.sender.SendVerification(ctx, user, token); err != nil {
+		logging.FromContext(ctx, s.logger).Error("failed to send verification",
+			zap.Error(err),
+			zap.Uint("user_id", user.ID),
+		)
+		authOperations.WithLabelValues("issue_verification", "failed").Inc()
+		return fmt.Errorf("failed to send verification: %w", err)
+	}
+
+	authOperations.WithLabelValues("issue_verification", "success").Inc()
+	return nil
+}
+
+// Verify marks the owner of token as verified and consumes the token
+func (s *EmailVerificationService) Verify(ctx context.Context, token string) (*models.User, error) {
+	start := time.Now()
+	defer func() {
+		authDuration.WithLabelValues("verify_email").Observe(time.Since(start).Seconds())
+	}()
+
+	if token == "" {
+		authOperations.WithLabelValues("verify_email", "failed").Inc()
+		return nil, ErrVerificationTokenInvalid
+	}
+
+	// The token was written moments ago and may not have reached a replica
+	user, err := s.userRepo.GetByVerificationTokenWithContext(repository.WithPrimary(ctx), hashToken(token))
+	if err != nil {
+		authOperations.WithLabelValues("verify_email", "failed").Inc()
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrVerificationTokenInvalid
+		}
+		return nil, err
+	}
+
+	if user.VerificationTokenExpiresAt == nil || time.Now().After(*user.VerificationTokenExpiresAt) {
+		authOperations.WithLabelValues("verify_email", "expired").Inc()
+		return nil, ErrVerificationTokenExpired
+	}
+
+	user.EmailVerified = true
+	user.VerificationToken = ""
+	user.VerificationTokenExpiresAt = nil
+
+	if err := s.userRepo.UpdateWithContext(ctx, user); err != nil {
+		authOperations.WithLabelValues("verify_email", "failed").Inc()
+		return nil, fmt.Errorf("failed to mark email verified: %w", err)
+	}
+
+	logging.FromContext(ctx, s.logger).Info("email verified",
+		zap.Uint("user_id", user.ID),
+	)
+
+	authOperations.WithLabelValues("verify_email", "success").Inc()
+	return user, nil
+}
+
+// RequestEmailChange stores newEmail as the user's pending address and sends
+// a confirmation token to it. Email is left untouched until the token is
+// confirmed, and a new request replaces any pending one. Other changes
+// already made to user are saved with it.
+func (s *EmailVerificationService) RequestEmailChange(ctx context.Context, user *models.User, newEmail string) error {
+	start := time.Now()
+	defer func() {
+		authDuration.WithLabelValues("request_email_change").Observe(time.Since(start).Seconds())
+	}()
+
+	token, err := newVerificationToken()
+	if err != nil {
+		authOperations.WithLabelValues("request_email_change", "failed").Inc()
+		return fmt.Errorf("failed to generate email change token: %w", err)
+	}
+
+	expiresAt := time.Now().Add(s.tokenTTL)
+	user.PendingEmail = models.NormalizeIdentifier(newEmail)
+	user.EmailChangeToken = hashToken(token)
+	user.EmailChangeTokenExpiresAt = &expiresAt
+
+	if err := s.userRepo.UpdateWithContext(ctx, user); err != nil {
+		authOperations.WithLabelValues("request_email_change", "failed").Inc()
+		return fmt.Errorf("failed to store email change token: %w", err)
+	}
+
+	if err := s.sender.SendEmailChange(ctx, user, token); err != nil {
+		logging.FromContext(ctx, s.logger).Error("failed to send email change confirmation",
+			zap.Error(err),
+			zap.Uint("user_id", user.ID),
+		)
+		authOperations.WithLabelValues("request_email_change", "failed").Inc()
+		return fmt.Errorf("failed to send email change confirmation: %w", err)
+	}
+
+	authOperations.WithLabelValues("request_email_change", "success").Inc()
+	return nil
+}
+
+// ConfirmEmailChange swaps the pending address of the owner of token into
+// Email and consumes the token. The address counts as verified since the
+// token could only be read from its inbox. ErrEmailTaken means another
+// account took the address after the change was requested.
+func (s *EmailVerificationService) ConfirmEmailChange(ctx context.Context, token string) (*models.User, error) {
+	start := time.Now()
+	defer func() {
+		authDuration.WithLabelValues("confirm_email_change").Observe(time.Since(start).Seconds())
+	}()
+
+	if token == "" {
+		authOperations.WithLabelValues("confirm_email_change", "failed").Inc()
+		return nil, ErrVerificationTokenInvalid
+	}
+
+	user, err := s.userRepo.GetByEmailChangeTokenWithContext(repository.WithPrimary(ctx), hashToken(token))
+	if err != nil {
+		authOperations.WithLabelValues("confirm_email_change", "failed").Inc()
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, ErrVerificationTokenInvalid
+		}
+		return nil, err
+	}
+
+	if user.PendingEmail == "" {
+		authOperations.WithLabelValues("confirm_email_change", "failed").Inc()
+		return nil, ErrVerificationTokenInvalid
+	}
+	if user.EmailChangeTokenExpiresAt == nil || time.Now().After(*user.EmailChangeTokenExpiresAt) {
+		authOperations.WithLabelValues("confirm_email_change", "expired").Inc()
+		return nil, ErrVerificationTokenExpired
+	}
+
+	oldEmail := user.Email
+	user.Email = user.PendingEmail
+	user.EmailVerified = true
+	user.VerificationToken = ""
+	user.VerificationTokenExpiresAt = nil
+	user.ClearPendingEmail()
+
+	if err := s.userRepo.UpdateWithContext(ctx, user); err != nil {
+		authOperations.WithLabelValues("confirm_email_change", "failed").Inc()
+		if errors.Is(err, repository.ErrDuplicateEntry) {
+			return nil, ErrEmailTaken
+		}
+		return nil, fmt.Errorf("failed to change email: %w", err)
+	}
+
+	logging.FromContext(ctx, s.logger).Info("email changed",
+		zap.Uint("user_id", user.ID),
+		zap.String("old_email", oldEmail),
+		zap.String("new_email", user.Email),
+	)
+
+	authOperations.WithLabelValues("confirm_email_change", "success").Inc()
+	return user, nil
+}
+
+// Resend issues a fresh token for the account registered with email
+func (s *EmailVerificationService) Resend(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmailWithContext(repository.WithPrimary(ctx), email)
+	if err != nil {
+		return err
+	}
+	return s.Issue(ctx, user)
+}
+
+func newVerificationToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken is the sha256 form stored for one-time and refresh tokens, so a
+// database leak does not expose usable tokens
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,47 @@
+// Package testutil holds helpers shared by the tests of several packages.
+// It must only be imported from _test.go files.
+package testutil
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+
+	"github.com/JorgeSaicoski/login-go/internal/models"
+)
+
+// NewDB returns a migrated, empty SQLite database private to t, so tests
+// exercise the real repositories without a Postgres server. WAL mode lets
+// reads outside a transaction proceed while it holds the write lock, as
+// they would on Postgres.
+func NewDB(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	dsn := filepath.Join(t.TempDir(), "test.db") +
+		"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	if err := db.AutoMigrate(&models.User{}, &models.Subscription{}, &models.UserSubscription{}, &models.AuthEvent{}, &models.RefreshToken{}, &models.PasswordHistory{}, &models.Session{}); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	for _, stmt := range []string{
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_users_username_lower ON users (LOWER(username_for_login))",
+		"CREATE UNIQUE INDEX IF NOT EXISTS idx_users_email_lower ON users (LOWER(email))",
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatalf("create test index: %v", err)
+		}
+	}
+	return db
+}
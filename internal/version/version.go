@@ -0,0 +1,12 @@
+// Package version holds build information injected at link time, e.g.
+//
+//	go build -ldflags "-X github.com/JorgeSaicoski/login-go/internal/version.Version=v1.2.0 \
+//	  -X github.com/JorgeSaicoski/login-go/internal/version.Commit=$(git rev-parse --short HEAD) \
+//	  -X github.com/JorgeSaicoski/login-go/internal/version.BuildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+package version
+
+var (
+	Version   = "dev"
+	Commit    = "dev"
+	BuildTime = "dev"
+)
@@ -0,0 +1,36 @@
+package workers
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+
+	"github.com/JorgeSaicoski/login-go/internal/logging"
+	"github.com/JorgeSaicoski/login-go/internal/models"
+)
+
+// Notifier tells a user that their subscription is about to expire, e.g. by
+// email. The subscription is passed with its User and Subscription loaded.
+type Notifier interface {
+	NotifyExpiring(ctx context.Context, us *models.UserSubscription) error
+}
+
+// LogNotifier only logs that an expiry notice would be sent. It is the
+// default until a real mailer is plugged in.
+type LogNotifier struct {
+	logger *zap.Logger
+}
+
+func NewLogNotifier(logger *zap.Logger) *LogNotifier {
+	return &LogNotifier{logger: logger}
+}
+
+func (n *LogNotifier) NotifyExpiring(ctx context.Context, us *models.UserSubscription) error {
+	logging.FromContext(ctx, n.logger).Info("subscription expiry notice",
+		zap.Uint("user_id", us.UserID),
+		zap.String("email", us.User.Email),
+		zap.Uint("subscription_id", us.ID),
+		zap.Time("end_date", us.EndDate),
+	)
+	return nil
+}
@@ -0,0 +1,122 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/JorgeSaicoski/login-go/internal/metrics"
+)
+
+var (
+	workerRuns = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "worker_runs_total",
+			Help: "Total number of background worker runs",
+		},
+		[]string{"worker", "status"},
+	)
+
+	workerDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name: "worker_run_duration_seconds",
+			Help: "Duration of background worker runs in seconds",
+		},
+		[]string{"worker"},
+	)
+)
+
+func init() {
+	metrics.Register(workerRuns, workerDuration)
+}
+
+// Job is the unit of work a Periodic worker runs on every tick
+type Job func(ctx context.Context) error
+
+// Periodic runs a Job on a fixed interval until its context is cancelled
+type Periodic struct {
+	name     string
+	interval time.Duration
+	job      Job
+	logger   *zap.Logger
+	registry *Registry
+}
+
+func NewPeriodic(name string, interval time.Duration, job Job, logger *zap.Logger) *Periodic {
+	return &Periodic{
+		name:     name,
+		interval: interval,
+		job:      job,
+		logger:   logger,
+	}
+}
+
+func (p *Periodic) Name() string {
+	return p.name
+}
+
+// ReportTo registers the worker with registry, which is then updated after
+// every run
+func (p *Periodic) ReportTo(registry *Registry) {
+	p.registry = registry
+	if p.interval > 0 {
+		registry.Register(p.name, p.interval)
+	}
+}
+
+// Run blocks, running the job once per interval, and returns when ctx is
+// cancelled. A run in progress is given the same ctx so it can stop early.
+// A worker with an interval of 0 or less is disabled and returns at once.
+func (p *Periodic) Run(ctx context.Context) {
+	if p.interval <= 0 {
+		p.logger.Info("worker disabled",
+			zap.String("worker", p.name),
+		)
+		return
+	}
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	p.logger.Info("worker started",
+		zap.String("worker", p.name),
+		zap.Duration("interval", p.interval),
+	)
+
+	for {
+		select {
+		case <-ctx.Done():
+			p.logger.Info("worker stopped",
+				zap.String("worker", p.name),
+			)
+			return
+		case <-ticker.C:
+			p.runOnce(ctx)
+		}
+	}
+}
+
+func (p *Periodic) runOnce(ctx context.Context) {
+	start := time.Now()
+	defer func() {
+		workerDuration.WithLabelValues(p.name).Observe(time.Since(start).Seconds())
+	}()
+
+	err := p.job(ctx)
+	if p.registry != nil {
+		p.registry.RecordRun(p.name, time.Now(), err)
+	}
+
+	if err != nil {
+		p.logger.Error("worker run failed",
+			zap.String("worker", p.name),
+			zap.Error(err),
+		)
+		workerRuns.WithLabelValues(p.name, "failed").Inc()
+		return
+	}
+
+	workerRuns.WithLabelValues(p.name, "success").Inc()
+}
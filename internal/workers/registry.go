@@ -0,0 +1,97 @@
+package workers
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// stallFactor is how many intervals may pass without a run before a
+// worker is reported as stalled
+const stallFactor = 2
+
+// WorkerStatus is a worker's health as reported by Registry.Status
+type WorkerStatus struct {
+	Name string `json:"name"`
+	// Interval is the expected time between runs, e.g. "1h0m0s"
+	Interval string `json:"interval"`
+	// LastRun is nil until the first run completes
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	LastError string     `json:"last_error,omitempty"`
+	Healthy   bool       `json:"healthy"`
+}
+
+type workerState struct {
+	interval   time.Duration
+	registered time.Time
+	lastRun    time.Time
+	lastError  string
+}
+
+// Registry tracks when each background worker last ran so health checks
+// can spot workers that have stopped ticking.
+type Registry struct {
+	mu      sync.RWMutex
+	workers map[string]*workerState
+}
+
+func NewRegistry() *Registry {
+	return &Registry{workers: make(map[string]*workerState)}
+}
+
+// Register adds a worker expected to run every interval
+func (r *Registry) Register(name string, interval time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.workers[name] = &workerState{
+		interval:   interval,
+		registered: time.Now(),
+	}
+}
+
+// RecordRun notes that the named worker finished a run at the given time;
+// err is the run's error, if any.
+func (r *Registry) RecordRun(name string, at time.Time, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state, ok := r.workers[name]
+	if !ok {
+		return
+	}
+	state.lastRun = at
+	state.lastError = ""
+	if err != nil {
+		state.lastError = err.Error()
+	}
+}
+
+// Status reports every registered worker, sorted by name. A worker is
+// unhealthy when it has not run for stallFactor intervals; workers that
+// have not run yet are measured from when they were registered.
+func (r *Registry) Status() []WorkerStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	statuses := make([]WorkerStatus, 0, len(r.workers))
+	for name, state := range r.workers {
+		since := state.registered
+		status := WorkerStatus{
+			Name:      name,
+			Interval:  state.interval.String(),
+			LastError: state.lastError,
+		}
+		if !state.lastRun.IsZero() {
+			lastRun := state.lastRun
+			status.LastRun = &lastRun
+			since = lastRun
+		}
+		status.Healthy = now.Sub(since) <= stallFactor*state.interval
+		statuses = append(statuses, status)
+	}
+
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].Name < statuses[j].Name
+	})
+	return statuses
+}
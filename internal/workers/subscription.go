@@ -0,0 +1,107 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/JorgeSaicoski/login-go/internal/metrics"
+	"github.com/JorgeSaicoski/login-go/internal/repository"
+)
+
+var (
+	subscriptionsRenewed = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "subscriptions_renewed_total",
+			Help: "Total number of subscriptions renewed automatically",
+		},
+	)
+
+	subscriptionsDeactivated = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "subscriptions_deactivated_total",
+			Help: "Total number of expired subscriptions marked inactive",
+		},
+	)
+
+	expiryNotifications = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "subscription_expiry_notifications_total",
+			Help: "Total number of subscription expiry notices by status",
+		},
+		[]string{"status"},
+	)
+)
+
+func init() {
+	metrics.Register(subscriptionsRenewed, subscriptionsDeactivated, expiryNotifications)
+}
+
+// NewRenewalWorker renews auto-renew subscriptions that end within the window
+func NewRenewalWorker(repo *repository.UserSubscriptionRepository, window, interval time.Duration, logger *zap.Logger) *Periodic {
+	return NewPeriodic("subscription_renewal", interval, func(ctx context.Context) error {
+		renewed, err := repo.RenewExpiring(ctx, window)
+		if err != nil {
+			return err
+		}
+
+		subscriptionsRenewed.Add(float64(renewed))
+		logger.Info("subscriptions renewed",
+			zap.Int("count", renewed),
+		)
+		return nil
+	}, logger)
+}
+
+// NewExpiryWorker marks subscriptions past their end date as inactive
+func NewExpiryWorker(repo *repository.UserSubscriptionRepository, interval time.Duration, logger *zap.Logger) *Periodic {
+	return NewPeriodic("subscription_expiry", interval, func(ctx context.Context) error {
+		deactivated, err := repo.DeactivateExpired(ctx)
+		if err != nil {
+			return err
+		}
+
+		subscriptionsDeactivated.Add(float64(deactivated))
+		logger.Info("expired subscriptions deactivated",
+			zap.Int64("count", deactivated),
+		)
+		return nil
+	}, logger)
+}
+
+// NewExpiryNotificationWorker notifies users whose subscriptions end within
+// the window. A subscription is only marked notified once the notifier
+// succeeds, so failed notices are retried on the next run.
+func NewExpiryNotificationWorker(repo *repository.UserSubscriptionRepository, notifier Notifier, window, interval time.Duration, logger *zap.Logger) *Periodic {
+	return NewPeriodic("subscription_expiry_notification", interval, func(ctx context.Context) error {
+		expiring, err := repo.GetExpiringWithin(ctx, window)
+		if err != nil {
+			return err
+		}
+
+		notified := 0
+		for i := range expiring {
+			us := &expiring[i]
+			if err := notifier.NotifyExpiring(ctx, us); err != nil {
+				expiryNotifications.WithLabelValues("failed").Inc()
+				logger.Warn("failed to send expiry notice",
+					zap.Uint("subscription_id", us.ID),
+					zap.Error(err),
+				)
+				continue
+			}
+			if err := repo.MarkNotified(ctx, us.ID, time.Now()); err != nil {
+				return err
+			}
+			expiryNotifications.WithLabelValues("success").Inc()
+			notified++
+		}
+
+		logger.Info("subscription expiry notices sent",
+			zap.Int("count", notified),
+		)
+		return nil
+	}, logger)
+}
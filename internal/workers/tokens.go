@@ -0,0 +1,65 @@
+package workers
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+
+	"github.com/JorgeSaicoski/login-go/internal/metrics"
+	"github.com/JorgeSaicoski/login-go/internal/repository"
+	"github.com/JorgeSaicoski/login-go/internal/services"
+)
+
+var tokensPurged = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "expired_tokens_purged_total",
+		Help: "Total number of expired token records removed by store",
+	},
+	[]string{"store"},
+)
+
+func init() {
+	metrics.Register(tokensPurged)
+}
+
+// NewTokenCleanupWorker removes revocation entries, stored refresh tokens
+// and sessions that have expired, so none of the stores grows without bound.
+// A nil refreshTokens or sessions skips that table.
+func NewTokenCleanupWorker(revoker services.TokenRevoker, refreshTokens *repository.RefreshTokenRepository, sessions *repository.SessionRepository, interval time.Duration, logger *zap.Logger) *Periodic {
+	return NewPeriodic("token_cleanup", interval, func(ctx context.Context) error {
+		now := time.Now()
+
+		revoked, err := revoker.Cleanup(now)
+		if err != nil {
+			return err
+		}
+		tokensPurged.WithLabelValues("revocations").Add(float64(revoked))
+
+		var refresh int64
+		if refreshTokens != nil {
+			refresh, err = refreshTokens.DeleteExpiredWithContext(ctx, now)
+			if err != nil {
+				return err
+			}
+			tokensPurged.WithLabelValues("refresh_tokens").Add(float64(refresh))
+		}
+
+		var expiredSessions int64
+		if sessions != nil {
+			expiredSessions, err = sessions.DeleteExpiredWithContext(ctx, now)
+			if err != nil {
+				return err
+			}
+			tokensPurged.WithLabelValues("sessions").Add(float64(expiredSessions))
+		}
+
+		logger.Info("expired tokens purged",
+			zap.Int("revocations", revoked),
+			zap.Int64("refresh_tokens", refresh),
+			zap.Int64("sessions", expiredSessions),
+		)
+		return nil
+	}, logger)
+}